@@ -0,0 +1,66 @@
+// Command fakegithub runs the fake GitHub server for offline development.
+// Point github.web_url and github.api_url at http://localhost:8091.
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"opengptmservice/internal/fakegithub"
+)
+
+func main() {
+	addr := flag.String("addr", ":8091", "address to listen on")
+	fixtures := flag.String("fixtures", "", "directory with JSON files overriding the built-in fixtures")
+	token := flag.String("token", fakegithub.DefaultToken, "access token issued by the OAuth flow")
+	appID := flag.Int64("app-id", 0, "GitHub App ID, enabling the app mode with -app-key")
+	appKey := flag.String("app-key", "", "PEM file with the GitHub App private key whose JWTs are accepted")
+	flag.Parse()
+
+	server := fakegithub.New()
+	server.Token = *token
+
+	if *appKey != "" {
+		data, err := os.ReadFile(*appKey)
+		if err != nil {
+			log.Fatalf("Error reading app key: %v", err)
+		}
+		block, _ := pem.Decode(data)
+		if block == nil {
+			log.Fatalf("No PEM data found in %s", *appKey)
+		}
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			log.Fatalf("Error parsing app key: %v", err)
+		}
+		server.AppID = *appID
+		server.AppKey = &key.PublicKey
+		log.Printf("GitHub App mode enabled for app %d", *appID)
+	}
+
+	if *fixtures != "" {
+		files, err := filepath.Glob(filepath.Join(*fixtures, "*.json"))
+		if err != nil {
+			log.Fatalf("Error listing fixtures: %v", err)
+		}
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				log.Fatalf("Error reading fixture: %v", err)
+			}
+			server.SetFixture(strings.TrimSuffix(filepath.Base(file), ".json"), data)
+		}
+		log.Printf("Loaded %d fixtures from %s", len(files), *fixtures)
+	}
+
+	log.Printf("Fake GitHub server listening on %s", *addr)
+	if err := http.ListenAndServe(*addr, server); err != nil {
+		log.Fatalf("Failed to start server: %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+// Command fakellm runs the fake chat completions server for offline
+// development. Point atoma.base_url at http://localhost:8090/v1/chat/completions.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+
+	"opengptmservice/internal/fakellm"
+)
+
+func main() {
+	addr := flag.String("addr", ":8090", "address to listen on")
+	script := flag.String("script", "", "JSON file with a list of behaviours to play in order")
+	content := flag.String("content", "", "content returned once the script is exhausted")
+	apiKey := flag.String("api-key", "", "API key required as bearer token")
+	flag.Parse()
+
+	server := fakellm.New()
+	server.APIKey = *apiKey
+	if *content != "" {
+		server.SetDefault(fakellm.Respond(*content))
+	}
+
+	if *script != "" {
+		data, err := os.ReadFile(*script)
+		if err != nil {
+			log.Fatalf("Error reading script: %v", err)
+		}
+		var behaviours []fakellm.Behaviour
+		if err := json.Unmarshal(data, &behaviours); err != nil {
+			log.Fatalf("Error parsing script: %v", err)
+		}
+		server.Enqueue(behaviours...)
+		log.Printf("Loaded %d scripted behaviours", len(behaviours))
+	}
+
+	log.Printf("Fake LLM server listening on %s", *addr)
+	if err := http.ListenAndServe(*addr, server); err != nil {
+		log.Fatalf("Failed to start server: %v", err)
+	}
+}
@@ -0,0 +1,1273 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+
+	"opengptmservice/internal/fakegithub"
+	"opengptmservice/internal/fakellm"
+	"opengptmservice/internal/jobs"
+	"opengptmservice/internal/models"
+	"opengptmservice/internal/services"
+	"opengptmservice/internal/storage"
+)
+
+const fakeLLMContent = "Seasoned open source developer with a passion for developer tooling."
+
+var jobIDPattern = regexp.MustCompile(`data-job-id="([^"]+)"`)
+
+// newTestServer starts the application against a fake GitHub and a fake LLM
+// server and returns its URL. config is set on top of the test configuration.
+func newTestServer(t *testing.T, gh *fakegithub.Server, llm *fakellm.Server, config map[string]interface{}) string {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	ghServer := httptest.NewServer(gh)
+	t.Cleanup(ghServer.Close)
+	llmServer := httptest.NewServer(llm)
+	t.Cleanup(llmServer.Close)
+	app := httptest.NewUnstartedServer(nil)
+
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.Set("github.client_id", "test-client")
+	viper.Set("github.client_secret", "test-secret")
+	viper.Set("github.web_url", ghServer.URL)
+	viper.Set("github.api_url", ghServer.URL)
+	viper.Set("github.redirect_url", "http://"+app.Listener.Addr().String()+"/auth/github/callback")
+	viper.Set("atoma.base_url", llmServer.URL+"/v1/chat/completions")
+	viper.Set("atoma.api_key", llm.APIKey)
+	viper.Set("atoma.model", "fake-model")
+	viper.Set("cv.mode", "pipeline")
+	viper.Set("cache.backend", "none")
+	viper.Set("storage.path", filepath.Join(t.TempDir(), "cvs.db"))
+	for key, value := range config {
+		viper.Set(key, value)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	router, err := newRouter(ctx, "../../web")
+	if err != nil {
+		t.Fatalf("newRouter: %v", err)
+	}
+	app.Config.Handler = router
+	app.Start()
+	t.Cleanup(app.Close)
+
+	return app.URL
+}
+
+// newTestClient returns a client that keeps the session cookie between requests
+func newTestClient(t *testing.T) *http.Client {
+	t.Helper()
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &http.Client{Jar: jar, Timeout: 10 * time.Second}
+}
+
+func get(t *testing.T, client *http.Client, url string) (int, string) {
+	t.Helper()
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading %s: %v", url, err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func post(t *testing.T, client *http.Client, url string, form url.Values) (int, string) {
+	t.Helper()
+	resp, err := client.PostForm(url, form)
+	if err != nil {
+		t.Fatalf("POST %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading %s: %v", url, err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func do(t *testing.T, client *http.Client, method, url string) (int, string) {
+	t.Helper()
+	return doJSON(t, client, method, url, nil)
+}
+
+// doJSON sends v as the JSON body of the request unless it is nil
+func doJSON(t *testing.T, client *http.Client, method, url string, v interface{}) (int, string) {
+	t.Helper()
+	var body io.Reader
+	if v != nil {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading %s: %v", url, err)
+	}
+	return resp.StatusCode, string(respBody)
+}
+
+// authorize starts the OAuth flow at start and returns the authorization
+// URL it redirects to instead of following it
+func authorize(t *testing.T, client *http.Client, start string) *url.URL {
+	t.Helper()
+	noRedirect := *client
+	noRedirect.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := noRedirect.Get(start)
+	if err != nil {
+		t.Fatalf("GET %s: %v", start, err)
+	}
+	resp.Body.Close()
+	location, err := resp.Location()
+	if err != nil {
+		t.Fatalf("GET %s returned %d without redirect: %v", start, resp.StatusCode, err)
+	}
+	return location
+}
+
+// login follows the OAuth redirects of url through the fake GitHub back to
+// the callback and waits for the generation job, returning the CV page
+func login(t *testing.T, client *http.Client, baseURL, url string) string {
+	t.Helper()
+	status, body := get(t, client, url)
+	if status != http.StatusOK {
+		t.Fatalf("login returned %d: %s", status, body)
+	}
+	return waitForCV(t, client, baseURL, body)
+}
+
+// waitForCV waits for the generation job of the progress page body and
+// returns the CV page
+func waitForCV(t *testing.T, client *http.Client, baseURL, body string) string {
+	t.Helper()
+	if m := jobIDPattern.FindStringSubmatch(body); m != nil {
+		if info := waitForJob(t, client, baseURL, m[1]); info.Status != jobs.StatusDone {
+			t.Fatalf("job finished with status %s: %s", info.Status, info.Error)
+		}
+		var status int
+		status, body = get(t, client, baseURL+"/cv")
+		if status != http.StatusOK {
+			t.Fatalf("CV page returned %d: %s", status, body)
+		}
+	}
+	return body
+}
+
+// waitForJob polls the job API like the progress page until the job is finished
+func waitForJob(t *testing.T, client *http.Client, baseURL, id string) jobs.Info {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		status, body := get(t, client, baseURL+"/api/jobs/"+id)
+		if status != http.StatusOK {
+			t.Fatalf("job status returned %d: %s", status, body)
+		}
+		var info jobs.Info
+		if err := json.Unmarshal([]byte(body), &info); err != nil {
+			t.Fatalf("decoding job: %v", err)
+		}
+		if info.Status != jobs.StatusRunning {
+			return info
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish in time", id)
+	return jobs.Info{}
+}
+
+func TestLoginGenerateAndRender(t *testing.T) {
+	gh := fakegithub.New()
+	gh.ClientID = "test-client"
+	gh.ClientSecret = "test-secret"
+	llm := fakellm.New()
+	llm.APIKey = "test-key"
+	llm.SetDefault(fakellm.Slow(50*time.Millisecond, fakellm.Respond(fakeLLMContent)))
+
+	baseURL := newTestServer(t, gh, llm, nil)
+	client := newTestClient(t)
+
+	body := login(t, client, baseURL, baseURL+"/auth/github?mode=pipeline&length=short")
+
+	for _, want := range []string{"The Octocat", fakeLLMContent, "Generated with"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("CV page does not contain %q", want)
+		}
+	}
+
+	// Every pipeline section is generated from the fixture data
+	reqs := llm.Requests()
+	if len(reqs) != 5 {
+		t.Fatalf("got %d LLM requests, want 5", len(reqs))
+	}
+	prompts := joinPrompts(reqs)
+	for _, want := range []string{"Spoon-Knife", "https://github.com/octocat/Spoon-Knife", "octo-org", "519 (412 commits"} {
+		if !strings.Contains(prompts, want) {
+			t.Errorf("prompts do not mention %q", want)
+		}
+	}
+
+	for _, want := range []string{
+		"GET /login/oauth/authorize",
+		"POST /login/oauth/access_token",
+		"GET /user",
+		"GET /user/repos",
+		"GET /user/orgs",
+		"GET /user/issues",
+		"POST /graphql",
+	} {
+		if !contains(gh.Requests(), want) {
+			t.Errorf("fake GitHub did not receive %s", want)
+		}
+	}
+}
+
+func TestConnectEnterpriseHost(t *testing.T) {
+	gh := fakegithub.New()
+	ghe := fakegithub.New()
+	ghe.Token = "enterprise-token"
+	ghe.SetFixture(fakegithub.FixtureUser, []byte(`{"login": "octocat-corp", "created_at": "2009-05-01T09:00:00Z"}`))
+	ghe.SetFixture(fakegithub.FixtureRepos, []byte(`[{"name": "internal-platform", "language": "Go", "stargazers_count": 3,
+		"html_url": "https://ghe.example.com/platform/internal-platform", "created_at": "2019-01-01T00:00:00Z", "updated_at": "2024-01-01T00:00:00Z"}]`))
+	ghe.SetFixture(fakegithub.FixtureOrgs, []byte(`[{"login": "platform-team", "description": "Internal developer platform"}]`))
+	ghe.SetFixture(fakegithub.FixtureIssues, []byte(`[]`))
+	ghe.SetFixture(fakegithub.FixtureGraphQL, []byte(`{"data": {"viewer": {"contributionsCollection": {
+		"totalCommitContributions": 90, "totalIssueContributions": 10, "contributionCalendar": {"totalContributions": 100}}}}}`))
+
+	// The enterprise host is only trusted through its CA bundle
+	gheServer := httptest.NewTLSServer(ghe)
+	t.Cleanup(gheServer.Close)
+	caFile := filepath.Join(t.TempDir(), "ghe-ca.pem")
+	pemData := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: gheServer.Certificate().Raw})
+	if err := os.WriteFile(caFile, pemData, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	llm := fakellm.New()
+	llm.APIKey = "test-key"
+	baseURL := newTestServer(t, gh, llm, map[string]interface{}{
+		"github.hosts": []map[string]interface{}{{
+			"name":    "enterprise",
+			"web_url": gheServer.URL,
+			"ca_file": caFile,
+		}},
+	})
+	client := newTestClient(t)
+	client.Transport = gheServer.Client().Transport
+
+	body := login(t, client, baseURL, baseURL+"/auth/github?mode=pipeline")
+	if !strings.Contains(body, "host=enterprise&connect=1") {
+		t.Errorf("CV page does not offer to connect the enterprise host")
+	}
+	first := len(llm.Requests())
+
+	body = login(t, client, baseURL, baseURL+"/auth/github?host=enterprise&connect=1")
+	if strings.Contains(body, "connect=1") {
+		t.Errorf("CV page offers to connect a host after all hosts are connected")
+	}
+	if !strings.Contains(body, "The Octocat") {
+		t.Errorf("CV page does not show the primary profile")
+	}
+
+	prompts := joinPrompts(llm.Requests()[first:])
+	for _, want := range []string{"Spoon-Knife", "internal-platform", "platform-team", "619 (502 commits"} {
+		if !strings.Contains(prompts, want) {
+			t.Errorf("prompts do not mention %q", want)
+		}
+	}
+	for _, want := range []string{"GET /api/v3/user", "GET /api/v3/user/repos", "POST /api/graphql"} {
+		if !contains(ghe.Requests(), want) {
+			t.Errorf("fake GitHub Enterprise did not receive %s", want)
+		}
+	}
+}
+
+func TestGitHubAppPrivateRepositories(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "app.pem")
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	gh := fakegithub.New()
+	gh.AppID = 1234
+	gh.AppKey = &key.PublicKey
+	// Tokens about to expire are refreshed before collecting
+	gh.TokenLifetime = 30 * time.Second
+	llm := fakellm.New()
+
+	baseURL := newTestServer(t, gh, llm, map[string]interface{}{
+		"github.app_id":           1234,
+		"github.private_key_file": keyFile,
+	})
+	client := newTestClient(t)
+
+	body := login(t, client, baseURL, baseURL+"/auth/github?mode=template")
+	if strings.Contains(body, "octo-secret-tool") {
+		t.Error("CV includes installation repositories without opting in")
+	}
+	if contains(gh.Requests(), "GET /user/installations") {
+		t.Error("installations were looked up without opting in")
+	}
+
+	// The repositories of the installation are offered on the preview page
+	body = login(t, client, baseURL, baseURL+"/auth/github?mode=template&private=1")
+	if !strings.Contains(body, `value="https://github.com/octocat/octo-secret-tool" checked`) {
+		t.Fatal("preview does not offer the repository granted to the installation")
+	}
+	status, body := post(t, client, baseURL+"/preview", url.Values{
+		"policy": {"selected"},
+		"repo":   {"https://github.com/octocat/octo-secret-tool"},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("generating from the preview returned %d: %s", status, body)
+	}
+	body = waitForCV(t, client, baseURL, body)
+	if !strings.Contains(body, "octo-secret-tool") {
+		t.Error("CV does not include the repository granted to the installation")
+	}
+
+	tokenRequests := 0
+	for _, req := range gh.Requests() {
+		if req == "POST /login/oauth/access_token" {
+			tokenRequests++
+		}
+	}
+	if tokenRequests != 4 {
+		t.Errorf("got %d token requests, want 2 code exchanges and 2 tokenRequests", tokenRequests)
+	}
+	for _, want := range []string{
+		"GET /user/installations",
+		fmt.Sprintf("POST /app/installations/%d/access_tokens", fakegithub.DefaultInstallationID),
+		"GET /installation/repositories",
+	} {
+		if !contains(gh.Requests(), want) {
+			t.Errorf("fake GitHub did not receive %s", want)
+		}
+	}
+
+	// Installations from the query must be accessible to the user
+	for id, want := range map[int64]int{fakegithub.DefaultInstallationID: http.StatusOK, 999: http.StatusForbidden} {
+		attacker := newTestClient(t)
+		state := authorize(t, attacker, baseURL+"/auth/github?mode=template&private=1").Query().Get("state")
+		status, _ := get(t, attacker, fmt.Sprintf("%s/auth/github/callback?code=%s&state=%s&installation_id=%d", baseURL, fakegithub.DefaultCode, state, id))
+		if status != want {
+			t.Errorf("callback with installation %d returned %d, want %d", id, status, want)
+		}
+	}
+}
+
+func TestPrivateRepositoryPolicy(t *testing.T) {
+	gh := fakegithub.New()
+	gh.ClientID = "test-client"
+	gh.ClientSecret = "test-secret"
+	llm := fakellm.New()
+	llm.APIKey = "test-key"
+
+	// Anonymized private repositories only add their language to the statistics
+	var repos []map[string]any
+	if err := json.Unmarshal(gh.Fixture(fakegithub.FixtureRepos), &repos); err != nil {
+		t.Fatal(err)
+	}
+	for _, repo := range repos {
+		if repo["private"] == true {
+			repo["language"] = "Haskell"
+		}
+	}
+	fixture, _ := json.Marshal(repos)
+	gh.SetFixture(fakegithub.FixtureRepos, fixture)
+
+	baseURL := newTestServer(t, gh, llm, nil)
+	client := newTestClient(t)
+
+	// Without opting in, private repositories never reach the LLM
+	login(t, client, baseURL, baseURL+"/auth/github?mode=pipeline")
+	if prompts := joinPrompts(llm.Requests()); strings.Contains(prompts, "boysenberry-repo-1") {
+		t.Error("prompts include a private repository without opting in")
+	}
+	sent := len(llm.Requests())
+
+	// Opting in shows the prompts with every private repository selected
+	body := login(t, client, baseURL, baseURL+"/auth/github?mode=pipeline&private=1")
+	if !strings.Contains(body, "Review what is sent") || !strings.Contains(body, "- boysenberry-repo-1: Testing (Language") {
+		t.Fatal("preview does not show the prompts with the selected private repository")
+	}
+
+	// Other policies can be previewed before generating
+	_, body = get(t, client, baseURL+"/preview?policy=anonymized")
+	if !strings.Contains(body, "- Private repositories by language: Haskell (1)") || strings.Contains(body, "boysenberry-repo-1:") {
+		t.Error("anonymized preview does not reduce the private repository to its language")
+	}
+	if n := len(llm.Requests()); n != sent {
+		t.Fatalf("got %d LLM requests before generating from the preview, want %d", n, sent)
+	}
+
+	status, body := post(t, client, baseURL+"/preview", url.Values{"policy": {"anonymized"}})
+	if status != http.StatusOK {
+		t.Fatalf("generating from the preview returned %d: %s", status, body)
+	}
+	waitForCV(t, client, baseURL, body)
+
+	prompts := joinPrompts(llm.Requests()[sent:])
+	if strings.Contains(prompts, "boysenberry") || !strings.Contains(prompts, "Private repositories by language: Haskell (1)") {
+		t.Error("prompts do not follow the anonymized policy")
+	}
+}
+
+func TestRedactPersonalIdentifiers(t *testing.T) {
+	gh := fakegithub.New()
+	llm := fakellm.New()
+	llm.APIKey = "test-key"
+	llm.SetDefault(fakellm.Respond("[NAME] is based in [LOCATION] and writes at [BLOG]."))
+
+	baseURL := newTestServer(t, gh, llm, map[string]interface{}{
+		"redaction.fields": []string{"name", "email", "location", "blog"},
+	})
+	client := newTestClient(t)
+
+	body := login(t, client, baseURL, baseURL+"/auth/github?mode=single&redact=1")
+	if !strings.Contains(body, "The Octocat is based in San Francisco and writes at https://github.blog.") {
+		t.Error("CV page does not restore the personal identifiers")
+	}
+
+	prompts := joinPrompts(llm.Requests())
+	for _, secret := range []string{"The Octocat", "San Francisco", "https://github.blog"} {
+		if strings.Contains(prompts, secret) {
+			t.Errorf("prompt contains %q", secret)
+		}
+	}
+	for _, want := range []string{"Name: [NAME]", "Location: [LOCATION]", "Twitter: github"} {
+		if !strings.Contains(prompts, want) {
+			t.Errorf("prompt does not contain %q", want)
+		}
+	}
+}
+
+func TestCVVersionHistory(t *testing.T) {
+	gh := fakegithub.New()
+	llm := fakellm.New()
+	llm.APIKey = "test-key"
+	llm.SetDefault(fakellm.Respond(fakeLLMContent))
+
+	baseURL := newTestServer(t, gh, llm, nil)
+	client := newTestClient(t)
+	login(t, client, baseURL, baseURL+"/auth/github?mode=pipeline")
+
+	llm.SetDefault(fakellm.Respond("A rewritten summary."))
+	if status, body := post(t, client, baseURL+"/cv/sections/summary", nil); status != http.StatusOK {
+		t.Fatalf("regenerating section returned %d: %s", status, body)
+	}
+
+	status, body := get(t, client, baseURL+"/api/cvs")
+	if status != http.StatusOK {
+		t.Fatalf("listing versions returned %d: %s", status, body)
+	}
+	var versions []storage.Version
+	if err := json.Unmarshal([]byte(body), &versions); err != nil {
+		t.Fatalf("decoding versions: %v", err)
+	}
+	if len(versions) != 2 || versions[0].Source != storage.SourceSection || versions[1].Source != storage.SourceGenerated {
+		t.Fatalf("got versions %+v, want a section and a generated version", versions)
+	}
+	if versions[0].User != "github/octocat" || versions[0].CV != nil || versions[0].PromptVersion != services.PromptVersion {
+		t.Errorf("unexpected version summary %+v", versions[0])
+	}
+	newest, oldest := versions[0].ID, versions[1].ID
+
+	status, body = get(t, client, baseURL+"/api/cvs/"+oldest)
+	var version storage.Version
+	if status != http.StatusOK || json.Unmarshal([]byte(body), &version) != nil {
+		t.Fatalf("getting version returned %d: %s", status, body)
+	}
+	if version.Data == nil || version.Data.Profile.Login != "octocat" || !strings.Contains(version.CV.Markdown(), fakeLLMContent) {
+		t.Errorf("version does not keep the CV and its data: %+v", version)
+	}
+
+	status, body = get(t, client, baseURL+"/api/cvs/"+oldest+"/diff/"+newest)
+	if status != http.StatusOK {
+		t.Fatalf("diff returned %d: %s", status, body)
+	}
+	for _, want := range []string{`{"op":"-","text":"` + fakeLLMContent + `"}`, `{"op":"+","text":"A rewritten summary."}`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("diff does not contain %s: %s", want, body)
+		}
+	}
+	if status, body := get(t, client, baseURL+"/history?from="+oldest+"&to="+newest); status != http.StatusOK || !strings.Contains(body, "Changes from #1 to #2") {
+		t.Errorf("history page returned %d without the diff", status)
+	}
+
+	// Versions are only visible to their owner
+	if status, _ := get(t, newTestClient(t), baseURL+"/api/cvs/"+oldest); status != http.StatusUnauthorized {
+		t.Errorf("anonymous client got status %d, want %d", status, http.StatusUnauthorized)
+	}
+
+	if status, body := do(t, client, http.MethodDelete, baseURL+"/api/cvs/"+oldest); status != http.StatusNoContent {
+		t.Fatalf("deleting version returned %d: %s", status, body)
+	}
+	if status, _ := get(t, client, baseURL+"/api/cvs/"+oldest); status != http.StatusNotFound {
+		t.Errorf("deleted version returned %d, want %d", status, http.StatusNotFound)
+	}
+}
+
+func TestEditCV(t *testing.T) {
+	gh := fakegithub.New()
+	llm := fakellm.New()
+	llm.APIKey = "test-key"
+	llm.SetDefault(fakellm.Respond(fakeLLMContent))
+
+	baseURL := newTestServer(t, gh, llm, nil)
+	client := newTestClient(t)
+	login(t, client, baseURL, baseURL+"/auth/github?mode=pipeline")
+
+	status, body := get(t, client, baseURL+"/cv/edit")
+	if status != http.StatusOK || !strings.Contains(body, "## Professional Summary") {
+		t.Fatalf("editor returned %d without the markdown", status)
+	}
+	editor := body[strings.Index(body, `id="editor"`):]
+	markdown := html.UnescapeString(editor[strings.Index(editor, ">")+1 : strings.Index(editor, "</textarea>")])
+	edited := strings.Replace(markdown, fakeLLMContent, "Maintainer of the Octocat toolbox.", 1)
+
+	status, body = doJSON(t, client, http.MethodPost, baseURL+"/api/cvs", map[string]string{"markdown": edited})
+	if status != http.StatusCreated {
+		t.Fatalf("saving the CV returned %d: %s", status, body)
+	}
+	var saved struct {
+		ID string    `json:"id"`
+		CV models.CV `json:"cv"`
+	}
+	if err := json.Unmarshal([]byte(body), &saved); err != nil {
+		t.Fatal(err)
+	}
+	summary := saved.CV.Section("summary")
+	if saved.ID == "" || summary == nil || !summary.Edited || summary.Content != "Maintainer of the Octocat toolbox." {
+		t.Errorf("edited summary not saved: %+v", saved)
+	}
+	for _, name := range []string{"header", "skills"} {
+		if section := saved.CV.Section(name); section == nil || section.Edited {
+			t.Errorf("unchanged section %s marked as edited: %+v", name, section)
+		}
+	}
+
+	// The page and the exports show the edited CV
+	for _, path := range []string{"/cv", "/cv/markdown"} {
+		if _, body := get(t, client, baseURL+path); !strings.Contains(body, "Maintainer of the Octocat toolbox.") {
+			t.Errorf("%s does not show the edited CV", path)
+		}
+	}
+
+	_, body = get(t, client, baseURL+"/api/cvs")
+	var versions []storage.Version
+	if err := json.Unmarshal([]byte(body), &versions); err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 || versions[0].ID != saved.ID || versions[0].Source != storage.SourceEdited {
+		t.Errorf("got versions %+v, want the edited version first", versions)
+	}
+
+	if status, _ := doJSON(t, client, http.MethodPost, baseURL+"/api/cvs", map[string]string{"markdown": " "}); status != http.StatusBadRequest {
+		t.Errorf("saving an empty CV returned %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+func TestPublishCV(t *testing.T) {
+	gh := fakegithub.New()
+	llm := fakellm.New()
+	llm.APIKey = "test-key"
+	llm.SetDefault(fakellm.Respond(fakeLLMContent))
+
+	baseURL := newTestServer(t, gh, llm, nil)
+	client := newTestClient(t)
+	visitor := newTestClient(t)
+	login(t, client, baseURL, baseURL+"/auth/github?mode=pipeline")
+
+	status, body := post(t, client, baseURL+"/publish", url.Values{"slug": {"Octo-CV"}, "visibility": {"public"}, "expires": {"30"}})
+	if status != http.StatusOK || !strings.Contains(body, baseURL+"/u/octo-cv") {
+		t.Fatalf("publishing returned %d without the address", status)
+	}
+
+	resp, err := visitor.Get(baseURL + "/u/octo-cv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Cache-Control") != "no-store" {
+		t.Errorf("public CV returned %d with Cache-Control %q", resp.StatusCode, resp.Header.Get("Cache-Control"))
+	}
+	_, body = get(t, visitor, baseURL+"/u/octo-cv")
+	for _, want := range []string{fakeLLMContent, `<meta property="og:title" content="The Octocat - Developer CV">`, `<meta property="og:description" content="` + fakeLLMContent} {
+		if !strings.Contains(body, want) {
+			t.Errorf("public CV does not contain %q", want)
+		}
+	}
+	if _, body := get(t, client, baseURL+"/cv"); !strings.Contains(body, "viewed 2 times") {
+		t.Error("CV page does not show the view count")
+	}
+
+	// Unlisted CVs need the key of their link
+	_, body = post(t, client, baseURL+"/publish", url.Values{"slug": {"octo-cv"}, "visibility": {"unlisted"}})
+	m := regexp.MustCompile(`/u/octo-cv\?key=([0-9a-f]+)`).FindStringSubmatch(body)
+	if m == nil {
+		t.Fatal("CV page does not show the unlisted link")
+	}
+	if status, _ := get(t, visitor, baseURL+"/u/octo-cv"); status != http.StatusNotFound {
+		t.Errorf("unlisted CV without key returned %d, want %d", status, http.StatusNotFound)
+	}
+	if status, body := get(t, visitor, baseURL+"/u/octo-cv?key="+m[1]); status != http.StatusOK || !strings.Contains(body, fakeLLMContent) {
+		t.Errorf("unlisted CV with key returned %d", status)
+	}
+
+	// Password protected CVs are shown after posting the password
+	post(t, client, baseURL+"/publish", url.Values{"slug": {"octo-cv"}, "visibility": {"password"}, "password": {"hunter2"}})
+	if status, body := get(t, visitor, baseURL+"/u/octo-cv"); status != http.StatusOK || strings.Contains(body, fakeLLMContent) {
+		t.Errorf("password protected CV returned %d, showing the CV: %v", status, strings.Contains(body, fakeLLMContent))
+	}
+	if status, _ := post(t, visitor, baseURL+"/u/octo-cv", url.Values{"password": {"wrong"}}); status != http.StatusUnauthorized {
+		t.Errorf("wrong password returned %d, want %d", status, http.StatusUnauthorized)
+	}
+	if status, body := post(t, visitor, baseURL+"/u/octo-cv", url.Values{"password": {"hunter2"}}); status != http.StatusOK || !strings.Contains(body, fakeLLMContent) {
+		t.Errorf("right password returned %d", status)
+	}
+
+	if status, _ := post(t, client, baseURL+"/unpublish", nil); status != http.StatusOK {
+		t.Fatalf("unpublishing returned %d", status)
+	}
+	if status, _ := post(t, visitor, baseURL+"/u/octo-cv", url.Values{"password": {"hunter2"}}); status != http.StatusNotFound {
+		t.Errorf("unpublished CV returned %d, want %d", status, http.StatusNotFound)
+	}
+
+	if status, _ := post(t, client, baseURL+"/publish", url.Values{"slug": {"not a slug"}}); status != http.StatusBadRequest {
+		t.Errorf("invalid slug returned %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+func TestPortfolioSite(t *testing.T) {
+	gh := fakegithub.New()
+	llm := fakellm.New()
+	llm.APIKey = "test-key"
+	llm.SetDefault(fakellm.Respond(fakeLLMContent))
+
+	baseURL := newTestServer(t, gh, llm, nil)
+	client := newTestClient(t)
+	login(t, client, baseURL, baseURL+"/auth/github?mode=pipeline")
+
+	resp, err := client.Get(baseURL + "/cv/site.zip?theme=dark")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/zip" {
+		t.Fatalf("site returned %d %s: %s", resp.StatusCode, resp.Header.Get("Content-Type"), body)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(content)
+	}
+
+	if !strings.Contains(files["index.html"], fakeLLMContent) {
+		t.Error("index does not contain the CV summary")
+	}
+	if !strings.Contains(files["projects/hello-world.html"], "<strong>bold</strong> ideas") {
+		t.Error("project page does not render the README")
+	}
+	if !strings.Contains(files["projects/git-consortium.html"], "This repo is for demonstration purposes only.") {
+		t.Error("project page without README does not fall back to the description")
+	}
+	if _, ok := files["projects/boysenberry-repo-1.html"]; ok {
+		t.Error("site publishes a private repository")
+	}
+	if !contains(gh.Requests(), "GET /repos/octocat/Hello-World/readme") {
+		t.Error("README was not fetched from GitHub")
+	}
+
+	if status, _ := get(t, client, baseURL+"/cv/site.zip?theme=neon"); status != http.StatusBadRequest {
+		t.Errorf("unknown theme returned %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+func TestCVThemes(t *testing.T) {
+	gh := fakegithub.New()
+	llm := fakellm.New()
+	llm.APIKey = "test-key"
+	llm.SetDefault(fakellm.Respond(fakeLLMContent))
+
+	baseURL := newTestServer(t, gh, llm, map[string]interface{}{
+		"pdf.command": []string{"cp", "{input}", "{output}"},
+	})
+	client := newTestClient(t)
+	visitor := newTestClient(t)
+	body := login(t, client, baseURL, baseURL+"/auth/github?mode=pipeline")
+	if !strings.Contains(body, `class="cv cv-classic"`) || !strings.Contains(body, "Modern two-column") {
+		t.Error("CV page is not rendered with the default theme and picker")
+	}
+
+	status, body := get(t, client, baseURL+"/cv/print?theme=modern")
+	for _, want := range []string{`class="cv cv-modern"`, "<aside>", fakeLLMContent, "window.print()"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("print view returned %d without %q", status, want)
+		}
+	}
+
+	if status, _ := post(t, client, baseURL+"/cv/theme", url.Values{"theme": {"neon"}}); status != http.StatusBadRequest {
+		t.Errorf("unknown theme returned %d, want %d", status, http.StatusBadRequest)
+	}
+	if _, body := post(t, client, baseURL+"/cv/theme", url.Values{"theme": {"minimal"}}); !strings.Contains(body, `class="cv cv-minimal"`) {
+		t.Error("CV page does not use the chosen theme")
+	}
+
+	resp, err := client.Get(baseURL + "/cv/pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pdf, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/pdf" ||
+		!strings.Contains(resp.Header.Get("Content-Disposition"), "octocat-cv.pdf") {
+		t.Errorf("PDF export returned %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if !strings.Contains(string(pdf), `class="cv cv-minimal"`) {
+		t.Error("PDF export does not use the chosen theme")
+	}
+
+	// Published CVs keep the theme chosen when publishing
+	post(t, client, baseURL+"/publish", url.Values{"slug": {"octocat"}, "visibility": {"public"}})
+	if _, body := get(t, visitor, baseURL+"/u/octocat"); !strings.Contains(body, `class="cv cv-minimal"`) || !strings.Contains(body, ".cv-minimal") {
+		t.Error("public CV does not use the theme chosen when publishing")
+	}
+}
+
+func TestATSExport(t *testing.T) {
+	gh := fakegithub.New()
+	llm := fakellm.New()
+	llm.APIKey = "test-key"
+	llm.SetDefault(fakellm.Respond(fakeLLMContent))
+
+	baseURL := newTestServer(t, gh, llm, nil)
+	client := newTestClient(t)
+	login(t, client, baseURL, baseURL+"/auth/github?mode=pipeline")
+
+	resp, err := client.Get(baseURL + "/cv/ats.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") {
+		t.Fatalf("plain-text export returned %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	for _, want := range []string{"\nSUMMARY\n", "\nSKILLS\n", "\nOPEN SOURCE CONTRIBUTIONS\n", fakeLLMContent} {
+		if !strings.Contains(string(text), want) {
+			t.Errorf("plain-text export does not contain %q", want)
+		}
+	}
+	if strings.Contains(string(text), "##") {
+		t.Error("plain-text export contains markdown headings")
+	}
+
+	status, body := get(t, client, baseURL+"/cv/ats?keywords=Ruby,+Kubernetes")
+	for _, want := range []string{"parse-ability", "Keywords not found in the CV: Ruby, Kubernetes.", "Contact information is missing: email, phone."} {
+		if !strings.Contains(body, want) {
+			t.Errorf("ATS report returned %d without %q", status, want)
+		}
+	}
+}
+
+func TestFeedbackRevision(t *testing.T) {
+	gh := fakegithub.New()
+	llm := fakellm.New()
+	llm.APIKey = "test-key"
+	llm.SetDefault(fakellm.Respond(fakeLLMContent))
+
+	baseURL := newTestServer(t, gh, llm, map[string]interface{}{"admin.token": "secret"})
+	client := newTestClient(t)
+	login(t, client, baseURL, baseURL+"/auth/github?mode=pipeline")
+
+	if status, body := doJSON(t, client, http.MethodPost, baseURL+"/api/feedback", map[string]string{"comment": "Too generic"}); status != http.StatusCreated {
+		t.Fatalf("feedback returned %d: %s", status, body)
+	}
+	if _, body := get(t, client, baseURL+"/cv"); !strings.Contains(body, "Too generic") {
+		t.Error("CV page does not show the feedback on the version")
+	}
+
+	_, markdown := get(t, client, baseURL+"/cv/markdown")
+	revised := strings.Replace(markdown, fakeLLMContent, "Go developer building command-line tools.", 1)
+	llm.Enqueue(fakellm.Respond("```markdown\n" + revised + "```"))
+	status, body := doJSON(t, client, http.MethodPost, baseURL+"/cv/revise", map[string]string{"feedback": "Mention that I write Go"})
+	if status != http.StatusOK {
+		t.Fatalf("revision returned %d: %s", status, body)
+	}
+	requests := llm.Requests()
+	prompt := requests[len(requests)-1].Messages[0].Content
+	if !strings.Contains(prompt, "Mention that I write Go") || !strings.Contains(prompt, "## Professional Summary\n\n"+fakeLLMContent) {
+		t.Errorf("revision prompt does not contain the feedback and previous CV:\n%s", prompt)
+	}
+	if _, body := get(t, client, baseURL+"/cv/markdown"); body != revised {
+		t.Errorf("got revised CV\n%s\nwant\n%s", body, revised)
+	}
+
+	var list []storage.Version
+	_, body = get(t, client, baseURL+"/api/cvs")
+	if err := json.Unmarshal([]byte(body), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Source != storage.SourceRevised {
+		t.Errorf("got versions %+v, want a revised version", list)
+	}
+	_, body = get(t, client, baseURL+"/api/cvs/"+list[1].ID+"/feedback")
+	if !strings.Contains(body, "Too generic") || !strings.Contains(body, "Mention that I write Go") {
+		t.Errorf("feedback of the previous version: %s", body)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, baseURL+"/admin/feedback", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var summary storage.FeedbackSummary
+	if err := json.NewDecoder(resp.Body).Decode(&summary); err != nil {
+		t.Fatal(err)
+	}
+	if summary.Total != 2 || summary.Revisions != 1 || summary.ByMode["pipeline"] != 2 {
+		t.Errorf("got feedback summary %+v", summary)
+	}
+
+	// An edit saved while a revision is pending wins over the revision
+	_, markdown = get(t, client, baseURL+"/cv/markdown")
+	edited := strings.Replace(markdown, "Go developer building command-line tools.", "Maintainer of the Octocat toolbox.", 1)
+	llm.Enqueue(fakellm.Slow(300*time.Millisecond, fakellm.Respond("```markdown\n"+markdown+"\nRevised.\n```")))
+	sent := len(llm.Requests())
+	statuses := make(chan int, 1)
+	go func() {
+		status, _ := doJSON(t, client, http.MethodPost, baseURL+"/cv/revise", map[string]string{"feedback": "Add a line"})
+		statuses <- status
+	}()
+	for len(llm.Requests()) == sent {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if status, body := doJSON(t, client, http.MethodPost, baseURL+"/api/cvs", map[string]string{"markdown": edited}); status != http.StatusCreated {
+		t.Fatalf("saving the CV returned %d: %s", status, body)
+	}
+	if status := <-statuses; status != http.StatusConflict {
+		t.Errorf("revision of a CV changed in the meantime returned %d, want %d", status, http.StatusConflict)
+	}
+	if _, body := get(t, client, baseURL+"/cv/markdown"); !strings.Contains(body, "Maintainer of the Octocat toolbox.") || strings.Contains(body, "Revised.") {
+		t.Errorf("got CV\n%s", body)
+	}
+}
+
+func TestRefinementChat(t *testing.T) {
+	gh := fakegithub.New()
+	llm := fakellm.New()
+	llm.APIKey = "test-key"
+	llm.SetDefault(fakellm.Respond(fakeLLMContent))
+
+	baseURL := newTestServer(t, gh, llm, nil)
+	client := newTestClient(t)
+	login(t, client, baseURL, baseURL+"/auth/github?mode=pipeline")
+
+	_, original := get(t, client, baseURL+"/cv/markdown")
+	shorter := strings.Replace(original, fakeLLMContent, "Open source developer.", 1)
+	withGo := strings.Replace(shorter, "Open source developer.", "Open source Go developer.", 1)
+
+	llm.Enqueue(fakellm.Respond(shorter))
+	if status, body := doJSON(t, client, http.MethodPost, baseURL+"/api/chat", map[string]string{"instruction": "shorten the summary"}); status != http.StatusOK {
+		t.Fatalf("first turn returned %d: %s", status, body)
+	}
+	llm.Enqueue(fakellm.Respond(withGo))
+	if status, body := doJSON(t, client, http.MethodPost, baseURL+"/api/chat", map[string]string{"instruction": "mention Go"}); status != http.StatusOK {
+		t.Fatalf("second turn returned %d: %s", status, body)
+	}
+
+	requests := llm.Requests()
+	messages := requests[len(requests)-1].Messages
+	var roles []string
+	for _, m := range messages {
+		roles = append(roles, m.Role)
+	}
+	if strings.Join(roles, ",") != "system,user,assistant,user" {
+		t.Fatalf("got conversation roles %v", roles)
+	}
+	if !strings.Contains(messages[1].Content, original) || !strings.HasSuffix(messages[1].Content, "shorten the summary") ||
+		messages[2].Content != shorter || messages[3].Content != "mention Go" {
+		t.Errorf("got conversation %+v", messages)
+	}
+	if _, body := get(t, client, baseURL+"/cv/markdown"); body != withGo {
+		t.Errorf("got CV\n%s\nwant\n%s", body, withGo)
+	}
+	var list []storage.Version
+	_, body := get(t, client, baseURL+"/api/cvs")
+	if err := json.Unmarshal([]byte(body), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 || list[0].Source != storage.SourceChat || list[1].Source != storage.SourceChat {
+		t.Errorf("got versions %+v, want a version per turn", list)
+	}
+
+	if status, body := do(t, client, http.MethodPost, baseURL+"/api/chat/undo"); status != http.StatusOK {
+		t.Fatalf("undo returned %d: %s", status, body)
+	}
+	if _, body := get(t, client, baseURL+"/cv/markdown"); body != shorter {
+		t.Errorf("undo restored\n%s\nwant\n%s", body, shorter)
+	}
+	_, body = get(t, client, baseURL+"/cv/chat")
+	if !strings.Contains(body, "shorten the summary") || strings.Contains(body, "mention Go") {
+		t.Error("chat page does not show the remaining turns")
+	}
+
+	// Undo does not throw away changes made outside the chat
+	if status, _ := doJSON(t, client, http.MethodPost, baseURL+"/api/cvs", map[string]string{"markdown": shorter + "\nEdited.\n"}); status != http.StatusCreated {
+		t.Fatalf("edit returned %d", status)
+	}
+	if status, _ := do(t, client, http.MethodPost, baseURL+"/api/chat/undo"); status != http.StatusConflict {
+		t.Errorf("undo after an edit returned %d, want %d", status, http.StatusConflict)
+	}
+}
+
+func TestRefinementChatConflictsAndErrors(t *testing.T) {
+	gh := fakegithub.New()
+	llm := fakellm.New()
+	llm.APIKey = "test-key"
+	llm.SetDefault(fakellm.Respond(fakeLLMContent))
+
+	baseURL := newTestServer(t, gh, llm, nil)
+	client := newTestClient(t)
+	login(t, client, baseURL, baseURL+"/auth/github?mode=pipeline")
+	_, original := get(t, client, baseURL+"/cv/markdown")
+
+	// A section regenerated while a turn is pending wins over the turn
+	llm.Enqueue(fakellm.Slow(300*time.Millisecond, fakellm.Respond(original+"\nRefined.\n")))
+	llm.Enqueue(fakellm.Respond("A rewritten summary."))
+	sent := len(llm.Requests())
+	statuses := make(chan int, 1)
+	go func() {
+		status, _ := doJSON(t, client, http.MethodPost, baseURL+"/api/chat", map[string]string{"instruction": "add a line"})
+		statuses <- status
+	}()
+	for len(llm.Requests()) == sent {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if status, body := post(t, client, baseURL+"/cv/sections/summary", nil); status != http.StatusOK {
+		t.Fatalf("regenerating section returned %d: %s", status, body)
+	}
+	if status := <-statuses; status != http.StatusConflict {
+		t.Errorf("turn on a CV changed in the meantime returned %d, want %d", status, http.StatusConflict)
+	}
+	if _, body := get(t, client, baseURL+"/cv/markdown"); !strings.Contains(body, "A rewritten summary.") || strings.Contains(body, "Refined.") {
+		t.Errorf("got CV\n%s", body)
+	}
+
+	// Failures of the model are reported as such
+	llm.Enqueue(fakellm.Fail(http.StatusBadRequest))
+	if status, body := doJSON(t, client, http.MethodPost, baseURL+"/api/chat", map[string]string{"instruction": "add a line"}); status != http.StatusBadGateway {
+		t.Errorf("failed turn returned %d, want %d: %s", status, http.StatusBadGateway, body)
+	}
+}
+
+func TestSectionRegenerationConflicts(t *testing.T) {
+	gh := fakegithub.New()
+	llm := fakellm.New()
+	llm.APIKey = "test-key"
+	llm.SetDefault(fakellm.Respond(fakeLLMContent))
+
+	baseURL := newTestServer(t, gh, llm, nil)
+	client := newTestClient(t)
+	login(t, client, baseURL, baseURL+"/auth/github?mode=pipeline")
+	_, markdown := get(t, client, baseURL+"/cv/markdown")
+	edited := strings.Replace(markdown, fakeLLMContent, "Maintainer of the Octocat toolbox.", 1)
+
+	// An edit saved while a section is regenerated wins over the section
+	llm.Enqueue(fakellm.Slow(300*time.Millisecond, fakellm.Respond("A rewritten summary.")))
+	sent := len(llm.Requests())
+	statuses := make(chan int, 1)
+	go func() {
+		status, _ := post(t, client, baseURL+"/cv/sections/summary", nil)
+		statuses <- status
+	}()
+	for len(llm.Requests()) == sent {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if status, body := doJSON(t, client, http.MethodPost, baseURL+"/api/cvs", map[string]string{"markdown": edited}); status != http.StatusCreated {
+		t.Fatalf("saving the CV returned %d: %s", status, body)
+	}
+	if status := <-statuses; status != http.StatusConflict {
+		t.Errorf("section of a CV changed in the meantime returned %d, want %d", status, http.StatusConflict)
+	}
+	if _, body := get(t, client, baseURL+"/cv/markdown"); body != edited {
+		t.Errorf("got CV\n%s\nwant\n%s", body, edited)
+	}
+}
+
+func TestLoginOverBudgetKeepsCV(t *testing.T) {
+	gh := fakegithub.New()
+	llm := fakellm.New()
+	llm.APIKey = "test-key"
+	expensive := fakellm.Respond(fakeLLMContent)
+	expensive.PromptTokens = 1000000
+	llm.SetDefault(expensive)
+
+	baseURL := newTestServer(t, gh, llm, map[string]interface{}{
+		"llm.pricing":               []map[string]interface{}{{"model": "atoma/fake-model", "prompt_per_million": 1.0}},
+		"llm.budget.user_daily_usd": 0.5,
+	})
+	client := newTestClient(t)
+	login(t, client, baseURL, baseURL+"/auth/github?mode=pipeline")
+	_, original := get(t, client, baseURL+"/cv/markdown")
+
+	if status, body := get(t, client, baseURL+"/auth/github?mode=pipeline"); status != http.StatusTooManyRequests {
+		t.Fatalf("login over budget returned %d: %s", status, body)
+	}
+	if status, body := get(t, client, baseURL+"/cv/markdown"); status != http.StatusOK || body != original {
+		t.Errorf("refused login changed the CV: %d\n%s", status, body)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	gh := fakegithub.New()
+	llm := fakellm.New()
+
+	baseURL := newTestServer(t, gh, llm, nil)
+	client := newTestClient(t)
+	login(t, client, baseURL, baseURL+"/auth/github?mode=template")
+
+	if status, body := post(t, client, baseURL+"/logout", nil); status != http.StatusOK || !strings.Contains(body, "/auth/github") {
+		t.Fatalf("logout returned %d: %s", status, body)
+	}
+	if status, _ := get(t, client, baseURL+"/api/cvs"); status != http.StatusUnauthorized {
+		t.Errorf("listing versions after logout returned %d, want %d", status, http.StatusUnauthorized)
+	}
+	if _, body := get(t, client, baseURL+"/cv/markdown"); strings.Contains(body, "## ") {
+		t.Error("CV still available after logout")
+	}
+}
+
+func TestIdleSessions(t *testing.T) {
+	gh := fakegithub.New()
+	llm := fakellm.New()
+
+	baseURL := newTestServer(t, gh, llm, map[string]interface{}{
+		"server.session_idle_timeout": "500ms",
+	})
+	client := newTestClient(t)
+	login(t, client, baseURL, baseURL+"/auth/github?mode=template")
+	if status, body := get(t, client, baseURL+"/api/cvs"); status != http.StatusOK {
+		t.Fatalf("listing versions returned %d: %s", status, body)
+	}
+
+	time.Sleep(700 * time.Millisecond)
+	if status, _ := get(t, client, baseURL+"/api/cvs"); status != http.StatusUnauthorized {
+		t.Errorf("listing versions of an idle session returned %d, want %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestOAuthStateAndSessionFixation(t *testing.T) {
+	gh := fakegithub.New()
+	llm := fakellm.New()
+
+	baseURL := newTestServer(t, gh, llm, nil)
+	base, _ := url.Parse(baseURL)
+	callback := fmt.Sprintf("%s/auth/github/callback?code=%s", baseURL, fakegithub.DefaultCode)
+
+	// A callback without a flow started in the session, e.g. a link with
+	// the code of an attacker, is rejected
+	victim := newTestClient(t)
+	if status, _ := get(t, victim, callback); status != http.StatusBadRequest {
+		t.Errorf("callback without a flow returned %d, want %d", status, http.StatusBadRequest)
+	}
+
+	state := authorize(t, victim, baseURL+"/auth/github?mode=template").Query().Get("state")
+	if state == "" {
+		t.Fatal("authorization URL has no state")
+	}
+	planted := victim.Jar.Cookies(base)
+	if status, _ := get(t, victim, callback+"&state=forged"); status != http.StatusBadRequest {
+		t.Errorf("callback with a forged state returned %d, want %d", status, http.StatusBadRequest)
+	}
+	// The state is used up by the rejected callback
+	if status, _ := get(t, victim, callback+"&state="+state); status != http.StatusBadRequest {
+		t.Errorf("callback with a used state returned %d, want %d", status, http.StatusBadRequest)
+	}
+
+	// Signing in issues a new session ID, so the one known before is useless
+	login(t, victim, baseURL, baseURL+"/auth/github?mode=template")
+	if cookies := victim.Jar.Cookies(base); len(cookies) != 1 || len(planted) != 1 || cookies[0].Value == planted[0].Value {
+		t.Fatalf("session ID not renewed on sign-in: %v before, %v after", planted, cookies)
+	}
+	attacker := newTestClient(t)
+	attacker.Jar.SetCookies(base, planted)
+	if status, _ := get(t, attacker, baseURL+"/api/cvs"); status != http.StatusUnauthorized {
+		t.Errorf("session ID from before sign-in returned %d, want %d", status, http.StatusUnauthorized)
+	}
+	if status, body := get(t, victim, baseURL+"/api/cvs"); status != http.StatusOK {
+		t.Errorf("listing versions with the renewed session returned %d: %s", status, body)
+	}
+}
+
+func TestLoginRejectedCredentials(t *testing.T) {
+	gh := fakegithub.New()
+	gh.ClientID = "test-client"
+	gh.ClientSecret = "other-secret"
+	llm := fakellm.New()
+
+	baseURL := newTestServer(t, gh, llm, nil)
+	client := newTestClient(t)
+
+	status, _ := get(t, client, baseURL+"/auth/github")
+	if status != http.StatusInternalServerError {
+		t.Errorf("got status %d, want %d", status, http.StatusInternalServerError)
+	}
+	if n := len(llm.Requests()); n != 0 {
+		t.Errorf("got %d LLM requests, want none", n)
+	}
+}
+
+func TestTokenLoginWarnsAboutScopes(t *testing.T) {
+	gh := fakegithub.New()
+	gh.Scopes = "read:user"
+	llm := fakellm.New()
+
+	baseURL := newTestServer(t, gh, llm, nil)
+	client := newTestClient(t)
+
+	if status, _ := post(t, client, baseURL+"/auth/token", url.Values{"token": {"wrong-token"}}); status != http.StatusUnauthorized {
+		t.Errorf("invalid token: got status %d, want %d", status, http.StatusUnauthorized)
+	}
+
+	status, page := post(t, client, baseURL+"/auth/token", url.Values{"token": {gh.Token}, "mode": {"template"}})
+	if status != http.StatusOK {
+		t.Fatalf("token login returned %d: %s", status, page)
+	}
+	body := waitForCV(t, client, baseURL, page)
+
+	for _, want := range []string{"The Octocat", "The token lacks the read:org scope"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("CV page does not contain %q", want)
+		}
+	}
+	for _, unwanted := range []string{"lacks the read:user scope", "lacks the repo scope"} {
+		if strings.Contains(body, unwanted) {
+			t.Errorf("CV page contains %q", unwanted)
+		}
+	}
+	if contains(gh.Requests(), "GET /login/oauth/authorize") {
+		t.Error("token login went through OAuth")
+	}
+}
+
+func TestConfiguredTokenSkipsOAuth(t *testing.T) {
+	gh := fakegithub.New()
+	llm := fakellm.New()
+
+	baseURL := newTestServer(t, gh, llm, map[string]interface{}{
+		"github.client_id":      "",
+		"github.token":          gh.Token,
+		"github.token_password": "operator-password",
+	})
+	client := newTestClient(t)
+
+	// Visitors without the password are not signed in as the token's owner
+	if status, _ := get(t, client, baseURL+"/auth/github?mode=template"); status != http.StatusUnauthorized {
+		t.Fatalf("configured token login without password returned %d, want %d", status, http.StatusUnauthorized)
+	}
+	if contains(gh.Requests(), "GET /user") {
+		t.Error("configured token used without password")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, baseURL+"/auth/github?mode=template", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetBasicAuth("", "operator-password")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("configured token login returned %d: %s", resp.StatusCode, page)
+	}
+	body := waitForCV(t, client, baseURL, string(page))
+	if !strings.Contains(body, "The Octocat") {
+		t.Error("CV page does not contain the profile name")
+	}
+	if strings.Contains(body, "lacks the") {
+		t.Error("CV page warns about scopes the token has")
+	}
+	if contains(gh.Requests(), "POST /login/oauth/access_token") {
+		t.Error("configured token login went through OAuth")
+	}
+}
+
+func joinPrompts(reqs []fakellm.ChatRequest) string {
+	var prompts strings.Builder
+	for _, req := range reqs {
+		for _, msg := range req.Messages {
+			prompts.WriteString(msg.Content)
+		}
+	}
+	return prompts.String()
+}
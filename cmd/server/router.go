@@ -0,0 +1,1805 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+
+	"opengptmservice/internal/auth"
+	"opengptmservice/internal/cache"
+	"opengptmservice/internal/jobs"
+	"opengptmservice/internal/limiter"
+	"opengptmservice/internal/models"
+	"opengptmservice/internal/retry"
+	"opengptmservice/internal/services"
+	"opengptmservice/internal/session"
+	"opengptmservice/internal/storage"
+	"opengptmservice/internal/theme"
+	"opengptmservice/internal/usage"
+)
+
+// maxCVLength is the longest CV markdown accepted from the editor
+const maxCVLength = 100000
+
+// maxFeedbackLength is the longest feedback comment accepted
+const maxFeedbackLength = 5000
+
+// maxInstructionLength is the longest chat instruction accepted
+const maxInstructionLength = 2000
+
+// recentFeedback is the number of comments listed in the feedback summary
+const recentFeedback = 100
+
+// newRouter initializes the services from the configuration and sets up the
+// routes. Templates and static files are served from webDir; background jobs
+// are cancelled when ctx is done.
+func newRouter(ctx context.Context, webDir string) (*gin.Engine, error) {
+	// Initialize services
+	hosts, err := auth.HostsFromConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure hosts: %v", err)
+	}
+	collectors := make(map[string]services.Collector)
+	for _, host := range hosts {
+		collectors[host.Name] = services.NewCollector(host)
+	}
+	usageTracker := usage.NewTrackerFromConfig()
+	cacheStore, err := cache.NewStoreFromConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure cache: %v", err)
+	}
+	cacheTTL := viper.GetDuration("cache.ttl")
+	if !viper.IsSet("cache.ttl") {
+		cacheTTL = 24 * time.Hour
+	}
+	limits := limiter.NewGroupFromConfig()
+	cvService := services.NewCVService(usageTracker, limits, services.NewCVCache(cacheStore, cacheTTL))
+	siteGenerator := services.NewSiteGenerator()
+	themes, err := theme.NewRegistryFromConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load themes: %v", err)
+	}
+	pdfConverter := theme.NewPDFConverterFromConfig()
+	versions, err := storage.NewStoreFromConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure storage: %v", err)
+	}
+	idleTimeout := viper.GetDuration("server.session_idle_timeout")
+	if idleTimeout <= 0 {
+		idleTimeout = 24 * time.Hour
+	}
+	sessions := session.NewStore(ctx, idleTimeout)
+	jobManager := jobs.NewManager(ctx, 30*time.Second)
+
+	// Initialize router
+	r := gin.Default()
+
+	// Load HTML templates
+	r.LoadHTMLGlob(filepath.Join(webDir, "templates", "*"))
+
+	// Serve static files
+	r.Static("/static", filepath.Join(webDir, "static"))
+
+	// Routes
+	r.GET("/", func(c *gin.Context) {
+		c.HTML(http.StatusOK, "index.html", gin.H{
+			"title": "Developer CV Generator",
+			"hosts": hosts,
+		})
+	})
+
+	// admit checks the budget and the queue of login before a request
+	// using the LLM, refusing it when either is exhausted. Requests that
+	// don't use the LLM, such as template generations, are always admitted.
+	admit := func(c *gin.Context, login string, llm bool) bool {
+		if !llm {
+			return true
+		}
+		if err := usageTracker.Check(login); err != nil {
+			log.Printf("Refusing generation for %s: %v", login, err)
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			return false
+		}
+		if limits.Full() {
+			log.Printf("Refusing generation for %s: queue full", login)
+			queueFull(c, limits)
+			return false
+		}
+		return true
+	}
+
+	// saveVersion stores cv, generated from data with opts, as the newest
+	// version of owner and returns its ID. Without storage, or when storing
+	// fails, the CV is only kept in the session and the ID is empty.
+	saveVersion := func(owner, source string, cv *models.CV, data *models.DeveloperData, opts services.GenerateOptions) string {
+		if versions == nil || owner == "" {
+			return ""
+		}
+		version := &storage.Version{
+			User:          owner,
+			Source:        source,
+			PromptVersion: services.PromptVersion,
+			Models:        cv.Models(),
+			Mode:          opts.Mode,
+			Length:        opts.Length,
+			CV:            cv,
+			Data:          data,
+		}
+		if err := versions.Save(version); err != nil {
+			log.Printf("Warning: failed to store CV of %s: %v", owner, err)
+			return ""
+		}
+		return version.ID
+	}
+
+	// generate writes the CV of login from data, which the privacy policy
+	// has been applied to, and stores both in sess
+	generate := func(ctx context.Context, sess *session.Session, login string, data *models.DeveloperData, opts services.GenerateOptions) error {
+		ctx = usage.WithScope(ctx, usage.Scope{User: login, Job: jobs.IDFromContext(ctx)})
+
+		cv, err := cvService.Generate(ctx, data, opts)
+		if err != nil {
+			log.Printf("Error generating CV: %v", err)
+			return fmt.Errorf("failed to generate CV: %w", err)
+		}
+
+		log.Printf("Successfully generated CV")
+
+		sess.Lock()
+		sess.Data = data
+		sess.CV = cv
+		sess.VersionID = saveVersion(sess.Owner(), storage.SourceGenerated, cv, data, opts)
+		sess.Chat = services.Chat{}
+		sess.Unlock()
+		return nil
+	}
+
+	// signIn connects account, the owner of userInfo, on host to the session
+	// and starts generating the CV. Unless connect is set, previously
+	// connected accounts are dropped. warnings are shown with the CV.
+	signIn := func(c *gin.Context, sess *session.Session, host *auth.Host, account session.Account, userInfo map[string]interface{}, connect bool, warnings []string) {
+		log.Printf("Successfully fetched user info for: %s on %s", userInfo["login"], host.Name)
+		account.Host = host.Name
+		account.Login, _ = userInfo["login"].(string)
+
+		sess.Lock()
+		defer sess.Unlock()
+		user := sess.User
+		if !connect {
+			user = userInfo
+		}
+		login, _ := user["login"].(string)
+		opts := sess.Options
+		if opts.Mode == "" {
+			opts.Mode = viper.GetString("cv.mode")
+		}
+		if opts.Length == "" {
+			opts.Length = viper.GetString("cv.length")
+		}
+
+		// A refused generation leaves the session and its CV as they were
+		if !admit(c, login, opts.Mode != services.ModeTemplate) {
+			return
+		}
+
+		if !connect {
+			sess.Accounts = nil
+			sess.User = userInfo
+			sess.Warnings = nil
+		}
+		// A new session ID on every sign-in, so that an ID known before
+		// doesn't give access to the account
+		sessions.Renew(c, sess)
+		sess.AddAccount(account)
+		sess.Warnings = append(sess.Warnings, warnings...)
+		sess.PendingHost = ""
+		sess.Connect = false
+		sess.Collected = nil
+		sess.Data = nil
+		sess.CV = nil
+		sess.VersionID = ""
+		sess.Options = opts
+		accounts := append([]session.Account(nil), sess.Accounts...)
+
+		// Only one generation per session
+		if job, ok := jobManager.Get(sess.JobID); ok {
+			job.Cancel()
+		}
+
+		job := jobManager.Start(sess.ID, func(ctx context.Context) error {
+			// Get the activity from every connected host
+			var collected []*models.DeveloperData
+			for _, account := range accounts {
+				// Expiring tokens, such as GitHub App user-to-server
+				// tokens, are refreshed for the session
+				if account.Expired() && account.RefreshToken != "" {
+					token, err := auth.RefreshToken(ctx, hosts.Get(account.Host), account.RefreshToken)
+					if err != nil {
+						log.Printf("Error refreshing token for %s: %v", account.Host, err)
+						return fmt.Errorf("failed to refresh the token for %s, please log in again: %v", account.Host, err)
+					}
+					account.Token = *token
+					sess.Lock()
+					sess.UpdateAccount(account)
+					sess.Unlock()
+				}
+
+				data, err := collectors[account.Host].GetUserData(ctx, account.AccessToken)
+				if err != nil {
+					log.Printf("Error getting data from %s: %v", account.Host, err)
+					return fmt.Errorf("failed to get data from %s: %v", account.Host, err)
+				}
+				if gh, ok := collectors[account.Host].(*services.GitHubService); ok && account.InstallationID != 0 {
+					if err := gh.AddInstallationRepositories(ctx, data, account.InstallationID); err != nil {
+						log.Printf("Warning: Failed to get repositories of installation %d: %v", account.InstallationID, err)
+					}
+				}
+				collected = append(collected, data)
+			}
+			data := services.MergeDeveloperData(collected...)
+
+			log.Printf("Successfully fetched developer data")
+
+			// Users who opted in to private repositories or asked to review
+			// their data choose what is sent on the preview page, with all
+			// private repositories selected for those who opted in
+			sess.Lock()
+			sess.Collected = data
+			review := sess.Review
+			if review && sess.Private {
+				sess.Privacy = services.PrivacyPolicy{Private: services.PrivateSelected}
+				for _, repo := range services.PrivateRepositories(data) {
+					sess.Privacy.Selected = append(sess.Privacy.Selected, repo.HTMLURL)
+				}
+			}
+			policy := sess.Privacy
+			sess.Unlock()
+			if review {
+				log.Printf("Waiting for %s to review the data", login)
+				return nil
+			}
+
+			return generate(ctx, sess, login, policy.Apply(data), opts)
+		})
+		sess.JobID = job.ID
+
+		c.Redirect(http.StatusSeeOther, "/cv")
+	}
+
+	// signInWithToken validates a personal access token and signs in with it
+	signInWithToken := func(c *gin.Context, sess *session.Session, host *auth.Host, token string, connect bool) {
+		info, err := auth.ValidateToken(c.Request.Context(), host, token)
+		if err != nil {
+			log.Printf("Error validating token for %s: %v", host.Name, err)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": fmt.Sprintf("Failed to validate token: %v", err)})
+			return
+		}
+		for _, warning := range info.Warnings {
+			log.Printf("Warning: %s: %s", host.Name, warning)
+		}
+		account := session.Account{Token: auth.Token{AccessToken: token}}
+		signIn(c, sess, host, account, info.User, connect, info.Warnings)
+	}
+
+	// Login starts the OAuth flow on the host given by the host parameter or
+	// the first host of the provider type, e.g. github or gitlab. Hosts with a
+	// token in the configuration sign in with it directly, once the visitor
+	// gave its password through HTTP basic authentication. With connect set,
+	// the account is added to the accounts already connected and the CV is
+	// regenerated from their merged activity.
+	r.GET("/auth/:provider", func(c *gin.Context) {
+		host := hosts.First(c.Param("provider"))
+		if name := c.Query("host"); name != "" {
+			host = hosts.Get(name)
+		}
+		if host == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown host"})
+			return
+		}
+		if host.Token != "" {
+			_, password, _ := c.Request.BasicAuth()
+			if subtle.ConstantTimeCompare([]byte(password), []byte(host.TokenPassword)) != 1 {
+				c.Header("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", host.Name))
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "The password of the configured token is required"})
+				return
+			}
+		}
+
+		sess := sessions.Ensure(c)
+		sess.Lock()
+		connect := setLoginOptions(c, sess)
+		sess.PendingHost = host.Name
+		sess.State = session.NewState()
+		url := auth.AuthURL(host, sess.Private, sess.State)
+		sess.Unlock()
+
+		if host.Token != "" {
+			signInWithToken(c, sess, host, host.Token, connect)
+			return
+		}
+
+		c.Redirect(http.StatusTemporaryRedirect, url)
+	})
+
+	r.GET("/auth/:provider/callback", func(c *gin.Context) {
+		code := c.Query("code")
+		if code == "" {
+			log.Printf("No code provided in callback")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No code provided"})
+			return
+		}
+
+		log.Printf("Received code: %s", code)
+
+		// The state must be the one of the flow started in this session, or
+		// anyone could sign the user in with their own code
+		sess := sessions.Ensure(c)
+		sess.Lock()
+		host := hosts.Get(sess.PendingHost)
+		state := sess.State
+		sess.State = ""
+		connect := sess.Connect
+		private := sess.Private
+		sess.Unlock()
+		if state == "" || subtle.ConstantTimeCompare([]byte(c.Query("state")), []byte(state)) != 1 {
+			log.Printf("Warning: OAuth callback with an invalid state")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid state, please log in again"})
+			return
+		}
+		if host == nil {
+			host = hosts[0]
+		}
+
+		// Exchange code for access token
+		token, err := auth.ExchangeCode(c.Request.Context(), host, code)
+		if err != nil {
+			log.Printf("Error exchanging code for token: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to get access token: %v", err)})
+			return
+		}
+
+		log.Printf("Successfully obtained access token")
+
+		// Get user info
+		userInfo, err := auth.UserInfo(c.Request.Context(), host, token.AccessToken)
+		if err != nil {
+			log.Printf("Error getting user info: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to get user info: %v", err)})
+			return
+		}
+
+		account := session.Account{Token: *token}
+
+		// GitHub redirects from the app installation page with the
+		// installation, which must be one the user can access; users who
+		// installed the app earlier are looked up
+		if host.App != nil && private {
+			requested, _ := strconv.ParseInt(c.Query("installation_id"), 10, 64)
+			login, _ := userInfo["login"].(string)
+			account.InstallationID, err = host.App.UserInstallation(c.Request.Context(), token.AccessToken, login, requested)
+			if errors.Is(err, auth.ErrForeignInstallation) {
+				log.Printf("Warning: %s tried to sign in with installation %d of another account", login, requested)
+				c.JSON(http.StatusForbidden, gin.H{"error": "The GitHub App installation does not belong to you"})
+				return
+			}
+			if err != nil {
+				log.Printf("Warning: Failed to find the installation of %s: %v", login, err)
+			}
+		}
+
+		signIn(c, sess, host, account, userInfo, connect, nil)
+	})
+
+	// Token login signs in with a personal access token from the form
+	// instead of OAuth
+	r.POST("/auth/token", func(c *gin.Context) {
+		token := strings.TrimSpace(c.PostForm("token"))
+		if token == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No token provided"})
+			return
+		}
+		host := hosts[0]
+		if name := c.PostForm("host"); name != "" {
+			if host = hosts.Get(name); host == nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown host"})
+				return
+			}
+		}
+
+		sess := sessions.Ensure(c)
+		sess.Lock()
+		connect := setLoginOptions(c, sess)
+		sess.Unlock()
+
+		signInWithToken(c, sess, host, token, connect)
+	})
+
+	// Logging out forgets the session along with the tokens and the CV in
+	// it; stored versions are kept
+	r.POST("/logout", func(c *gin.Context) {
+		if sess, ok := sessions.Get(c); ok {
+			sess.Lock()
+			if job, ok := jobManager.Get(sess.JobID); ok {
+				job.Cancel()
+			}
+			owner := sess.Owner()
+			sess.Unlock()
+			sessions.Delete(c)
+			log.Printf("Logged out %s", owner)
+		}
+		c.Redirect(http.StatusSeeOther, "/")
+	})
+
+	r.GET("/cv", func(c *gin.Context) {
+		sess, ok := sessions.Get(c)
+		if !ok {
+			c.Redirect(http.StatusTemporaryRedirect, "/")
+			return
+		}
+
+		sess.Lock()
+		defer sess.Unlock()
+
+		// Show progress while the CV is being generated
+		if job, ok := jobManager.Get(sess.JobID); ok && job.Info().Status != jobs.StatusDone {
+			c.HTML(http.StatusOK, "index.html", gin.H{
+				"title": "Generating your Developer CV",
+				"job":   job.Info(),
+				"user":  sess.User,
+			})
+			return
+		}
+
+		if sess.CV == nil && sess.Collected != nil {
+			c.Redirect(http.StatusSeeOther, "/preview")
+			return
+		}
+		if sess.CV == nil {
+			c.Redirect(http.StatusTemporaryRedirect, "/")
+			return
+		}
+
+		th := sessionTheme(c, themes, sess)
+		body, err := th.Body(theme.NewDocument(cvTitle(sess.User), sess.CV))
+		if err != nil {
+			log.Printf("Error rendering CV: %v", err)
+			c.String(http.StatusInternalServerError, "Failed to render CV")
+			return
+		}
+
+		// Return the CV
+		c.HTML(http.StatusOK, "index.html", gin.H{
+			"title":     "Your Developer CV",
+			"cv":        body,
+			"themeCSS":  th.CSS,
+			"themes":    themes.List(),
+			"theme":     th.Name,
+			"sections":  sess.CV.Sections,
+			"models":    sess.CV.Models(),
+			"user":      sess.User,
+			"connect":   unconnectedHosts(hosts, sess),
+			"warnings":  sess.Warnings,
+			"private":   len(services.PrivateRepositories(sess.Collected)),
+			"stored":    versions != nil,
+			"publish":   versions != nil && sess.VersionID != "",
+			"published": publicationInfo(c, versions, sess.Owner()),
+			"feedback":  versionFeedback(versions, sess.Owner(), sess.VersionID),
+		})
+	})
+
+	r.GET("/cv/edit", func(c *gin.Context) {
+		sess, ok := sessions.Get(c)
+		if !ok {
+			c.Redirect(http.StatusTemporaryRedirect, "/")
+			return
+		}
+
+		sess.Lock()
+		defer sess.Unlock()
+		if sess.CV == nil {
+			c.Redirect(http.StatusTemporaryRedirect, "/cv")
+			return
+		}
+
+		c.HTML(http.StatusOK, "index.html", gin.H{
+			"title":    "Edit your Developer CV",
+			"editor":   true,
+			"user":     sess.User,
+			"markdown": sess.CV.Markdown(),
+		})
+	})
+
+	// Saving the edited markdown replaces the CV in the session, so the
+	// exports use it, and stores it as a new version
+	r.POST("/api/cvs", func(c *gin.Context) {
+		var req struct {
+			Markdown string `json:"markdown"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Markdown) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "The CV markdown is required"})
+			return
+		}
+		if len(req.Markdown) > maxCVLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("The CV is longer than %d characters", maxCVLength)})
+			return
+		}
+
+		sess, ok := sessions.Get(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "No CV in session"})
+			return
+		}
+		sess.Lock()
+		defer sess.Unlock()
+		if sess.CV == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "No CV in session"})
+			return
+		}
+
+		sess.CV = sess.CV.Edit(req.Markdown)
+		sess.VersionID = saveVersion(sess.Owner(), storage.SourceEdited, sess.CV, sess.Data, sess.Options)
+		log.Printf("Saved edited CV of %s", sess.Owner())
+		c.JSON(http.StatusCreated, gin.H{"id": sess.VersionID, "cv": sess.CV})
+	})
+
+	r.POST("/cv/theme", func(c *gin.Context) {
+		sess, ok := sessions.Get(c)
+		if !ok {
+			c.Redirect(http.StatusSeeOther, "/")
+			return
+		}
+		name := c.PostForm("theme")
+		if !themes.Has(name) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown theme %q", name)})
+			return
+		}
+		sess.Lock()
+		sess.Theme = name
+		sess.Unlock()
+		c.Redirect(http.StatusSeeOther, "/cv")
+	})
+
+	// The print view and the PDF export render the CV in the session with
+	// its theme, or the one in the theme parameter, as a standalone document
+	renderDocument := func(c *gin.Context, print bool) ([]byte, string, bool) {
+		sess, ok := sessions.Get(c)
+		if !ok {
+			c.Redirect(http.StatusTemporaryRedirect, "/")
+			return nil, "", false
+		}
+
+		sess.Lock()
+		defer sess.Unlock()
+		if sess.CV == nil {
+			c.Redirect(http.StatusTemporaryRedirect, "/cv")
+			return nil, "", false
+		}
+
+		var buf bytes.Buffer
+		doc := theme.NewDocument(cvTitle(sess.User), sess.CV)
+		if err := sessionTheme(c, themes, sess).Write(&buf, doc, print); err != nil {
+			log.Printf("Error rendering CV: %v", err)
+			c.String(http.StatusInternalServerError, "Failed to render CV")
+			return nil, "", false
+		}
+		login, _ := sess.User["login"].(string)
+		return buf.Bytes(), login, true
+	}
+
+	r.GET("/cv/print", func(c *gin.Context) {
+		html, _, ok := renderDocument(c, true)
+		if !ok {
+			return
+		}
+		c.Data(http.StatusOK, "text/html; charset=utf-8", html)
+	})
+
+	// Without a PDF command the print view is shown, from which browsers
+	// save PDFs
+	r.GET("/cv/pdf", func(c *gin.Context) {
+		if pdfConverter == nil {
+			target := "/cv/print"
+			if c.Query("theme") != "" {
+				target += "?theme=" + url.QueryEscape(c.Query("theme"))
+			}
+			c.Redirect(http.StatusSeeOther, target)
+			return
+		}
+
+		html, login, ok := renderDocument(c, false)
+		if !ok {
+			return
+		}
+		pdf, err := pdfConverter.Convert(c.Request.Context(), html)
+		if err != nil {
+			log.Printf("Error converting CV to PDF: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export PDF"})
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", login+"-cv.pdf"))
+		c.Data(http.StatusOK, "application/pdf", pdf)
+	})
+
+	// The markdown export is the CV in the session, including the user's edits
+	r.GET("/cv/markdown", func(c *gin.Context) {
+		sess, ok := sessions.Get(c)
+		if !ok {
+			c.Redirect(http.StatusTemporaryRedirect, "/")
+			return
+		}
+
+		sess.Lock()
+		defer sess.Unlock()
+		if sess.CV == nil {
+			c.Redirect(http.StatusTemporaryRedirect, "/cv")
+			return
+		}
+
+		login, _ := sess.User["login"].(string)
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", login+"-cv.md"))
+		c.Data(http.StatusOK, "text/markdown; charset=utf-8", []byte(sess.CV.Markdown()))
+	})
+
+	r.GET("/cv/ats.txt", func(c *gin.Context) {
+		sess, ok := sessions.Get(c)
+		if !ok {
+			c.Redirect(http.StatusTemporaryRedirect, "/")
+			return
+		}
+
+		sess.Lock()
+		defer sess.Unlock()
+		if sess.CV == nil {
+			c.Redirect(http.StatusTemporaryRedirect, "/cv")
+			return
+		}
+
+		login, _ := sess.User["login"].(string)
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", login+"-cv.txt"))
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(services.ATSText(sess.CV)))
+	})
+
+	// The ATS report checks the CV for the comma-separated keywords
+	// parameter, such as the skills of a job offer, defaulting to the
+	// languages and topics of the user's repositories
+	r.GET("/cv/ats", func(c *gin.Context) {
+		sess, ok := sessions.Get(c)
+		if !ok {
+			c.Redirect(http.StatusTemporaryRedirect, "/")
+			return
+		}
+
+		sess.Lock()
+		defer sess.Unlock()
+		if sess.CV == nil {
+			c.Redirect(http.StatusTemporaryRedirect, "/cv")
+			return
+		}
+
+		var keywords []string
+		for _, keyword := range strings.Split(c.Query("keywords"), ",") {
+			if keyword = strings.TrimSpace(keyword); keyword != "" {
+				keywords = append(keywords, keyword)
+			}
+		}
+		if len(keywords) == 0 && sess.Data != nil && sess.Data.Profile != nil {
+			keywords = services.ATSKeywords(sess.Data, 10)
+		}
+
+		c.HTML(http.StatusOK, "index.html", gin.H{
+			"title":    "ATS report for your Developer CV",
+			"ats":      services.AnalyzeATS(sess.CV, keywords),
+			"user":     sess.User,
+			"keywords": strings.Join(keywords, ", "),
+			"text":     services.ATSText(sess.CV),
+		})
+	})
+
+	// The portfolio site is built from the data and CV in the session, with
+	// the READMEs of the projects read from their hosts
+	r.GET("/cv/site.zip", func(c *gin.Context) {
+		sess, ok := sessions.Get(c)
+		if !ok {
+			c.Redirect(http.StatusTemporaryRedirect, "/")
+			return
+		}
+
+		sess.Lock()
+		data := sess.Data
+		cv := sess.CV
+		accounts := append([]session.Account(nil), sess.Accounts...)
+		login, _ := sess.User["login"].(string)
+		sess.Unlock()
+		if data == nil || cv == nil {
+			c.Redirect(http.StatusTemporaryRedirect, "/cv")
+			return
+		}
+
+		theme := c.DefaultQuery("theme", services.SiteThemes[0])
+		if !contains(services.SiteThemes, theme) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown theme %q", theme)})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+		readmes := make(map[string]string)
+		for _, repo := range services.SiteProjects(data) {
+			account, ok := repositoryAccount(hosts, accounts, repo)
+			if !ok {
+				continue
+			}
+			reader, ok := collectors[account.Host].(services.ReadmeReader)
+			if !ok {
+				continue
+			}
+			readme, err := reader.GetReadme(ctx, account.AccessToken, repo)
+			if err != nil {
+				log.Printf("Warning: %v", err)
+				continue
+			}
+			readmes[repo.HTMLURL] = readme
+		}
+
+		var buf bytes.Buffer
+		if err := siteGenerator.Build(&buf, services.SiteInput{Data: data, CV: cv, Readmes: readmes}, theme); err != nil {
+			log.Printf("Error building site: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build the site"})
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", login+"-site.zip"))
+		c.Data(http.StatusOK, "application/zip", buf.Bytes())
+	})
+
+	// Preview shows exactly what is sent to the LLM with the privacy policy
+	// in the session or, when the policy parameter is set, the one in the
+	// query, so the user can try policies before generating
+	r.GET("/preview", func(c *gin.Context) {
+		sess, ok := sessions.Get(c)
+		if !ok {
+			c.Redirect(http.StatusTemporaryRedirect, "/")
+			return
+		}
+
+		sess.Lock()
+		defer sess.Unlock()
+		if sess.Collected == nil {
+			c.Redirect(http.StatusTemporaryRedirect, "/cv")
+			return
+		}
+
+		policy := sess.Privacy
+		if c.Query("policy") != "" {
+			policy = privacyPolicy(c)
+		}
+		data := policy.Apply(sess.Collected)
+
+		c.HTML(http.StatusOK, "index.html", gin.H{
+			"title":   "Review what is sent",
+			"preview": true,
+			"user":    sess.User,
+			"policy":  policy.Private,
+			"repos":   privateRepositoryChoices(sess.Collected, policy),
+			"prompts": cvService.Prompts(data, sess.Options),
+			"llm":     sess.Options.Mode != services.ModeTemplate,
+		})
+	})
+
+	// Generating from the preview applies the chosen privacy policy
+	r.POST("/preview", func(c *gin.Context) {
+		sess, ok := sessions.Get(c)
+		if !ok {
+			c.Redirect(http.StatusSeeOther, "/")
+			return
+		}
+
+		sess.Lock()
+		defer sess.Unlock()
+		if sess.Collected == nil {
+			c.Redirect(http.StatusSeeOther, "/")
+			return
+		}
+
+		sess.Privacy = privacyPolicy(c)
+		sess.Review = false
+		login, _ := sess.User["login"].(string)
+		data := sess.Privacy.Apply(sess.Collected)
+		opts := sess.Options
+		if !admit(c, login, opts.Mode != services.ModeTemplate) {
+			return
+		}
+
+		if job, ok := jobManager.Get(sess.JobID); ok {
+			job.Cancel()
+		}
+		sess.CV = nil
+		sess.VersionID = ""
+		job := jobManager.Start(sess.ID, func(ctx context.Context) error {
+			return generate(ctx, sess, login, data, opts)
+		})
+		sess.JobID = job.ID
+
+		c.Redirect(http.StatusSeeOther, "/cv")
+	})
+
+	r.POST("/cv/sections/:section", func(c *gin.Context) {
+		sess, ok := sessions.Get(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "No CV in session"})
+			return
+		}
+
+		name := c.Param("section")
+		sess.Lock()
+		data := sess.Data
+		cv := sess.CV
+		sent := ""
+		if cv != nil {
+			sent = cv.Markdown()
+		}
+		opts := sess.Options
+		login, _ := sess.User["login"].(string)
+		sess.Unlock()
+		if cv == nil || data == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "No CV in session"})
+			return
+		}
+		if cv.Section(name) == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("CV has no section %q", name)})
+			return
+		}
+
+		if !admit(c, login, true) {
+			return
+		}
+
+		ctx := usage.WithScope(c.Request.Context(), usage.Scope{User: login})
+		section, err := cvService.RegenerateSection(ctx, data, name, opts)
+		if err != nil {
+			log.Printf("Error regenerating section: %v", err)
+			generationError(c, limits, "Failed to regenerate section", err)
+			return
+		}
+
+		sess.Lock()
+		defer sess.Unlock()
+		if cvChanged(c, sess, cv, sent) {
+			return
+		}
+		// The CV is replaced rather than changed in place, as requests
+		// working on the previous one compare it with the session's
+		updated := &models.CV{Sections: append([]models.CVSection(nil), cv.Sections...)}
+		*updated.Section(name) = *section
+		sess.CV = updated
+		sess.VersionID = saveVersion(sess.Owner(), storage.SourceSection, sess.CV, sess.Data, opts)
+
+		log.Printf("Successfully regenerated section %s", name)
+		c.JSON(http.StatusOK, section)
+	})
+
+	// Revising regenerates the whole CV in the session from the previous CV
+	// and the user's feedback, storing the feedback against the previous
+	// version and the result as a new version
+	r.POST("/cv/revise", func(c *gin.Context) {
+		var req struct {
+			Feedback string `json:"feedback"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Feedback) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Feedback is required"})
+			return
+		}
+		if len(req.Feedback) > maxFeedbackLength {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Feedback is too long"})
+			return
+		}
+		sess, ok := sessions.Get(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "No CV in session"})
+			return
+		}
+
+		sess.Lock()
+		data := sess.Data
+		cv := sess.CV
+		sent := ""
+		if cv != nil {
+			sent = cv.Markdown()
+		}
+		opts := sess.Options
+		owner := sess.Owner()
+		versionID := sess.VersionID
+		login, _ := sess.User["login"].(string)
+		sess.Unlock()
+		if cv == nil || data == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "No CV in session"})
+			return
+		}
+
+		if !admit(c, login, true) {
+			return
+		}
+
+		if _, err := addFeedback(versions, owner, versionID, req.Feedback, true); err != nil {
+			log.Printf("Warning: failed to store feedback of %s: %v", owner, err)
+		}
+
+		ctx := usage.WithScope(c.Request.Context(), usage.Scope{User: login})
+		revised, err := cvService.Revise(ctx, data, cv, req.Feedback, opts)
+		if err != nil {
+			log.Printf("Error revising CV: %v", err)
+			generationError(c, limits, "Failed to revise CV", err)
+			return
+		}
+
+		sess.Lock()
+		defer sess.Unlock()
+		if cvChanged(c, sess, cv, sent) {
+			return
+		}
+		sess.CV = revised
+		sess.VersionID = saveVersion(sess.Owner(), storage.SourceRevised, revised, sess.Data, opts)
+
+		log.Printf("Revised CV of %s with feedback", login)
+		c.JSON(http.StatusOK, gin.H{"id": sess.VersionID, "cv": revised})
+	})
+
+	// The refinement chat applies one instruction of the user per turn to the
+	// CV in the session, storing every result as a new version
+	r.GET("/cv/chat", func(c *gin.Context) {
+		sess, ok := sessions.Get(c)
+		if !ok {
+			c.Redirect(http.StatusTemporaryRedirect, "/")
+			return
+		}
+
+		sess.Lock()
+		defer sess.Unlock()
+		if sess.CV == nil {
+			c.Redirect(http.StatusTemporaryRedirect, "/cv")
+			return
+		}
+
+		th := sessionTheme(c, themes, sess)
+		body, err := th.Body(theme.NewDocument(cvTitle(sess.User), sess.CV))
+		if err != nil {
+			log.Printf("Error rendering CV: %v", err)
+			c.String(http.StatusInternalServerError, "Failed to render CV")
+			return
+		}
+		c.HTML(http.StatusOK, "index.html", gin.H{
+			"title":    "Refine your Developer CV",
+			"chat":     true,
+			"user":     sess.User,
+			"turns":    sess.Chat.Turns,
+			"cv":       body,
+			"themeCSS": th.CSS,
+		})
+	})
+
+	r.POST("/api/chat", func(c *gin.Context) {
+		var req struct {
+			Instruction string `json:"instruction"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Instruction) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "An instruction is required"})
+			return
+		}
+		if len(req.Instruction) > maxInstructionLength {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "The instruction is too long"})
+			return
+		}
+		sess, ok := sessions.Get(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "No CV in session"})
+			return
+		}
+
+		sess.Lock()
+		data := sess.Data
+		cv := sess.CV
+		sent := ""
+		if cv != nil {
+			sent = cv.Markdown()
+		}
+		chat := sess.Chat
+		opts := sess.Options
+		login, _ := sess.User["login"].(string)
+		sess.Unlock()
+		if cv == nil || data == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "No CV in session"})
+			return
+		}
+
+		if !admit(c, login, true) {
+			return
+		}
+
+		ctx := usage.WithScope(c.Request.Context(), usage.Scope{User: login})
+		refined, err := cvService.Refine(ctx, data, &chat, cv, req.Instruction, opts)
+		if err != nil {
+			log.Printf("Error refining CV: %v", err)
+			generationError(c, limits, "Failed to refine CV", err)
+			return
+		}
+
+		sess.Lock()
+		defer sess.Unlock()
+		// Turns are applied to the CV they were sent with only
+		if cvChanged(c, sess, cv, sent) {
+			return
+		}
+		sess.Chat.Add(strings.TrimSpace(req.Instruction), cv, sess.VersionID, refined)
+		sess.CV = refined
+		sess.VersionID = saveVersion(sess.Owner(), storage.SourceChat, refined, sess.Data, opts)
+
+		log.Printf("Refined CV of %s in chat", login)
+		c.JSON(http.StatusOK, gin.H{"id": sess.VersionID, "cv": refined, "turns": sess.Chat.Turns})
+	})
+
+	// Undo restores the CV and version from before the last turn, as long as
+	// the CV was not changed since
+	r.POST("/api/chat/undo", func(c *gin.Context) {
+		sess, ok := sessions.Get(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "No CV in session"})
+			return
+		}
+
+		sess.Lock()
+		defer sess.Unlock()
+		turns := sess.Chat.Turns
+		if len(turns) == 0 || sess.CV == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "There is no chat turn to undo"})
+			return
+		}
+		if sess.CV.Markdown() != turns[len(turns)-1].Result {
+			c.JSON(http.StatusConflict, gin.H{"error": "The CV changed since the last chat turn"})
+			return
+		}
+
+		turn, _ := sess.Chat.Undo()
+		sess.CV = turn.Previous
+		sess.VersionID = turn.PreviousID
+		c.JSON(http.StatusOK, gin.H{"id": sess.VersionID, "cv": sess.CV, "turns": sess.Chat.Turns})
+	})
+
+	// versionOwner returns the owner of the CV versions of the current
+	// session, responding with an error if there is none or storage is
+	// disabled
+	versionOwner := func(c *gin.Context) (string, bool) {
+		if versions == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "CV storage is disabled"})
+			return "", false
+		}
+		sess, ok := sessions.Get(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Not signed in"})
+			return "", false
+		}
+		sess.Lock()
+		owner := sess.Owner()
+		sess.Unlock()
+		if owner == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Not signed in"})
+			return "", false
+		}
+		return owner, true
+	}
+
+	// Feedback is stored against the current CV version of the session
+	r.POST("/api/feedback", func(c *gin.Context) {
+		var req struct {
+			Comment string `json:"comment"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Comment) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A comment is required"})
+			return
+		}
+		if len(req.Comment) > maxFeedbackLength {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Feedback is too long"})
+			return
+		}
+		owner, ok := versionOwner(c)
+		if !ok {
+			return
+		}
+		sess, _ := sessions.Get(c)
+		sess.Lock()
+		versionID := sess.VersionID
+		sess.Unlock()
+		if versionID == "" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "The CV has not been stored"})
+			return
+		}
+
+		feedback, err := addFeedback(versions, owner, versionID, req.Comment, false)
+		if err != nil {
+			status, message := versionError(err)
+			c.JSON(status, gin.H{"error": message})
+			return
+		}
+		c.JSON(http.StatusCreated, feedback)
+	})
+
+	r.GET("/api/cvs/:id/feedback", func(c *gin.Context) {
+		owner, ok := versionOwner(c)
+		if !ok {
+			return
+		}
+		feedback, err := versions.Feedback(owner, c.Param("id"))
+		if err != nil {
+			log.Printf("Error listing feedback: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list feedback"})
+			return
+		}
+		if feedback == nil {
+			feedback = []*storage.Feedback{}
+		}
+		c.JSON(http.StatusOK, feedback)
+	})
+
+	r.GET("/history", func(c *gin.Context) {
+		sess, ok := sessions.Get(c)
+		if !ok {
+			c.Redirect(http.StatusTemporaryRedirect, "/")
+			return
+		}
+		sess.Lock()
+		owner := sess.Owner()
+		user := sess.User
+		current := sess.VersionID
+		sess.Unlock()
+		if owner == "" || versions == nil {
+			c.Redirect(http.StatusTemporaryRedirect, "/cv")
+			return
+		}
+
+		list, err := versions.List(owner)
+		if err != nil {
+			log.Printf("Error listing CV versions: %v", err)
+			c.String(http.StatusInternalServerError, "Failed to list CV versions")
+			return
+		}
+		page := gin.H{
+			"title":    "Your CV history",
+			"history":  true,
+			"user":     user,
+			"versions": list,
+			"current":  current,
+			"from":     c.Query("from"),
+			"to":       c.Query("to"),
+		}
+		if c.Query("from") != "" && c.Query("to") != "" {
+			diff, err := diffVersions(versions, owner, c.Query("from"), c.Query("to"))
+			if err != nil {
+				c.String(versionError(err))
+				return
+			}
+			page["diff"] = diff
+		}
+		c.HTML(http.StatusOK, "index.html", page)
+	})
+
+	r.GET("/api/cvs", func(c *gin.Context) {
+		owner, ok := versionOwner(c)
+		if !ok {
+			return
+		}
+		list, err := versions.List(owner)
+		if err != nil {
+			log.Printf("Error listing CV versions: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list CV versions"})
+			return
+		}
+		summaries := make([]*storage.Version, 0, len(list))
+		for _, v := range list {
+			summaries = append(summaries, v.Summary())
+		}
+		c.JSON(http.StatusOK, summaries)
+	})
+
+	r.GET("/api/cvs/:id", func(c *gin.Context) {
+		owner, ok := versionOwner(c)
+		if !ok {
+			return
+		}
+		version, err := versions.Get(owner, c.Param("id"))
+		if err != nil {
+			status, message := versionError(err)
+			c.JSON(status, gin.H{"error": message})
+			return
+		}
+		c.JSON(http.StatusOK, version)
+	})
+
+	r.DELETE("/api/cvs/:id", func(c *gin.Context) {
+		owner, ok := versionOwner(c)
+		if !ok {
+			return
+		}
+		if err := versions.Delete(owner, c.Param("id")); err != nil {
+			status, message := versionError(err)
+			c.JSON(status, gin.H{"error": message})
+			return
+		}
+		sess, _ := sessions.Get(c)
+		sess.Lock()
+		if sess.VersionID == c.Param("id") {
+			sess.VersionID = ""
+		}
+		sess.Unlock()
+		log.Printf("Deleted CV version %s of %s", c.Param("id"), owner)
+		c.Status(http.StatusNoContent)
+	})
+
+	r.GET("/api/cvs/:id/diff/:other", func(c *gin.Context) {
+		owner, ok := versionOwner(c)
+		if !ok {
+			return
+		}
+		diff, err := diffVersions(versions, owner, c.Param("id"), c.Param("other"))
+		if err != nil {
+			status, message := versionError(err)
+			c.JSON(status, gin.H{"error": message})
+			return
+		}
+		c.JSON(http.StatusOK, diff)
+	})
+
+	// Publishing makes the current CV version available at /u/<slug>.
+	// Publishing again replaces the publication, keeping its views and, for
+	// unlisted CVs, its token.
+	r.POST("/publish", func(c *gin.Context) {
+		owner, ok := versionOwner(c)
+		if !ok {
+			return
+		}
+		sess, _ := sessions.Get(c)
+		sess.Lock()
+		versionID := sess.VersionID
+		themeName := themes.Get(sess.Theme).Name
+		login, _ := sess.User["login"].(string)
+		sess.Unlock()
+		if versionID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Generate or save your CV before publishing it"})
+			return
+		}
+
+		slug := strings.ToLower(strings.TrimSpace(c.PostForm("slug")))
+		if slug == "" {
+			slug = strings.ToLower(login)
+		}
+		if !storage.ValidSlug(slug) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "The address may only contain lowercase letters, digits and dashes"})
+			return
+		}
+		publication := &storage.Publication{User: owner, Slug: slug, VersionID: versionID, Theme: themeName}
+		existing, err := versions.UserPublication(owner)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			status, message := versionError(err)
+			c.JSON(status, gin.H{"error": message})
+			return
+		}
+		if existing != nil {
+			publication.Views = existing.Views
+		}
+
+		switch visibility := c.PostForm("visibility"); visibility {
+		case storage.VisibilityUnlisted:
+			publication.Visibility = visibility
+			publication.Token = storage.NewToken()
+			if existing != nil && existing.Token != "" {
+				publication.Token = existing.Token
+			}
+		case storage.VisibilityPassword:
+			publication.Visibility = visibility
+			if password := c.PostForm("password"); password != "" {
+				if err := publication.SetPassword(password); err != nil {
+					log.Printf("Error hashing password: %v", err)
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to publish CV"})
+					return
+				}
+			} else if existing != nil {
+				publication.PasswordHash = existing.PasswordHash
+			}
+			if publication.PasswordHash == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "A password is required"})
+				return
+			}
+		default:
+			publication.Visibility = storage.VisibilityPublic
+		}
+
+		if days, err := strconv.Atoi(c.PostForm("expires")); err == nil && days > 0 {
+			expires := time.Now().UTC().AddDate(0, 0, days)
+			publication.ExpiresAt = &expires
+		}
+
+		if err := versions.Publish(publication); err != nil {
+			if errors.Is(err, storage.ErrSlugTaken) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			status, message := versionError(err)
+			c.JSON(status, gin.H{"error": message})
+			return
+		}
+		log.Printf("Published CV of %s at %s", owner, slug)
+		c.Redirect(http.StatusSeeOther, "/cv")
+	})
+
+	r.POST("/unpublish", func(c *gin.Context) {
+		owner, ok := versionOwner(c)
+		if !ok {
+			return
+		}
+		if err := versions.Unpublish(owner); err != nil {
+			status, message := versionError(err)
+			c.JSON(status, gin.H{"error": message})
+			return
+		}
+		log.Printf("Unpublished CV of %s", owner)
+		c.Redirect(http.StatusSeeOther, "/cv")
+	})
+
+	// Published CVs are read from the store on every request and never
+	// cached, so unpublishing takes effect immediately. Password protected
+	// CVs are shown after posting the password.
+	showPublication := func(c *gin.Context) {
+		c.Header("Cache-Control", "no-store")
+		notFound := func() {
+			c.HTML(http.StatusNotFound, "index.html", gin.H{
+				"title":       "CV not found",
+				"public":      true,
+				"unavailable": true,
+			})
+		}
+		if versions == nil {
+			notFound()
+			return
+		}
+
+		publication, err := versions.Publication(c.Param("slug"))
+		if err != nil {
+			if !errors.Is(err, storage.ErrNotFound) {
+				log.Printf("Error reading publication: %v", err)
+			}
+			notFound()
+			return
+		}
+		if publication.Expired(time.Now()) {
+			notFound()
+			return
+		}
+		if publication.Visibility != storage.VisibilityPublic {
+			c.Header("X-Robots-Tag", "noindex")
+		}
+		if publication.Visibility == storage.VisibilityUnlisted &&
+			subtle.ConstantTimeCompare([]byte(c.Query("key")), []byte(publication.Token)) != 1 {
+			notFound()
+			return
+		}
+		if publication.Visibility == storage.VisibilityPassword && !publication.CheckPassword(c.PostForm("password")) {
+			status := http.StatusOK
+			if c.Request.Method == http.MethodPost {
+				status = http.StatusUnauthorized
+			}
+			c.HTML(status, "index.html", gin.H{
+				"title":         "Password required",
+				"public":        true,
+				"password":      true,
+				"wrongPassword": c.Request.Method == http.MethodPost,
+			})
+			return
+		}
+
+		version, err := versions.Get(publication.User, publication.VersionID)
+		if err != nil {
+			if !errors.Is(err, storage.ErrNotFound) {
+				log.Printf("Error reading published CV: %v", err)
+			}
+			notFound()
+			return
+		}
+		if err := versions.CountView(publication.Slug); err != nil {
+			log.Printf("Warning: failed to count view of %s: %v", publication.Slug, err)
+		}
+
+		name := publication.Slug
+		if version.Data != nil && version.Data.Profile != nil {
+			profile := version.Data.Profile
+			name = profile.Login
+			if profile.Name != "" {
+				name = profile.Name
+			}
+		}
+		th := themes.Get(publication.Theme)
+		body, err := th.Body(theme.NewDocument(name, version.CV))
+		if err != nil {
+			log.Printf("Error rendering published CV: %v", err)
+			notFound()
+			return
+		}
+		c.HTML(http.StatusOK, "index.html", gin.H{
+			"title":    name + " - Developer CV",
+			"public":   true,
+			"cv":       body,
+			"themeCSS": th.CSS,
+			"noindex":  publication.Visibility != storage.VisibilityPublic,
+			"og": gin.H{
+				"title":       name + " - Developer CV",
+				"description": ogDescription(version.CV),
+				"url":         publicURL(c) + "/u/" + publication.Slug,
+			},
+		})
+	}
+	r.GET("/u/:slug", showPublication)
+	r.POST("/u/:slug", showPublication)
+
+	r.GET("/api/jobs/:id", func(c *gin.Context) {
+		job, ok := ownedJob(c, sessions, jobManager)
+		if !ok {
+			return
+		}
+
+		job.Touch()
+		info := job.Info()
+		if info.Status == jobs.StatusRunning {
+			sess, _ := sessions.Get(c)
+			sess.Lock()
+			login, _ := sess.User["login"].(string)
+			sess.Unlock()
+			info.QueuePosition = limits.Position(login)
+		}
+		c.JSON(http.StatusOK, info)
+	})
+
+	r.POST("/api/jobs/:id/cancel", func(c *gin.Context) {
+		job, ok := ownedJob(c, sessions, jobManager)
+		if !ok {
+			return
+		}
+
+		job.Cancel()
+		log.Printf("Cancelled job %s", job.ID)
+		c.JSON(http.StatusOK, job.Info())
+	})
+
+	admin := r.Group("/admin", adminAuth())
+	admin.GET("/usage", func(c *gin.Context) {
+		c.JSON(http.StatusOK, usageTracker.Summary())
+	})
+	admin.GET("/cache", func(c *gin.Context) {
+		c.JSON(http.StatusOK, cvService.CacheStats())
+	})
+	// The feedback of all users, aggregated by prompt version, model and
+	// mode, helps improve the prompt templates
+	admin.GET("/feedback", func(c *gin.Context) {
+		if versions == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "CV storage is disabled"})
+			return
+		}
+		feedback, err := versions.AllFeedback()
+		if err != nil {
+			log.Printf("Error listing feedback: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list feedback"})
+			return
+		}
+		c.JSON(http.StatusOK, storage.SummarizeFeedback(feedback, recentFeedback))
+	})
+
+	return r, nil
+}
+
+// setLoginOptions records whether the login connects another account and,
+// unless it does, the generation options of the request, whether private
+// repositories are included and whether the user reviews the data first in
+// the session. Private repositories are left out until the user chooses them
+// on the preview page.
+// The session must be locked.
+func setLoginOptions(c *gin.Context, sess *session.Session) bool {
+	sess.Connect = c.Request.FormValue("connect") != "" && len(sess.Accounts) > 0
+	if sess.Connect {
+		return true
+	}
+
+	sess.Private = c.Request.FormValue("private") != ""
+	sess.Review = sess.Private || c.Request.FormValue("review") != ""
+	sess.Privacy = services.PrivacyPolicy{Private: services.PrivateNone}
+	sess.Options = services.GenerateOptions{}
+	switch mode := c.Request.FormValue("mode"); mode {
+	case services.ModeSingle, services.ModePipeline, services.ModeTemplate:
+		sess.Options.Mode = mode
+	}
+	switch length := c.Request.FormValue("length"); length {
+	case services.LengthShort, services.LengthStandard, services.LengthLong:
+		sess.Options.Length = length
+	}
+	sess.Options.Force = c.Request.FormValue("force") != ""
+	sess.Options.Redact = c.Request.FormValue("redact") != ""
+	return false
+}
+
+// privacyPolicy returns the privacy policy chosen in the preview form: the
+// policy parameter and the URLs of the selected private repositories in repo
+func privacyPolicy(c *gin.Context) services.PrivacyPolicy {
+	policy := services.PrivacyPolicy{Private: services.ParsePrivate(c.Request.FormValue("policy"))}
+	if policy.Private == services.PrivateSelected {
+		policy.Selected = c.Request.Form["repo"]
+	}
+	return policy
+}
+
+// repositoryChoice is a private repository offered on the preview page
+type repositoryChoice struct {
+	models.Repository
+	Selected bool
+}
+
+// privateRepositoryChoices returns the private repositories in data, marking
+// those policy selects
+func privateRepositoryChoices(data *models.DeveloperData, policy services.PrivacyPolicy) []repositoryChoice {
+	var choices []repositoryChoice
+	for _, repo := range services.PrivateRepositories(data) {
+		choice := repositoryChoice{Repository: repo}
+		for _, url := range policy.Selected {
+			choice.Selected = choice.Selected || url == repo.HTMLURL
+		}
+		choices = append(choices, choice)
+	}
+	return choices
+}
+
+// publishedCV describes the publication of the user on the CV page
+type publishedCV struct {
+	*storage.Publication
+	URL     string
+	Expired bool
+}
+
+// publicationInfo returns the publication of owner, or nil if there is none
+func publicationInfo(c *gin.Context, versions storage.Store, owner string) *publishedCV {
+	if versions == nil || owner == "" {
+		return nil
+	}
+	publication, err := versions.UserPublication(owner)
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			log.Printf("Warning: failed to read publication of %s: %v", owner, err)
+		}
+		return nil
+	}
+	info := &publishedCV{
+		Publication: publication,
+		URL:         publicURL(c) + "/u/" + publication.Slug,
+		Expired:     publication.Expired(time.Now()),
+	}
+	if publication.Visibility == storage.VisibilityUnlisted {
+		info.URL += "?key=" + publication.Token
+	}
+	return info
+}
+
+// publicURL returns the URL the server is reached at: server.public_url if
+// configured, otherwise the host of the request
+func publicURL(c *gin.Context) string {
+	if url := viper.GetString("server.public_url"); url != "" {
+		return strings.TrimSuffix(url, "/")
+	}
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// ogDescription returns the link preview description of cv: the start of its
+// summary, or of the first section with content
+func ogDescription(cv *models.CV) string {
+	text := ""
+	if section := cv.Section(services.SectionSummary); section != nil {
+		text = section.Content
+	}
+	for i := 0; text == "" && i < len(cv.Sections); i++ {
+		text = cv.Sections[i].Content
+	}
+	text = strings.Join(strings.Fields(strings.NewReplacer("#", "", "*", "", "_", "", "`", "").Replace(text)), " ")
+	if runes := []rune(text); len(runes) > 200 {
+		text = strings.TrimSpace(string(runes[:197])) + "..."
+	}
+	return text
+}
+
+// versionDiff is the difference between the markdown of two CV versions
+type versionDiff struct {
+	From  *storage.Version   `json:"from"`
+	To    *storage.Version   `json:"to"`
+	Lines []storage.DiffLine `json:"lines"`
+}
+
+// diffVersions compares the versions from and to of owner
+func diffVersions(versions storage.Store, owner, from, to string) (*versionDiff, error) {
+	older, err := versions.Get(owner, from)
+	if err != nil {
+		return nil, err
+	}
+	newer, err := versions.Get(owner, to)
+	if err != nil {
+		return nil, err
+	}
+	return &versionDiff{
+		From:  older.Summary(),
+		To:    newer.Summary(),
+		Lines: storage.Diff(older.CV.Markdown(), newer.CV.Markdown()),
+	}, nil
+}
+
+// versionError returns the HTTP status and message of a storage error
+func versionError(err error) (int, string) {
+	if errors.Is(err, storage.ErrNotFound) {
+		return http.StatusNotFound, err.Error()
+	}
+	log.Printf("Error reading CV versions: %v", err)
+	return http.StatusInternalServerError, "Failed to read CV versions"
+}
+
+// addFeedback stores comment against the version id of owner, returning
+// ErrNotFound if the version does not exist. It does nothing without storage.
+func addFeedback(versions storage.Store, owner, id, comment string, revision bool) (*storage.Feedback, error) {
+	if versions == nil || owner == "" || id == "" {
+		return nil, nil
+	}
+	version, err := versions.Get(owner, id)
+	if err != nil {
+		return nil, err
+	}
+	feedback := storage.FeedbackFor(version, strings.TrimSpace(comment), revision)
+	if err := versions.AddFeedback(feedback); err != nil {
+		return nil, err
+	}
+	return feedback, nil
+}
+
+// versionFeedback returns the feedback of owner on the version id, or nil
+// without storage
+func versionFeedback(versions storage.Store, owner, id string) []*storage.Feedback {
+	if versions == nil || owner == "" || id == "" {
+		return nil
+	}
+	feedback, err := versions.Feedback(owner, id)
+	if err != nil {
+		log.Printf("Warning: failed to list feedback of %s: %v", owner, err)
+		return nil
+	}
+	return feedback
+}
+
+// sessionTheme returns the theme in the theme parameter of the request if it
+// exists, otherwise the theme chosen in the session
+func sessionTheme(c *gin.Context, themes *theme.Registry, sess *session.Session) *theme.Theme {
+	if name := c.Query("theme"); themes.Has(name) {
+		return themes.Get(name)
+	}
+	return themes.Get(sess.Theme)
+}
+
+// cvTitle returns the title of the CV document of user: their name or login
+func cvTitle(user map[string]interface{}) string {
+	if name, _ := user["name"].(string); name != "" {
+		return name
+	}
+	login, _ := user["login"].(string)
+	return login
+}
+
+// repositoryAccount returns the connected account on the host of repo. A
+// single connected account is assumed to own all repositories.
+func repositoryAccount(hosts auth.Hosts, accounts []session.Account, repo models.Repository) (session.Account, bool) {
+	for _, account := range accounts {
+		for _, host := range hosts {
+			if host.Name == account.Host && host.WebURL != "" && strings.HasPrefix(repo.HTMLURL, strings.TrimSuffix(host.WebURL, "/")+"/") {
+				return account, true
+			}
+		}
+	}
+	if len(accounts) == 1 {
+		return accounts[0], true
+	}
+	return session.Account{}, false
+}
+
+// contains reports whether list contains s
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// unconnectedHosts returns the hosts the user can still connect an account on
+func unconnectedHosts(hosts auth.Hosts, sess *session.Session) []*auth.Host {
+	var result []*auth.Host
+	for _, host := range hosts {
+		if !sess.HasAccount(host.Name) {
+			result = append(result, host)
+		}
+	}
+	return result
+}
+
+// generationError responds to a failed LLM generation: 429 when the budget
+// is spent, 503 when the queue is full or the model is unavailable, with
+// Retry-After when the queue is full, and 502 when the model failed
+func generationError(c *gin.Context, limits *limiter.Group, message string, err error) {
+	switch {
+	case errors.Is(err, usage.ErrBudgetExceeded):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+	case errors.Is(err, limiter.ErrQueueFull):
+		queueFull(c, limits)
+	case errors.Is(err, retry.ErrCircuitOpen):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": fmt.Sprintf("%s: %v", message, err)})
+	default:
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("%s: %v", message, err)})
+	}
+}
+
+// queueFull rejects a request because too many LLM calls are waiting
+func queueFull(c *gin.Context, limits *limiter.Group) {
+	c.Header("Retry-After", strconv.Itoa(int(limits.RetryAfter.Seconds())))
+	c.JSON(http.StatusServiceUnavailable, gin.H{"error": limiter.ErrQueueFull.Error()})
+}
+
+// cvChanged responds with a conflict and returns true when the CV of the
+// session is no longer cv, whose markdown sent was given to the LLM, e.g.
+// because of an edit or chat turn made while the LLM was working. The
+// session must be locked.
+func cvChanged(c *gin.Context, sess *session.Session, cv *models.CV, sent string) bool {
+	if sess.CV == cv && sess.CV.Markdown() == sent {
+		return false
+	}
+	c.JSON(http.StatusConflict, gin.H{"error": "The CV changed in the meantime, please try again"})
+	return true
+}
+
+// adminAuth only lets requests through that carry the admin.token from the
+// configuration as bearer token. Without a token the admin endpoints are disabled.
+func adminAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := viper.GetString("admin.token")
+		if token == "" || subtle.ConstantTimeCompare([]byte(c.GetHeader("Authorization")), []byte("Bearer "+token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// ownedJob looks up the job in the URL and checks it belongs to the current session
+func ownedJob(c *gin.Context, sessions *session.Store, jobManager *jobs.Manager) (*jobs.Job, bool) {
+	sess, ok := sessions.Get(c)
+	job, found := jobManager.Get(c.Param("id"))
+	if ok && found {
+		sess.Lock()
+		ok = job.Owner == sess.ID
+		sess.Unlock()
+	}
+	if !ok || !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return nil, false
+	}
+	return job, true
+}
@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// GetBitbucketAuthURL returns the OAuth authorization URL of Bitbucket Cloud.
+// Bitbucket redirects to the callback URL configured on the OAuth consumer.
+func GetBitbucketAuthURL(host *Host, state string) string {
+	params := url.Values{}
+	params.Add("client_id", host.ClientID)
+	params.Add("response_type", "code")
+	params.Add("state", state)
+
+	return fmt.Sprintf("%s/site/oauth2/authorize?%s", host.WebURL, params.Encode())
+}
+
+// ExchangeBitbucketCode exchanges the authorization code for an access token on Bitbucket Cloud
+func ExchangeBitbucketCode(ctx context.Context, host *Host, code string) (*Token, error) {
+	form := url.Values{}
+	form.Add("grant_type", "authorization_code")
+	form.Add("code", code)
+
+	return requestToken(ctx, host, host.WebURL+"/site/oauth2/access_token", form, true)
+}
+
+// GetBitbucketUserInfo retrieves the user's profile information from
+// Bitbucket Cloud, returning the username as login, the display name as name
+// and the avatar link as avatar_url, like on GitHub
+func GetBitbucketUserInfo(ctx context.Context, host *Host, accessToken string) (map[string]interface{}, error) {
+	userInfo, err := getUserInfo(ctx, host, host.APIURL+"/user", accessToken)
+	if err != nil {
+		return nil, err
+	}
+	userInfo["login"] = userInfo["username"]
+	userInfo["name"] = userInfo["display_name"]
+	if links, ok := userInfo["links"].(map[string]interface{}); ok {
+		if avatar, ok := links["avatar"].(map[string]interface{}); ok {
+			userInfo["avatar_url"] = avatar["href"]
+		}
+	}
+
+	return userInfo, nil
+}
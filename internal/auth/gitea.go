@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// GetGiteaAuthURL returns the OAuth authorization URL of a Gitea or Forgejo host
+func GetGiteaAuthURL(host *Host, state string) string {
+	params := url.Values{}
+	params.Add("client_id", host.ClientID)
+	params.Add("redirect_uri", host.RedirectURL)
+	params.Add("response_type", "code")
+	params.Add("scope", "read:user read:repository read:organization read:issue")
+	params.Add("state", state)
+
+	return fmt.Sprintf("%s/login/oauth/authorize?%s", host.WebURL, params.Encode())
+}
+
+// ExchangeGiteaCode exchanges the authorization code for an access token on a Gitea or Forgejo host
+func ExchangeGiteaCode(ctx context.Context, host *Host, code string) (*Token, error) {
+	form := url.Values{}
+	form.Add("client_id", host.ClientID)
+	form.Add("client_secret", host.ClientSecret)
+	form.Add("code", code)
+	form.Add("grant_type", "authorization_code")
+	form.Add("redirect_uri", host.RedirectURL)
+
+	return requestToken(ctx, host, host.WebURL+"/login/oauth/access_token", form, false)
+}
+
+// GetGiteaUserInfo retrieves the user's profile information from a Gitea or
+// Forgejo host. The full name is also returned as name, like on GitHub.
+func GetGiteaUserInfo(ctx context.Context, host *Host, accessToken string) (map[string]interface{}, error) {
+	userInfo, err := getUserInfo(ctx, host, host.APIURL+"/user", accessToken)
+	if err != nil {
+		return nil, err
+	}
+	userInfo["name"] = userInfo["full_name"]
+
+	return userInfo, nil
+}
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -10,7 +11,6 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/spf13/viper"
 )
 
 type GitHubUser struct {
@@ -21,13 +21,13 @@ type GitHubUser struct {
 }
 
 func GitHubLogin(c *gin.Context) {
-	clientID := viper.GetString("github.client_id")
-	redirectURL := viper.GetString("github.redirect_url")
+	host := DefaultHost()
 
 	url := fmt.Sprintf(
-		"https://github.com/login/oauth/authorize?client_id=%s&redirect_uri=%s&scope=user:email,repo",
-		clientID,
-		redirectURL,
+		"%s/login/oauth/authorize?client_id=%s&redirect_uri=%s&scope=user:email,repo",
+		host.WebURL,
+		host.ClientID,
+		host.RedirectURL,
 	)
 
 	log.Printf("Redirecting to GitHub OAuth URL: %s", url)
@@ -41,15 +41,17 @@ func GitHubCallback(c *gin.Context) {
 		return
 	}
 
+	host := DefaultHost()
+
 	// Exchange code for access token
-	token, err := ExchangeCodeForToken(code)
+	token, err := ExchangeCodeForToken(c.Request.Context(), host, code)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get access token"})
 		return
 	}
 
 	// Get user info
-	user, err := GetUserInfo(token)
+	user, err := GetUserInfo(c.Request.Context(), host, token.AccessToken)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user info"})
 		return
@@ -59,109 +61,148 @@ func GitHubCallback(c *gin.Context) {
 	c.JSON(http.StatusOK, user)
 }
 
-// GetGitHubAuthURL returns the GitHub OAuth authorization URL
-func GetGitHubAuthURL() string {
-	clientID := viper.GetString("github.client_id")
-	redirectURL := viper.GetString("github.redirect_url")
+// GetGitHubAuthURL returns the OAuth authorization URL of host. OAuth apps
+// only get the repo scope, which grants write access to every private
+// repository, when private is set. GitHub Apps have no scopes: their
+// permissions are read-only and private repositories are only readable once
+// the user installs the app on the repositories they choose, so with private
+// set the user is sent to the installation page, which signs them in as well.
+func GetGitHubAuthURL(host *Host, private bool, state string) string {
+	if host.App != nil && private && host.App.Slug != "" {
+		return host.App.InstallURL(state)
+	}
 
 	params := url.Values{}
-	params.Add("client_id", clientID)
-	params.Add("redirect_uri", redirectURL)
-	params.Add("scope", "user repo read:org")
-
-	return fmt.Sprintf("https://github.com/login/oauth/authorize?%s", params.Encode())
+	params.Add("client_id", host.ClientID)
+	params.Add("redirect_uri", host.RedirectURL)
+	params.Add("state", state)
+	if host.App == nil {
+		scope := "read:user read:org"
+		if private {
+			scope += " repo"
+		}
+		params.Add("scope", scope)
+	}
+
+	return fmt.Sprintf("%s/login/oauth/authorize?%s", host.WebURL, params.Encode())
 }
 
-// ExchangeCodeForToken exchanges the authorization code for an access token
-func ExchangeCodeForToken(code string) (string, error) {
-	clientID := viper.GetString("github.client_id")
-	clientSecret := viper.GetString("github.client_secret")
-	redirectURL := viper.GetString("github.redirect_url")
-
+// ExchangeCodeForToken exchanges the authorization code for an access token on host
+func ExchangeCodeForToken(ctx context.Context, host *Host, code string) (*Token, error) {
 	// Create form data
 	form := url.Values{}
-	form.Add("client_id", clientID)
-	form.Add("client_secret", clientSecret)
+	form.Add("client_id", host.ClientID)
+	form.Add("client_secret", host.ClientSecret)
 	form.Add("code", code)
-	form.Add("redirect_uri", redirectURL)
+	form.Add("redirect_uri", host.RedirectURL)
 
+	return requestGitHubToken(ctx, host, form)
+}
+
+// requestGitHubToken posts a token request to host. GitHub App user-to-server
+// tokens expire and come with a refresh token, OAuth app tokens do not.
+func requestGitHubToken(ctx context.Context, host *Host, form url.Values) (*Token, error) {
 	// Create request
-	req, err := http.NewRequest("POST", "https://github.com/login/oauth/access_token", strings.NewReader(form.Encode()))
+	req, err := http.NewRequestWithContext(ctx, "POST", host.WebURL+"/login/oauth/access_token", strings.NewReader(form.Encode()))
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %v", err)
+		return nil, fmt.Errorf("failed to create request: %v", err)
 	}
 
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
 	// Make request
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := host.Client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to make request: %v", err)
+		return nil, fmt.Errorf("failed to make request: %v", err)
 	}
 	defer resp.Body.Close()
 
 	// Read response
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response: %v", err)
+		return nil, fmt.Errorf("failed to read response: %v", err)
 	}
 
+	// The body holds the tokens and is never logged
 	log.Printf("GitHub OAuth response status: %d", resp.StatusCode)
-	log.Printf("GitHub OAuth response body: %s", string(body))
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to get access token: %s", string(body))
+		return nil, fmt.Errorf("failed to get access token: status %d", resp.StatusCode)
 	}
 
 	// Parse response
 	var tokenResp struct {
-		AccessToken string `json:"access_token"`
-		TokenType   string `json:"token_type"`
-		Scope       string `json:"scope"`
+		AccessToken      string `json:"access_token"`
+		RefreshToken     string `json:"refresh_token"`
+		ExpiresIn        int    `json:"expires_in"`
+		TokenType        string `json:"token_type"`
+		Scope            string `json:"scope"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
 	}
 
 	if err := json.Unmarshal(body, &tokenResp); err != nil {
-		return "", fmt.Errorf("failed to parse response: %v", err)
+		return nil, fmt.Errorf("failed to parse response: %v", err)
 	}
 
-	return tokenResp.AccessToken, nil
+	// GitHub reports a rejected code or client with status 200
+	if tokenResp.Error != "" {
+		return nil, fmt.Errorf("failed to get access token: %s %s", tokenResp.Error, tokenResp.ErrorDescription)
+	}
+
+	return newToken(tokenResp.AccessToken, tokenResp.RefreshToken, tokenResp.ExpiresIn), nil
 }
 
-// GetGitHubUserInfo retrieves the user's GitHub profile information
-func GetGitHubUserInfo(accessToken string) (map[string]interface{}, error) {
-	req, err := http.NewRequest("GET", "https://api.github.com/user", nil)
+// GetGitHubUserInfo retrieves the user's profile information from host
+func GetGitHubUserInfo(ctx context.Context, host *Host, accessToken string) (map[string]interface{}, error) {
+	userInfo, _, err := getGitHubUser(ctx, host, accessToken)
+	return userInfo, err
+}
+
+// getGitHubUser retrieves the user's profile information from host along with
+// the OAuth scopes of accessToken, nil if GitHub does not report them
+func getGitHubUser(ctx context.Context, host *Host, accessToken string) (map[string]interface{}, []string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", host.APIURL+"/user", nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %v", err)
+		return nil, nil, fmt.Errorf("failed to create request: %v", err)
 	}
 
 	req.Header.Set("Authorization", "token "+accessToken)
 	req.Header.Set("Accept", "application/vnd.github.v3+json")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := host.Client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to make request: %v", err)
+		return nil, nil, fmt.Errorf("failed to make request: %v", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("failed to get user info: %s", string(body))
+		return nil, nil, fmt.Errorf("failed to get user info: %s", string(body))
 	}
 
 	var userInfo map[string]interface{}
 	if err := json.NewDecoder(resp.Body).Decode(&userInfo); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %v", err)
+		return nil, nil, fmt.Errorf("failed to parse response: %v", err)
+	}
+
+	var scopes []string
+	if header, ok := resp.Header["X-Oauth-Scopes"]; ok {
+		scopes = []string{}
+		for _, scope := range strings.Split(strings.Join(header, ","), ",") {
+			if scope = strings.TrimSpace(scope); scope != "" {
+				scopes = append(scopes, scope)
+			}
+		}
 	}
 
-	return userInfo, nil
+	return userInfo, scopes, nil
 }
 
-// GetUserInfo retrieves the GitHub user information using the access token
-func GetUserInfo(token string) (*GitHubUser, error) {
-	req, err := http.NewRequest("GET", "https://api.github.com/user", nil)
+// GetUserInfo retrieves the user information from host using the access token
+func GetUserInfo(ctx context.Context, host *Host, token string) (*GitHubUser, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", host.APIURL+"/user", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -169,8 +210,7 @@ func GetUserInfo(token string) (*GitHubUser, error) {
 	req.Header.Set("Authorization", "token "+token)
 	req.Header.Set("Accept", "application/vnd.github.v3+json")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := host.Client.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// App is a GitHub App. Users sign in to it with user-to-server tokens limited
+// to the app's read-only permissions, and it mints installation tokens with
+// JWTs signed by its private key to read the repositories users granted it.
+type App struct {
+	ID   int64
+	Slug string
+
+	host *Host
+	key  *rsa.PrivateKey
+
+	mu     sync.Mutex
+	tokens map[int64]*Token
+}
+
+// NewApp creates the GitHub App id of host from its PEM encoded private key,
+// as downloaded from the app settings (PKCS #1) or converted to PKCS #8
+func NewApp(host *Host, id int64, slug string, keyPEM []byte) (*App, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in private key of app %d", id)
+	}
+
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		parsed, err8 := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err8 != nil {
+			return nil, fmt.Errorf("failed to parse private key of app %d: %v", id, err)
+		}
+		var ok bool
+		if key, ok = parsed.(*rsa.PrivateKey); !ok {
+			return nil, fmt.Errorf("private key of app %d is not an RSA key", id)
+		}
+	}
+
+	return &App{
+		ID:     id,
+		Slug:   slug,
+		host:   host,
+		key:    key,
+		tokens: make(map[int64]*Token),
+	}, nil
+}
+
+// InstallURL returns the page where users install the app and choose the
+// repositories it can read, passing state on to the callback
+func (a *App) InstallURL(state string) string {
+	return fmt.Sprintf("%s/apps/%s/installations/new?%s", a.host.WebURL, a.Slug, url.Values{"state": {state}}.Encode())
+}
+
+// JWT returns a JSON Web Token authenticating as the app, signed with RS256.
+// It is issued a minute in the past to allow for clock drift and expires
+// after ten minutes, the longest GitHub accepts.
+func (a *App) JWT(now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": strconv.FormatInt(a.ID, 10),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign JWT: %v", err)
+	}
+
+	return unsigned + "." + enc.EncodeToString(signature), nil
+}
+
+// InstallationToken returns an access token for the installation id, minting
+// a new one when the cached token is about to expire. The cache is not locked
+// while minting, so a slow GitHub doesn't hold up other installations;
+// concurrent calls may each mint a token, and the last one is cached.
+func (a *App) InstallationToken(ctx context.Context, id int64) (string, error) {
+	a.mu.Lock()
+	token, ok := a.tokens[id]
+	a.mu.Unlock()
+	if ok && !token.Expired() {
+		return token.AccessToken, nil
+	}
+
+	token, err := a.mintInstallationToken(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	a.mu.Lock()
+	a.tokens[id] = token
+	a.mu.Unlock()
+	return token.AccessToken, nil
+}
+
+// mintInstallationToken requests a new access token for the installation id
+func (a *App) mintInstallationToken(ctx context.Context, id int64) (*Token, error) {
+	jwt, err := a.JWT(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("%s/app/installations/%d/access_tokens", a.host.APIURL, id)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	resp, err := a.host.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to create installation token: %s", string(body))
+	}
+
+	var tokenResp struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %v", err)
+	}
+
+	return &Token{AccessToken: tokenResp.Token, Expiry: tokenResp.ExpiresAt}, nil
+}
+
+// ErrForeignInstallation is returned for installations the user cannot access
+var ErrForeignInstallation = errors.New("the installation does not belong to the user")
+
+// UserInstallation returns the ID of an installation of the app that the
+// user-to-server token can access: id if it is set and accessible, otherwise
+// the installation on the account of login, 0 if the user has not installed
+// the app. An id the user cannot access returns ErrForeignInstallation.
+func (a *App) UserInstallation(ctx context.Context, accessToken, login string, id int64) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", a.host.APIURL+"/user/installations", nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	req.Header.Set("Authorization", "token "+accessToken)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	resp, err := a.host.Client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return 0, fmt.Errorf("failed to list installations: %s", string(body))
+	}
+
+	var page struct {
+		Installations []struct {
+			ID      int64 `json:"id"`
+			Account struct {
+				Login string `json:"login"`
+			} `json:"account"`
+		} `json:"installations"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return 0, fmt.Errorf("failed to parse response: %v", err)
+	}
+
+	for _, installation := range page.Installations {
+		if id != 0 && installation.ID == id {
+			return id, nil
+		}
+		if id == 0 && installation.Account.Login == login {
+			return installation.ID, nil
+		}
+	}
+	if id != 0 {
+		return 0, ErrForeignInstallation
+	}
+	return 0, nil
+}
@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// GetGitLabAuthURL returns the OAuth authorization URL of a GitLab host
+func GetGitLabAuthURL(host *Host, state string) string {
+	params := url.Values{}
+	params.Add("client_id", host.ClientID)
+	params.Add("redirect_uri", host.RedirectURL)
+	params.Add("response_type", "code")
+	params.Add("scope", "read_user read_api")
+	params.Add("state", state)
+
+	return fmt.Sprintf("%s/oauth/authorize?%s", host.WebURL, params.Encode())
+}
+
+// ExchangeGitLabCode exchanges the authorization code for an access token on a GitLab host
+func ExchangeGitLabCode(ctx context.Context, host *Host, code string) (*Token, error) {
+	form := url.Values{}
+	form.Add("client_id", host.ClientID)
+	form.Add("client_secret", host.ClientSecret)
+	form.Add("code", code)
+	form.Add("grant_type", "authorization_code")
+	form.Add("redirect_uri", host.RedirectURL)
+
+	return requestToken(ctx, host, host.WebURL+"/oauth/token", form, false)
+}
+
+// requestToken posts an OAuth 2 token request and returns the token.
+// With basicAuth the client credentials are sent as basic authentication.
+func requestToken(ctx context.Context, host *Host, tokenURL string, form url.Values, basicAuth bool) (*Token, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if basicAuth {
+		req.SetBasicAuth(host.ClientID, host.ClientSecret)
+	}
+
+	resp, err := host.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+
+	var tokenResp struct {
+		AccessToken      string `json:"access_token"`
+		RefreshToken     string `json:"refresh_token"`
+		ExpiresIn        int    `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || tokenResp.AccessToken == "" {
+		return nil, fmt.Errorf("failed to get access token: %s %s", tokenResp.Error, tokenResp.ErrorDescription)
+	}
+
+	return newToken(tokenResp.AccessToken, tokenResp.RefreshToken, tokenResp.ExpiresIn), nil
+}
+
+// newToken returns a token expiring expiresIn seconds from now, or never if
+// expiresIn is 0
+func newToken(accessToken, refreshToken string, expiresIn int) *Token {
+	token := &Token{AccessToken: accessToken, RefreshToken: refreshToken}
+	if expiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(expiresIn) * time.Second)
+	}
+	return token
+}
+
+// getUserInfo retrieves the token owner's profile from userURL
+func getUserInfo(ctx context.Context, host *Host, userURL, accessToken string) (map[string]interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", userURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := host.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to get user info: %s", string(body))
+	}
+
+	var userInfo map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&userInfo); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %v", err)
+	}
+
+	return userInfo, nil
+}
+
+// GetGitLabUserInfo retrieves the user's profile information from a GitLab
+// host. The username is also returned as login, like on GitHub.
+func GetGitLabUserInfo(ctx context.Context, host *Host, accessToken string) (map[string]interface{}, error) {
+	userInfo, err := getUserInfo(ctx, host, host.APIURL+"/user", accessToken)
+	if err != nil {
+		return nil, err
+	}
+	userInfo["login"] = userInfo["username"]
+
+	return userInfo, nil
+}
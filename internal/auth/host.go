@@ -0,0 +1,371 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Host types
+const (
+	TypeGitHub    = "github"
+	TypeGitLab    = "gitlab"
+	TypeGitea     = "gitea"
+	TypeBitbucket = "bitbucket"
+)
+
+// hostTypes lists the host types in the order their hosts are offered
+var hostTypes = []string{TypeGitHub, TypeGitLab, TypeGitea, TypeBitbucket}
+
+// Default endpoints
+const (
+	DefaultGitHubWebURL    = "https://github.com"
+	DefaultGitHubAPIURL    = "https://api.github.com"
+	DefaultGitLabWebURL    = "https://gitlab.com"
+	DefaultGiteaWebURL     = "https://codeberg.org"
+	DefaultBitbucketWebURL = "https://bitbucket.org"
+	DefaultBitbucketAPIURL = "https://api.bitbucket.org/2.0"
+)
+
+// HostConfig describes a GitHub or GitHub Enterprise Server, GitLab,
+// Gitea or Forgejo, or Bitbucket Cloud instance
+type HostConfig struct {
+	Name         string `mapstructure:"name"`
+	Type         string `mapstructure:"type"`
+	WebURL       string `mapstructure:"web_url"`
+	APIURL       string `mapstructure:"api_url"`
+	GraphQLURL   string `mapstructure:"graphql_url"`
+	ClientID     string `mapstructure:"client_id"`
+	ClientSecret string `mapstructure:"client_secret"`
+	RedirectURL  string `mapstructure:"redirect_url"`
+	// Token is a personal access token used instead of OAuth, for
+	// single-user and CI deployments. Visitors only sign in with it after
+	// giving TokenPassword through HTTP basic authentication.
+	Token         string `mapstructure:"token"`
+	TokenPassword string `mapstructure:"token_password"`
+	// CAFile is a PEM bundle trusted in addition to the system roots
+	CAFile string `mapstructure:"ca_file"`
+	// AppID, AppSlug and PrivateKeyFile configure a GitHub App used instead
+	// of an OAuth app; ClientID and ClientSecret are then the app's
+	AppID          int64  `mapstructure:"app_id"`
+	AppSlug        string `mapstructure:"app_slug"`
+	PrivateKeyFile string `mapstructure:"private_key_file"`
+}
+
+// Host is a configured code hosting instance with its resolved endpoints and
+// an HTTP client trusting its CA bundle
+type Host struct {
+	Name         string
+	Type         string
+	WebURL       string
+	APIURL       string
+	GraphQLURL   string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Token        string
+	// TokenPassword guards sign-ins with Token
+	TokenPassword string
+	// App is the GitHub App users sign in to, nil in OAuth app mode
+	App    *App
+	Client *http.Client
+}
+
+// NewHost resolves the endpoints of config. Self-hosted instances only need a
+// web URL: on GitHub Enterprise Server the REST API defaults to
+// <web_url>/api/v3 and GraphQL to <web_url>/api/graphql, on GitLab the API
+// defaults to <web_url>/api/v4 and on Gitea and Forgejo to <web_url>/api/v1.
+func NewHost(config HostConfig) (*Host, error) {
+	h := &Host{
+		Name:          config.Name,
+		Type:          config.Type,
+		WebURL:        strings.TrimSuffix(config.WebURL, "/"),
+		APIURL:        strings.TrimSuffix(config.APIURL, "/"),
+		GraphQLURL:    config.GraphQLURL,
+		ClientID:      config.ClientID,
+		ClientSecret:  config.ClientSecret,
+		RedirectURL:   config.RedirectURL,
+		Token:         config.Token,
+		TokenPassword: config.TokenPassword,
+		Client:        &http.Client{},
+	}
+	if h.Type == "" {
+		h.Type = TypeGitHub
+	}
+	if h.Name == "" {
+		h.Name = h.Type
+	}
+	if h.RedirectURL == "" {
+		h.RedirectURL = viper.GetString(h.Type + ".redirect_url")
+	}
+
+	switch h.Type {
+	case TypeGitHub:
+		enterprise := h.WebURL != "" && h.WebURL != DefaultGitHubWebURL
+		if h.WebURL == "" {
+			h.WebURL = DefaultGitHubWebURL
+		}
+		if h.APIURL == "" {
+			if enterprise {
+				h.APIURL = h.WebURL + "/api/v3"
+			} else {
+				h.APIURL = DefaultGitHubAPIURL
+			}
+		}
+		if h.GraphQLURL == "" {
+			if enterprise && strings.HasSuffix(h.APIURL, "/api/v3") {
+				h.GraphQLURL = strings.TrimSuffix(h.APIURL, "/v3") + "/graphql"
+			} else {
+				h.GraphQLURL = h.APIURL + "/graphql"
+			}
+		}
+	case TypeGitLab:
+		if h.WebURL == "" {
+			h.WebURL = DefaultGitLabWebURL
+		}
+		if h.APIURL == "" {
+			h.APIURL = h.WebURL + "/api/v4"
+		}
+		if h.GraphQLURL == "" {
+			h.GraphQLURL = h.WebURL + "/api/graphql"
+		}
+	case TypeGitea:
+		if h.WebURL == "" {
+			h.WebURL = DefaultGiteaWebURL
+		}
+		if h.APIURL == "" {
+			h.APIURL = h.WebURL + "/api/v1"
+		}
+	case TypeBitbucket:
+		if h.WebURL == "" {
+			h.WebURL = DefaultBitbucketWebURL
+		}
+		if h.APIURL == "" {
+			h.APIURL = DefaultBitbucketAPIURL
+		}
+	default:
+		return nil, fmt.Errorf("unknown type %q for host %s", h.Type, h.Name)
+	}
+
+	// Anyone reaching the server could otherwise sign in as the token's owner
+	if h.Token != "" && h.TokenPassword == "" {
+		return nil, fmt.Errorf("host %s: a token requires a token_password", h.Name)
+	}
+
+	if config.CAFile != "" {
+		pem, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle for %s: %v", h.Name, err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", config.CAFile)
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+		h.Client = &http.Client{Transport: transport}
+	}
+
+	if config.AppID != 0 {
+		if h.Type != TypeGitHub {
+			return nil, fmt.Errorf("host %s: GitHub Apps are only supported on GitHub", h.Name)
+		}
+		key, err := os.ReadFile(config.PrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read private key of %s: %v", h.Name, err)
+		}
+		app, err := NewApp(h, config.AppID, config.AppSlug, key)
+		if err != nil {
+			return nil, err
+		}
+		h.App = app
+	}
+
+	return h, nil
+}
+
+// Hosts is the list of instances users can connect, in order of preference
+type Hosts []*Host
+
+// hostConfig returns the host configured directly under the section for typ
+func hostConfig(typ string) HostConfig {
+	return HostConfig{
+		Name:           viper.GetString(typ + ".name"),
+		Type:           typ,
+		WebURL:         viper.GetString(typ + ".web_url"),
+		APIURL:         viper.GetString(typ + ".api_url"),
+		GraphQLURL:     viper.GetString(typ + ".graphql_url"),
+		ClientID:       viper.GetString(typ + ".client_id"),
+		ClientSecret:   viper.GetString(typ + ".client_secret"),
+		RedirectURL:    viper.GetString(typ + ".redirect_url"),
+		Token:          viper.GetString(typ + ".token"),
+		TokenPassword:  viper.GetString(typ + ".token_password"),
+		CAFile:         viper.GetString(typ + ".ca_file"),
+		AppID:          viper.GetInt64(typ + ".app_id"),
+		AppSlug:        viper.GetString(typ + ".app_slug"),
+		PrivateKeyFile: viper.GetString(typ + ".private_key_file"),
+	}
+}
+
+// HostsFromConfig creates the hosts configured under github, gitlab, gitea
+// and bitbucket. Each section configures one host directly, followed by the
+// hosts listed under <section>.hosts. The GitHub host is always present, the
+// others only when their client_id or token is set.
+func HostsFromConfig() (Hosts, error) {
+	var configs []HostConfig
+	for _, typ := range hostTypes {
+		if typ == TypeGitHub || viper.GetString(typ+".client_id") != "" || viper.GetString(typ+".token") != "" {
+			configs = append(configs, hostConfig(typ))
+		}
+
+		var more []HostConfig
+		if err := viper.UnmarshalKey(typ+".hosts", &more); err != nil {
+			return nil, fmt.Errorf("invalid %s.hosts configuration: %v", typ, err)
+		}
+		for _, config := range more {
+			if config.Type == "" {
+				config.Type = typ
+			}
+			configs = append(configs, config)
+		}
+	}
+
+	var hosts Hosts
+	for _, config := range configs {
+		h, err := NewHost(config)
+		if err != nil {
+			return nil, err
+		}
+		if hosts.Get(h.Name) != nil {
+			return nil, fmt.Errorf("duplicate host %q", h.Name)
+		}
+		hosts = append(hosts, h)
+	}
+	return hosts, nil
+}
+
+// Get returns the host with the given name, nil if there is none
+func (hosts Hosts) Get(name string) *Host {
+	for _, h := range hosts {
+		if h.Name == name {
+			return h
+		}
+	}
+	return nil
+}
+
+// First returns the first host of type typ, nil if there is none
+func (hosts Hosts) First(typ string) *Host {
+	for _, h := range hosts {
+		if h.Type == typ {
+			return h
+		}
+	}
+	return nil
+}
+
+// DefaultHost creates the host configured directly under github. An
+// unreadable CA bundle is logged and the system roots are used instead.
+func DefaultHost() *Host {
+	config := hostConfig(TypeGitHub)
+	h, err := NewHost(config)
+	if err != nil {
+		log.Printf("Warning: %v", err)
+		config.CAFile = ""
+		h, _ = NewHost(config)
+	}
+	return h
+}
+
+// Token is an OAuth access token along with the refresh token of expiring
+// tokens, such as GitHub App user-to-server tokens
+type Token struct {
+	AccessToken  string
+	RefreshToken string
+	// Expiry is zero for tokens that do not expire
+	Expiry time.Time
+}
+
+// Expired reports whether the token expires within the next minute
+func (t *Token) Expired() bool {
+	return !t.Expiry.IsZero() && time.Until(t.Expiry) < time.Minute
+}
+
+// AuthURL returns the OAuth authorization URL of host, which redirects back
+// with state. With private set, the user is asked for access to private
+// repositories as well.
+func AuthURL(host *Host, private bool, state string) string {
+	switch host.Type {
+	case TypeGitLab:
+		return GetGitLabAuthURL(host, state)
+	case TypeGitea:
+		return GetGiteaAuthURL(host, state)
+	case TypeBitbucket:
+		return GetBitbucketAuthURL(host, state)
+	}
+	return GetGitHubAuthURL(host, private, state)
+}
+
+// ExchangeCode exchanges the authorization code for an access token on host
+func ExchangeCode(ctx context.Context, host *Host, code string) (*Token, error) {
+	switch host.Type {
+	case TypeGitLab:
+		return ExchangeGitLabCode(ctx, host, code)
+	case TypeGitea:
+		return ExchangeGiteaCode(ctx, host, code)
+	case TypeBitbucket:
+		return ExchangeBitbucketCode(ctx, host, code)
+	}
+	return ExchangeCodeForToken(ctx, host, code)
+}
+
+// RefreshToken exchanges the refresh token of an expiring access token for a
+// new token on host
+func RefreshToken(ctx context.Context, host *Host, refreshToken string) (*Token, error) {
+	form := url.Values{}
+	form.Add("grant_type", "refresh_token")
+	form.Add("refresh_token", refreshToken)
+
+	switch host.Type {
+	case TypeGitLab:
+		form.Add("client_id", host.ClientID)
+		form.Add("client_secret", host.ClientSecret)
+		form.Add("redirect_uri", host.RedirectURL)
+		return requestToken(ctx, host, host.WebURL+"/oauth/token", form, false)
+	case TypeGitea:
+		form.Add("client_id", host.ClientID)
+		form.Add("client_secret", host.ClientSecret)
+		return requestToken(ctx, host, host.WebURL+"/login/oauth/access_token", form, false)
+	case TypeBitbucket:
+		return requestToken(ctx, host, host.WebURL+"/site/oauth2/access_token", form, true)
+	}
+	form.Add("client_id", host.ClientID)
+	form.Add("client_secret", host.ClientSecret)
+	return requestGitHubToken(ctx, host, form)
+}
+
+// UserInfo retrieves the profile of the token's owner on host. The user name
+// is returned as login and the display name as name whatever the host type.
+func UserInfo(ctx context.Context, host *Host, accessToken string) (map[string]interface{}, error) {
+	switch host.Type {
+	case TypeGitLab:
+		return GetGitLabUserInfo(ctx, host, accessToken)
+	case TypeGitea:
+		return GetGiteaUserInfo(ctx, host, accessToken)
+	case TypeBitbucket:
+		return GetBitbucketUserInfo(ctx, host, accessToken)
+	}
+	return GetGitHubUserInfo(ctx, host, accessToken)
+}
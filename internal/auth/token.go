@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+)
+
+// ScopeRequirement is a classic token scope needed to collect all data
+type ScopeRequirement struct {
+	Scope string
+	// Implied lists broader scopes that include Scope
+	Implied []string
+	// Without describes what is missing from the CV without the scope
+	Without string
+}
+
+// RequiredScopes are the scopes a GitHub personal access token should have.
+// The repo scope is left out: it grants write access, and private
+// repositories are opt-in through the read-only GitHub App.
+var RequiredScopes = []ScopeRequirement{
+	{Scope: "read:user", Implied: []string{"user"}, Without: "private profile details are not included"},
+	{Scope: "read:org", Implied: []string{"write:org", "admin:org"}, Without: "private organization memberships are not included"},
+}
+
+// TokenInfo describes a validated personal access token
+type TokenInfo struct {
+	// User is the token owner's profile, with the user name as login
+	User map[string]interface{}
+	// Scopes are the scopes of a classic GitHub token, nil when they cannot
+	// be inspected, as for fine-grained tokens and other host types
+	Scopes []string
+	// Warnings explain what the CV lacks because of missing scopes
+	Warnings []string
+}
+
+// ValidateToken checks accessToken by fetching its owner's profile from host.
+// On GitHub the scopes of classic tokens are compared to RequiredScopes.
+func ValidateToken(ctx context.Context, host *Host, accessToken string) (*TokenInfo, error) {
+	if host.Type != TypeGitHub {
+		user, err := UserInfo(ctx, host, accessToken)
+		if err != nil {
+			return nil, fmt.Errorf("invalid token: %v", err)
+		}
+		return &TokenInfo{User: user}, nil
+	}
+
+	user, scopes, err := getGitHubUser(ctx, host, accessToken)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token: %v", err)
+	}
+
+	info := &TokenInfo{User: user, Scopes: scopes}
+	if scopes == nil {
+		info.Warnings = append(info.Warnings, "The permissions of fine-grained tokens cannot be inspected: grant read-only access to your profile, organizations and repositories to include all your activity")
+		return info, nil
+	}
+	for _, req := range RequiredScopes {
+		if !hasScope(scopes, req) {
+			info.Warnings = append(info.Warnings, fmt.Sprintf("The token lacks the %s scope: %s", req.Scope, req.Without))
+		}
+	}
+	return info, nil
+}
+
+// hasScope reports whether scopes include req or a broader scope
+func hasScope(scopes []string, req ScopeRequirement) bool {
+	for _, scope := range scopes {
+		if scope == req.Scope {
+			return true
+		}
+		for _, implied := range req.Implied {
+			if scope == implied {
+				return true
+			}
+		}
+	}
+	return false
+}
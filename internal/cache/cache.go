@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Store is a key-value cache with per-entry expiry
+type Store interface {
+	// Get returns the value stored under key, if present and not expired
+	Get(key string) ([]byte, bool, error)
+	// Set stores value under key for ttl, 0 meaning no expiry
+	Set(key string, value []byte, ttl time.Duration) error
+	// Delete removes the entry stored under key
+	Delete(key string) error
+}
+
+// NewStoreFromConfig creates the store selected by cache.backend: "memory"
+// (the default), "disk" or "none". It returns nil when caching is disabled.
+func NewStoreFromConfig() (Store, error) {
+	switch backend := viper.GetString("cache.backend"); backend {
+	case "", "memory":
+		size := viper.GetInt("cache.size")
+		if size <= 0 {
+			size = 1000
+		}
+		return NewMemory(size), nil
+	case "disk":
+		dir := viper.GetString("cache.dir")
+		if dir == "" {
+			dir = "cache"
+		}
+		return NewDisk(dir)
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown cache backend %q", backend)
+	}
+}
+
+// expiry returns the expiry time for ttl, the zero time meaning no expiry
+func expiry(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
+func expired(expires time.Time) bool {
+	return !expires.IsZero() && time.Now().After(expires)
+}
@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMemoryEvictsLeastRecentlyUsed(t *testing.T) {
+	m := NewMemory(2)
+	m.Set("a", []byte("1"), 0)
+	m.Set("b", []byte("2"), 0)
+	// Reading a makes b the least recently used entry
+	if _, ok, _ := m.Get("a"); !ok {
+		t.Fatal("a missing before eviction")
+	}
+	m.Set("c", []byte("3"), 0)
+
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		if _, ok, _ := m.Get(key); ok != want {
+			t.Errorf("Get(%s) found %v, want %v", key, ok, want)
+		}
+	}
+
+	// Overwriting an entry does not evict another one
+	m.Set("c", []byte("4"), 0)
+	if value, ok, _ := m.Get("c"); !ok || string(value) != "4" {
+		t.Errorf("got %q, %v for the overwritten entry", value, ok)
+	}
+	if _, ok, _ := m.Get("a"); !ok {
+		t.Error("overwriting an entry evicted another one")
+	}
+}
+
+func TestMemoryExpiry(t *testing.T) {
+	m := NewMemory(10)
+	m.Set("short", []byte("1"), 10*time.Millisecond)
+	m.Set("forever", []byte("2"), 0)
+
+	time.Sleep(20 * time.Millisecond)
+	if _, ok, _ := m.Get("short"); ok {
+		t.Error("expired entry returned")
+	}
+	if _, ok, _ := m.Get("forever"); !ok {
+		t.Error("entry without expiry missing")
+	}
+	if _, ok := m.entries["short"]; ok {
+		t.Error("expired entry not removed")
+	}
+
+	m.Delete("forever")
+	if _, ok, _ := m.Get("forever"); ok {
+		t.Error("deleted entry returned")
+	}
+}
+
+func TestDisk(t *testing.T) {
+	dir := t.TempDir()
+	d, err := NewDisk(filepath.Join(dir, "cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Set("key", []byte("value"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if value, ok, err := d.Get("key"); err != nil || !ok || string(value) != "value" {
+		t.Errorf("got %q, %v, %v", value, ok, err)
+	}
+	if value, ok, err := d.Get("missing"); err != nil || ok {
+		t.Errorf("got %q, %v, %v for a missing entry", value, ok, err)
+	}
+
+	// Keys cannot escape the directory
+	if err := d.Set("../escape", []byte("x"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escape.json")); !os.IsNotExist(err) {
+		t.Error("entry written outside the cache directory")
+	}
+
+	if err := d.Delete("key"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Delete("key"); err != nil {
+		t.Errorf("deleting a missing entry: %v", err)
+	}
+}
+
+func TestDiskExpiry(t *testing.T) {
+	d, err := NewDisk(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Set("short", []byte("1"), 10*time.Millisecond)
+
+	time.Sleep(20 * time.Millisecond)
+	if _, ok, err := d.Get("short"); ok || err != nil {
+		t.Errorf("got %v, %v for an expired entry", ok, err)
+	}
+	if _, err := os.Stat(d.path("short")); !os.IsNotExist(err) {
+		t.Error("expired entry not removed")
+	}
+}
+
+func TestDiskCorruptEntry(t *testing.T) {
+	d, err := NewDisk(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(d.path("corrupt"), []byte(`{"expires": `), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok, err := d.Get("corrupt"); ok || err == nil {
+		t.Errorf("got %v, %v for a corrupt entry, want an error", ok, err)
+	}
+	// A corrupt entry is replaced by the next Set
+	if err := d.Set("corrupt", []byte("fixed"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if value, ok, err := d.Get("corrupt"); err != nil || !ok || string(value) != "fixed" {
+		t.Errorf("got %q, %v, %v after rewriting the entry", value, ok, err)
+	}
+}
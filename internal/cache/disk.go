@@ -0,0 +1,86 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Disk stores entries as JSON files in a directory
+type Disk struct {
+	dir string
+}
+
+type diskEntry struct {
+	Expires time.Time `json:"expires"`
+	Value   []byte    `json:"value"`
+}
+
+// NewDisk creates a store in dir, creating the directory if needed
+func NewDisk(dir string) (*Disk, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %v", err)
+	}
+	return &Disk{dir: dir}, nil
+}
+
+// Get implements Store
+func (d *Disk) Get(key string) ([]byte, bool, error) {
+	data, err := os.ReadFile(d.path(key))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	var entry diskEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, false, fmt.Errorf("corrupt cache entry %s: %v", key, err)
+	}
+	if expired(entry.Expires) {
+		os.Remove(d.path(key))
+		return nil, false, nil
+	}
+	return entry.Value, true, nil
+}
+
+// Set implements Store. Entries are written to a temporary file first so
+// readers never see partial entries.
+func (d *Disk) Set(key string, value []byte, ttl time.Duration) error {
+	data, err := json.Marshal(diskEntry{Expires: expiry(ttl), Value: value})
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(d.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), d.path(key))
+}
+
+// Delete implements Store
+func (d *Disk) Delete(key string) error {
+	err := os.Remove(d.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// path returns the file for key. Keys are expected to be hashes, so they are
+// safe to use as file names; anything else is rejected by filepath.Base.
+func (d *Disk) path(key string) string {
+	return filepath.Join(d.dir, filepath.Base(key)+".json")
+}
@@ -0,0 +1,360 @@
+// Package fakegithub implements a fake GitHub OAuth, REST and GraphQL server
+// backed by JSON fixtures, for tests and offline development.
+package fakegithub
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"embed"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed fixtures/*.json
+var defaultFixtures embed.FS
+
+// Fixture names, each served from fixtures/<name>.json
+const (
+	FixtureUser    = "user"
+	FixtureRepos   = "repos"
+	FixtureOrgs    = "orgs"
+	FixtureIssues  = "issues"
+	FixtureGraphQL = "graphql"
+	// FixtureInstallationRepos is served to GitHub App installation tokens
+	FixtureInstallationRepos = "installation_repos"
+	// FixtureReadmes maps owner/name of repositories to their README
+	FixtureReadmes = "readmes"
+)
+
+// Default credentials issued by the server
+const (
+	DefaultCode  = "fake-code"
+	DefaultToken = "fake-token"
+	// The refresh token, installation and installation token of the app
+	// mode enabled by Server.AppKey
+	DefaultRefreshToken      = "fake-refresh-token"
+	DefaultInstallationID    = 42
+	DefaultInstallationToken = "fake-installation-token"
+)
+
+// routes maps REST API paths to the fixture they serve
+var routes = map[string]string{
+	"/user":        FixtureUser,
+	"/user/repos":  FixtureRepos,
+	"/user/orgs":   FixtureOrgs,
+	"/user/issues": FixtureIssues,
+}
+
+// Server is a fake GitHub server. It serves the OAuth web flow under
+// /login/oauth, the REST API at the root and GraphQL at /graphql, as well as
+// the GitHub Enterprise Server layout with the REST API under /api/v3 and
+// GraphQL at /api/graphql.
+type Server struct {
+	// ClientID and ClientSecret, if set, are required by the token exchange
+	ClientID     string
+	ClientSecret string
+	// Token is the access token issued and required by the API
+	Token string
+	// Scopes is sent as X-OAuth-Scopes header on API responses
+	Scopes string
+	// AppID and AppKey, if set, make the server behave like a GitHub App:
+	// issued tokens expire after TokenLifetime and come with a refresh
+	// token, and installation tokens are minted for JWTs signed by the
+	// private key of AppKey
+	AppID         int64
+	AppKey        *rsa.PublicKey
+	TokenLifetime time.Duration
+
+	mu       sync.Mutex
+	fixtures map[string][]byte
+	requests []string
+}
+
+// New creates a server serving the embedded fixtures
+func New() *Server {
+	s := &Server{
+		Token:         DefaultToken,
+		Scopes:        "read:org, repo, user",
+		TokenLifetime: 8 * time.Hour,
+		fixtures:      make(map[string][]byte),
+	}
+	for _, name := range []string{FixtureUser, FixtureRepos, FixtureOrgs, FixtureIssues, FixtureGraphQL, FixtureInstallationRepos, FixtureReadmes} {
+		data, err := defaultFixtures.ReadFile("fixtures/" + name + ".json")
+		if err != nil {
+			panic(fmt.Sprintf("fakegithub: missing fixture %s: %v", name, err))
+		}
+		s.fixtures[name] = data
+	}
+	return s
+}
+
+// SetFixture replaces the JSON served for a fixture
+func (s *Server) SetFixture(name string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fixtures[name] = data
+}
+
+// Fixture returns the JSON currently served for a fixture
+func (s *Server) Fixture(name string) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fixtures[name]
+}
+
+// Requests returns the method and path of the requests received so far
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+	s.mu.Unlock()
+
+	path := r.URL.Path
+	if path == "/api/graphql" {
+		path = "/graphql"
+	} else if strings.HasPrefix(path, "/api/v3/") {
+		path = strings.TrimPrefix(path, "/api/v3")
+	}
+
+	switch {
+	case path == "/login/oauth/authorize" && r.Method == http.MethodGet:
+		s.authorize(w, r)
+	case path == "/login/oauth/access_token" && r.Method == http.MethodPost:
+		s.accessToken(w, r)
+	case path == "/graphql" && r.Method == http.MethodPost:
+		s.api(w, r, FixtureGraphQL)
+	case path == "/user/installations" && r.Method == http.MethodGet && s.AppKey != nil:
+		s.installations(w, r)
+	case path == fmt.Sprintf("/app/installations/%d/access_tokens", DefaultInstallationID) && r.Method == http.MethodPost && s.AppKey != nil:
+		s.installationToken(w, r)
+	case path == "/installation/repositories" && r.Method == http.MethodGet && s.AppKey != nil:
+		s.installationAPI(w, r, FixtureInstallationRepos)
+	case strings.HasPrefix(path, "/repos/") && strings.HasSuffix(path, "/readme") && r.Method == http.MethodGet:
+		s.readme(w, r, strings.TrimSuffix(strings.TrimPrefix(path, "/repos/"), "/readme"))
+	case routes[path] != "" && r.Method == http.MethodGet:
+		s.api(w, r, routes[path])
+	default:
+		writeError(w, http.StatusNotFound, "Not Found")
+	}
+}
+
+// authorize approves every authorization request and redirects back to the
+// client with DefaultCode
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	redirect, err := url.Parse(r.URL.Query().Get("redirect_uri"))
+	if err != nil || redirect.String() == "" {
+		writeError(w, http.StatusBadRequest, "redirect_uri is required")
+		return
+	}
+	if s.ClientID != "" && r.URL.Query().Get("client_id") != s.ClientID {
+		writeError(w, http.StatusBadRequest, "invalid client_id")
+		return
+	}
+
+	q := redirect.Query()
+	q.Set("code", DefaultCode)
+	if state := r.URL.Query().Get("state"); state != "" {
+		q.Set("state", state)
+	}
+	redirect.RawQuery = q.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// accessToken exchanges DefaultCode, or in app mode DefaultRefreshToken, for
+// the server's token. Like GitHub, it reports failures in a 200 response.
+func (s *Server) accessToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if (s.ClientID != "" && r.PostForm.Get("client_id") != s.ClientID) ||
+		(s.ClientSecret != "" && r.PostForm.Get("client_secret") != s.ClientSecret) {
+		json.NewEncoder(w).Encode(map[string]string{"error": "incorrect_client_credentials"})
+		return
+	}
+	if r.PostForm.Get("grant_type") == "refresh_token" {
+		if s.AppKey == nil || r.PostForm.Get("refresh_token") != DefaultRefreshToken {
+			json.NewEncoder(w).Encode(map[string]string{"error": "bad_refresh_token"})
+			return
+		}
+	} else if r.PostForm.Get("code") != DefaultCode {
+		json.NewEncoder(w).Encode(map[string]string{"error": "bad_verification_code"})
+		return
+	}
+
+	if s.AppKey != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":             s.Token,
+			"token_type":               "bearer",
+			"scope":                    "",
+			"expires_in":               int(s.TokenLifetime.Seconds()),
+			"refresh_token":            DefaultRefreshToken,
+			"refresh_token_expires_in": 15897600,
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"access_token": s.Token,
+		"token_type":   "bearer",
+		"scope":        strings.ReplaceAll(s.Scopes, " ", ""),
+	})
+}
+
+// installations lists DefaultInstallationID on the account of the fixture
+// user to requests authenticated with the server's token
+func (s *Server) installations(w http.ResponseWriter, r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	if auth != "token "+s.Token && auth != "Bearer "+s.Token {
+		writeError(w, http.StatusUnauthorized, "Bad credentials")
+		return
+	}
+
+	var user struct {
+		Login string `json:"login"`
+	}
+	json.Unmarshal(s.Fixture(FixtureUser), &user)
+
+	installation := map[string]interface{}{
+		"id":                   DefaultInstallationID,
+		"app_id":               s.AppID,
+		"repository_selection": "selected",
+		"account":              map[string]string{"login": user.Login, "type": "User"},
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"total_count":   1,
+		"installations": []interface{}{installation},
+	})
+}
+
+// installationToken mints DefaultInstallationToken for requests
+// authenticated with a valid JWT of the app
+func (s *Server) installationToken(w http.ResponseWriter, r *http.Request) {
+	if err := s.verifyJWT(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")); err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"token":      DefaultInstallationToken,
+		"expires_at": time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+	})
+}
+
+// verifyJWT checks that token is an unexpired RS256 JWT issued by the app
+// and signed by the private key of AppKey
+func (s *Server) verifyJWT(token string) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return errors.New("invalid JWT")
+	}
+	enc := base64.RawURLEncoding
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	var claims struct {
+		Iss string `json:"iss"`
+		Exp int64  `json:"exp"`
+	}
+	headerJSON, err := enc.DecodeString(parts[0])
+	if err != nil || json.Unmarshal(headerJSON, &header) != nil || header.Alg != "RS256" {
+		return errors.New("JWT must be signed with RS256")
+	}
+	claimsJSON, err := enc.DecodeString(parts[1])
+	if err != nil || json.Unmarshal(claimsJSON, &claims) != nil {
+		return errors.New("invalid JWT")
+	}
+	signature, err := enc.DecodeString(parts[2])
+	if err != nil {
+		return errors.New("invalid JWT")
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(s.AppKey, crypto.SHA256, digest[:], signature); err != nil {
+		return errors.New("invalid JWT signature")
+	}
+	if claims.Iss != strconv.FormatInt(s.AppID, 10) {
+		return fmt.Errorf("JWT not issued by app %d", s.AppID)
+	}
+	if time.Unix(claims.Exp, 0).Before(time.Now()) {
+		return errors.New("JWT expired")
+	}
+	return nil
+}
+
+// installationAPI serves a fixture to requests authenticated with
+// DefaultInstallationToken
+func (s *Server) installationAPI(w http.ResponseWriter, r *http.Request, fixture string) {
+	if r.Header.Get("Authorization") != "token "+DefaultInstallationToken {
+		writeError(w, http.StatusUnauthorized, "Bad credentials")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(s.Fixture(fixture))
+}
+
+// api serves a fixture to requests authenticated with the server's token
+func (s *Server) api(w http.ResponseWriter, r *http.Request, fixture string) {
+	auth := r.Header.Get("Authorization")
+	if auth != "token "+s.Token && auth != "Bearer "+s.Token {
+		writeError(w, http.StatusUnauthorized, "Bad credentials")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-OAuth-Scopes", s.Scopes)
+	w.Write(s.Fixture(fixture))
+}
+
+// readme serves the README of the repository fullName from FixtureReadmes
+// base64 encoded, like the contents API
+func (s *Server) readme(w http.ResponseWriter, r *http.Request, fullName string) {
+	auth := r.Header.Get("Authorization")
+	if auth != "token "+s.Token && auth != "Bearer "+s.Token {
+		writeError(w, http.StatusUnauthorized, "Bad credentials")
+		return
+	}
+
+	var readmes map[string]string
+	json.Unmarshal(s.Fixture(FixtureReadmes), &readmes)
+	content, ok := readmes[fullName]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"name":     "README.md",
+		"encoding": "base64",
+		"content":  base64.StdEncoding.EncodeToString([]byte(content)),
+	})
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
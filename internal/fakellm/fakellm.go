@@ -0,0 +1,274 @@
+// Package fakellm implements a fake OpenAI-compatible chat completions server
+// with scriptable behaviours, for tests and offline development.
+package fakellm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Behaviour kinds
+const (
+	KindRespond   = "respond"
+	KindError     = "error"
+	KindMalformed = "malformed"
+	KindStream    = "stream"
+)
+
+// DefaultContent is returned when no behaviour specifies content
+const DefaultContent = "This is a canned response from the fake LLM server."
+
+// Behaviour describes how the server answers one request
+type Behaviour struct {
+	Kind string `json:"kind"`
+	// Content is the generated text for respond and stream behaviours
+	Content string `json:"content,omitempty"`
+	// Chunks are streamed one by one; Content is streamed as one chunk otherwise
+	Chunks []string `json:"chunks,omitempty"`
+	// Status and Body are returned by error behaviours
+	Status int    `json:"status,omitempty"`
+	Body   string `json:"body,omitempty"`
+	// RetryAfter is sent as Retry-After header if set
+	RetryAfter string `json:"retry_after,omitempty"`
+	// Latency delays the response
+	Latency Duration `json:"latency,omitempty"`
+
+	PromptTokens     int `json:"prompt_tokens,omitempty"`
+	CompletionTokens int `json:"completion_tokens,omitempty"`
+}
+
+// Duration is a time.Duration that unmarshals from strings like "1.5s"
+type Duration time.Duration
+
+// UnmarshalJSON implements json.Unmarshaler
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Respond returns a successful completion with content
+func Respond(content string) Behaviour {
+	return Behaviour{Kind: KindRespond, Content: content, PromptTokens: 100, CompletionTokens: 50}
+}
+
+// Fail returns an error response with the given status
+func Fail(status int) Behaviour {
+	return Behaviour{Kind: KindError, Status: status}
+}
+
+// RateLimited returns a 429 response asking the client to retry after retryAfter
+func RateLimited(retryAfter string) Behaviour {
+	return Behaviour{Kind: KindError, Status: http.StatusTooManyRequests, RetryAfter: retryAfter}
+}
+
+// Malformed returns a 200 response whose body is not valid JSON
+func Malformed() Behaviour {
+	return Behaviour{Kind: KindMalformed}
+}
+
+// Stream returns a streamed completion sent in chunks
+func Stream(chunks ...string) Behaviour {
+	return Behaviour{Kind: KindStream, Chunks: chunks}
+}
+
+// Slow delays b by latency
+func Slow(latency time.Duration, b Behaviour) Behaviour {
+	b.Latency = Duration(latency)
+	return b
+}
+
+// ChatRequest is a request received by the server
+type ChatRequest struct {
+	Model    string `json:"model"`
+	Messages []struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	} `json:"messages"`
+	Stream bool `json:"stream"`
+}
+
+// Server is a fake chat completions server. Scripted behaviours are used in
+// order, then the default behaviour for every further request.
+type Server struct {
+	// APIKey, if set, is required as bearer token
+	APIKey string
+
+	mu       sync.Mutex
+	script   []Behaviour
+	fallback Behaviour
+	requests []ChatRequest
+}
+
+// New creates a server answering every request with DefaultContent
+func New() *Server {
+	return &Server{fallback: Respond(DefaultContent)}
+}
+
+// Enqueue appends behaviours to the script
+func (s *Server) Enqueue(behaviours ...Behaviour) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.script = append(s.script, behaviours...)
+}
+
+// SetDefault sets the behaviour used once the script is exhausted
+func (s *Server) SetDefault(b Behaviour) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fallback = b
+}
+
+// Requests returns the requests received so far
+func (s *Server) Requests() []ChatRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]ChatRequest(nil), s.requests...)
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasSuffix(r.URL.Path, "/chat/completions") {
+		http.NotFound(w, r)
+		return
+	}
+	if s.APIKey != "" && r.Header.Get("Authorization") != "Bearer "+s.APIKey {
+		writeError(w, http.StatusUnauthorized, "invalid api key")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var req ChatRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request: %v", err))
+		return
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	b := s.fallback
+	if len(s.script) > 0 {
+		b = s.script[0]
+		s.script = s.script[1:]
+	}
+	s.mu.Unlock()
+
+	if b.Latency > 0 {
+		select {
+		case <-time.After(time.Duration(b.Latency)):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if b.RetryAfter != "" {
+		w.Header().Set("Retry-After", b.RetryAfter)
+	}
+
+	switch {
+	case b.Kind == KindError:
+		status := b.Status
+		if status == 0 {
+			status = http.StatusInternalServerError
+		}
+		if b.Body != "" {
+			w.WriteHeader(status)
+			io.WriteString(w, b.Body)
+			return
+		}
+		writeError(w, status, http.StatusText(status))
+	case b.Kind == KindMalformed:
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id": "chatcmpl-fake", "choices": [`)
+	case b.Kind == KindStream || req.Stream:
+		s.stream(w, req, b)
+	default:
+		s.respond(w, req, b)
+	}
+}
+
+func (s *Server) respond(w http.ResponseWriter, req ChatRequest, b Behaviour) {
+	content := b.Content
+	if content == "" {
+		content = strings.Join(b.Chunks, "")
+	}
+	if content == "" {
+		content = DefaultContent
+	}
+
+	resp := map[string]interface{}{
+		"id":     "chatcmpl-fake",
+		"object": "chat.completion",
+		"model":  req.Model,
+		"choices": []map[string]interface{}{{
+			"index":         0,
+			"message":       map[string]string{"role": "assistant", "content": content},
+			"finish_reason": "stop",
+		}},
+		"usage": map[string]int{
+			"prompt_tokens":     b.PromptTokens,
+			"completion_tokens": b.CompletionTokens,
+			"total_tokens":      b.PromptTokens + b.CompletionTokens,
+		},
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *Server) stream(w http.ResponseWriter, req ChatRequest, b Behaviour) {
+	chunks := b.Chunks
+	if len(chunks) == 0 {
+		content := b.Content
+		if content == "" {
+			content = DefaultContent
+		}
+		chunks = []string{content}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	flusher, _ := w.(http.Flusher)
+	for _, chunk := range chunks {
+		data, _ := json.Marshal(map[string]interface{}{
+			"id":     "chatcmpl-fake",
+			"object": "chat.completion.chunk",
+			"model":  req.Model,
+			"choices": []map[string]interface{}{{
+				"index": 0,
+				"delta": map[string]string{"content": chunk},
+			}},
+		})
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	io.WriteString(w, "data: [DONE]\n\n")
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]string{"message": message},
+	})
+}
@@ -0,0 +1,180 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Status describes the state of a job
+type Status string
+
+// Job statuses
+const (
+	StatusRunning  Status = "running"
+	StatusDone     Status = "done"
+	StatusFailed   Status = "failed"
+	StatusCanceled Status = "canceled"
+)
+
+// retention is how long finished jobs are kept so clients can read their status
+const retention = 10 * time.Minute
+
+// Info is a snapshot of a job's state
+type Info struct {
+	ID     string `json:"id"`
+	Status Status `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// QueuePosition is set by callers that know where the job is waiting
+	QueuePosition int `json:"queue_position,omitempty"`
+}
+
+// Job is a unit of background work that can be cancelled
+type Job struct {
+	ID    string
+	Owner string
+
+	mu         sync.Mutex
+	status     Status
+	err        error
+	lastSeen   time.Time
+	finishedAt time.Time
+	cancel     context.CancelFunc
+}
+
+// Info returns a snapshot of the job's state
+func (j *Job) Info() Info {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	info := Info{ID: j.ID, Status: j.status}
+	if j.err != nil {
+		info.Error = j.err.Error()
+	}
+	return info
+}
+
+// Touch records that a client is still waiting for the job
+func (j *Job) Touch() {
+	j.mu.Lock()
+	j.lastSeen = time.Now()
+	j.mu.Unlock()
+}
+
+// Cancel aborts the job
+func (j *Job) Cancel() {
+	j.cancel()
+}
+
+// Manager runs jobs and cancels them when their client goes away or the
+// manager's context is done
+type Manager struct {
+	ctx         context.Context
+	idleTimeout time.Duration
+
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+// NewManager creates a job manager. Jobs derive their context from ctx, and
+// running jobs that are not touched within idleTimeout are cancelled.
+func NewManager(ctx context.Context, idleTimeout time.Duration) *Manager {
+	m := &Manager{
+		ctx:         ctx,
+		idleTimeout: idleTimeout,
+		jobs:        make(map[string]*Job),
+	}
+	go m.reap()
+	return m
+}
+
+// Start runs fn in the background as a new job owned by owner. The job ID
+// is available to fn through IDFromContext.
+func (m *Manager) Start(owner string, fn func(ctx context.Context) error) *Job {
+	id := newID()
+	ctx, cancel := context.WithCancel(context.WithValue(m.ctx, idKey{}, id))
+	job := &Job{
+		ID:       id,
+		Owner:    owner,
+		status:   StatusRunning,
+		lastSeen: time.Now(),
+		cancel:   cancel,
+	}
+
+	m.mu.Lock()
+	m.jobs[job.ID] = job
+	m.mu.Unlock()
+
+	go func() {
+		defer cancel()
+		err := fn(ctx)
+
+		job.mu.Lock()
+		defer job.mu.Unlock()
+		job.finishedAt = time.Now()
+		switch {
+		case err == nil:
+			job.status = StatusDone
+		case errors.Is(err, context.Canceled):
+			job.status = StatusCanceled
+		default:
+			job.status = StatusFailed
+			job.err = err
+		}
+	}()
+
+	return job
+}
+
+type idKey struct{}
+
+// IDFromContext returns the ID of the job running with ctx, if any
+func IDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(idKey{}).(string)
+	return id
+}
+
+// Get returns the job with the given ID
+func (m *Manager) Get(id string) (*Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	return job, ok
+}
+
+// reap cancels abandoned jobs and forgets finished ones
+func (m *Manager) reap() {
+	ticker := time.NewTicker(m.idleTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case now := <-ticker.C:
+			m.mu.Lock()
+			for id, job := range m.jobs {
+				job.mu.Lock()
+				if job.status == StatusRunning && now.Sub(job.lastSeen) > m.idleTimeout {
+					job.cancel()
+				}
+				if job.status != StatusRunning && now.Sub(job.finishedAt) > retention {
+					delete(m.jobs, id)
+				}
+				job.mu.Unlock()
+			}
+			m.mu.Unlock()
+		}
+	}
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,115 @@
+package limiter
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// Group limits calls globally and per provider
+type Group struct {
+	global    *Limiter
+	providers map[string]*Limiter
+	// RetryAfter is the delay clients are asked to wait when the queue is full
+	RetryAfter time.Duration
+}
+
+// NewGroupFromConfig creates limiters from llm.concurrency. A limit of 0
+// disables the respective limiter.
+func NewGroupFromConfig() *Group {
+	maxQueue := viper.GetInt("llm.concurrency.max_queue")
+	g := &Group{
+		providers:  make(map[string]*Limiter),
+		RetryAfter: viper.GetDuration("llm.concurrency.retry_after"),
+	}
+	if g.RetryAfter <= 0 {
+		g.RetryAfter = 30 * time.Second
+	}
+	if global := viper.GetInt("llm.concurrency.global"); global > 0 {
+		g.global = New(global, maxQueue)
+	}
+	// Limits set in the environment are strings and those in YAML may be
+	// floats, so they are converted rather than asserted
+	for provider, limit := range viper.GetStringMap("llm.concurrency.providers") {
+		n, err := cast.ToIntE(limit)
+		if err != nil || n < 0 {
+			log.Printf("Warning: Invalid llm.concurrency.providers.%s limit %v, not limiting the provider", provider, limit)
+			continue
+		}
+		if n > 0 {
+			g.providers[provider] = New(n, maxQueue)
+		}
+	}
+	return g
+}
+
+// Acquire waits for a slot of provider and then a global slot for user. The
+// returned function must be called to release both. The provider slot is
+// taken first so calls waiting for a busy provider don't hold global slots
+// other providers could use.
+func (g *Group) Acquire(ctx context.Context, provider, user string) (func(), error) {
+	if g == nil {
+		return func() {}, nil
+	}
+
+	releaseProvider := func() {}
+	if l, ok := g.providers[provider]; ok {
+		release, err := l.Acquire(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+		releaseProvider = release
+	}
+
+	if g.global != nil {
+		release, err := g.global.Acquire(ctx, user)
+		if err != nil {
+			releaseProvider()
+			return nil, err
+		}
+		return func() {
+			release()
+			releaseProvider()
+		}, nil
+	}
+	return releaseProvider, nil
+}
+
+// Full reports whether new calls would be rejected by the global queue or
+// the queue of any provider
+func (g *Group) Full() bool {
+	if g == nil {
+		return false
+	}
+	if g.global != nil && g.global.Full() {
+		return true
+	}
+	for _, l := range g.providers {
+		if l.Full() {
+			return true
+		}
+	}
+	return false
+}
+
+// Position returns the queue position of user's first waiting call, or 0 if
+// none of user's calls is waiting
+func (g *Group) Position(user string) int {
+	if g == nil {
+		return 0
+	}
+	if g.global != nil {
+		if position := g.global.Position(user); position > 0 {
+			return position
+		}
+	}
+	for _, l := range g.providers {
+		if position := l.Position(user); position > 0 {
+			return position
+		}
+	}
+	return 0
+}
@@ -0,0 +1,165 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrQueueFull is returned when too many calls are already waiting
+var ErrQueueFull = errors.New("too many requests are waiting for the AI service, please try again later")
+
+// Limiter bounds the number of concurrent calls. Waiting calls are queued per
+// user and served round-robin, so a single user cannot hog all slots.
+type Limiter struct {
+	capacity int
+	maxQueue int
+
+	mu     sync.Mutex
+	active int
+	queued int
+	queues map[string][]*waiter
+	// ring holds the users with waiting calls in service order
+	ring []string
+	next int
+}
+
+type waiter struct {
+	user  string
+	ready chan struct{}
+}
+
+// New creates a limiter allowing capacity concurrent calls with at most
+// maxQueue waiting calls. A maxQueue of 0 means the queue is unbounded.
+func New(capacity, maxQueue int) *Limiter {
+	return &Limiter{
+		capacity: capacity,
+		maxQueue: maxQueue,
+		queues:   make(map[string][]*waiter),
+	}
+}
+
+// Acquire waits for a free slot for user. The returned function must be
+// called to release the slot.
+func (l *Limiter) Acquire(ctx context.Context, user string) (func(), error) {
+	l.mu.Lock()
+	if l.active < l.capacity && l.queued == 0 {
+		l.active++
+		l.mu.Unlock()
+		return l.release, nil
+	}
+	if l.maxQueue > 0 && l.queued >= l.maxQueue {
+		l.mu.Unlock()
+		return nil, ErrQueueFull
+	}
+
+	w := &waiter{user: user, ready: make(chan struct{})}
+	if len(l.queues[user]) == 0 {
+		l.ring = append(l.ring, user)
+	}
+	l.queues[user] = append(l.queues[user], w)
+	l.queued++
+	l.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return l.release, nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		select {
+		case <-w.ready:
+			// Granted while giving up, hand the slot on
+			l.active--
+			l.dispatch()
+		default:
+			l.remove(w)
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// Full reports whether new calls would be rejected
+func (l *Limiter) Full() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.maxQueue > 0 && l.queued >= l.maxQueue
+}
+
+// Position returns how many calls will be served before the first waiting
+// call of user, plus one. It returns 0 if user has no waiting calls.
+func (l *Limiter) Position(user string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.queues[user]) == 0 {
+		return 0
+	}
+
+	// Users are served one call per turn starting at l.next, so only the
+	// users whose turn comes before user's get a call in first
+	position := 1
+	for i := 0; i < len(l.ring); i++ {
+		u := l.ring[(l.next+i)%len(l.ring)]
+		if u == user {
+			break
+		}
+		position++
+	}
+	return position
+}
+
+func (l *Limiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+	l.dispatch()
+}
+
+// dispatch hands free slots to waiting calls. Callers hold l.mu.
+func (l *Limiter) dispatch() {
+	for l.active < l.capacity && len(l.ring) > 0 {
+		if l.next >= len(l.ring) {
+			l.next = 0
+		}
+		user := l.ring[l.next]
+		w := l.queues[user][0]
+		l.queues[user] = l.queues[user][1:]
+		l.queued--
+		l.active++
+		close(w.ready)
+
+		if len(l.queues[user]) == 0 {
+			delete(l.queues, user)
+			l.ring = append(l.ring[:l.next], l.ring[l.next+1:]...)
+		} else {
+			l.next++
+		}
+	}
+}
+
+// remove drops a waiter that gave up. Callers hold l.mu.
+func (l *Limiter) remove(w *waiter) {
+	queue := l.queues[w.user]
+	for i, other := range queue {
+		if other == w {
+			l.queues[w.user] = append(queue[:i], queue[i+1:]...)
+			l.queued--
+			break
+		}
+	}
+	if len(l.queues[w.user]) > 0 {
+		return
+	}
+
+	delete(l.queues, w.user)
+	for i, u := range l.ring {
+		if u == w.user {
+			l.ring = append(l.ring[:i], l.ring[i+1:]...)
+			if i < l.next {
+				l.next--
+			}
+			break
+		}
+	}
+}
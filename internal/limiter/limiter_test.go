@@ -0,0 +1,190 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// enqueue starts a call of user waiting on l and returns the channel its
+// release function is sent on once it gets a slot
+func enqueue(t *testing.T, l *Limiter, user string) <-chan func() {
+	t.Helper()
+	before := queued(l)
+	granted := make(chan func(), 1)
+	go func() {
+		release, err := l.Acquire(context.Background(), user)
+		if err != nil {
+			t.Errorf("Acquire(%s): %v", user, err)
+			return
+		}
+		granted <- release
+	}()
+	waitFor(t, func() bool { return queued(l) == before+1 })
+	return granted
+}
+
+func queued(l *Limiter) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.queued
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLimiterServesUsersRoundRobin(t *testing.T) {
+	l := New(1, 0)
+	release, err := l.Acquire(context.Background(), "holder")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// alice queues three calls before bob and carol queue one each
+	var alice []<-chan func()
+	for i := 0; i < 3; i++ {
+		alice = append(alice, enqueue(t, l, "alice"))
+	}
+	bob := enqueue(t, l, "bob")
+	carol := enqueue(t, l, "carol")
+
+	for _, want := range []struct {
+		user string
+		ch   <-chan func()
+	}{
+		{"alice", alice[0]}, {"bob", bob}, {"carol", carol}, {"alice", alice[1]}, {"alice", alice[2]},
+	} {
+		release()
+		select {
+		case release = <-want.ch:
+		case <-time.After(time.Second):
+			t.Fatalf("%s was not served next", want.user)
+		}
+	}
+	release()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active != 0 || l.queued != 0 || len(l.ring) != 0 {
+		t.Errorf("limiter not drained: %d active, %d queued, ring %v", l.active, l.queued, l.ring)
+	}
+}
+
+func TestLimiterPosition(t *testing.T) {
+	l := New(1, 0)
+	release, _ := l.Acquire(context.Background(), "holder")
+	defer release()
+
+	enqueue(t, l, "alice")
+	enqueue(t, l, "alice")
+	enqueue(t, l, "bob")
+
+	// bob is served after a single call of alice despite queueing last
+	for user, want := range map[string]int{"alice": 1, "bob": 2, "carol": 0} {
+		if got := l.Position(user); got != want {
+			t.Errorf("Position(%s) = %d, want %d", user, got, want)
+		}
+	}
+}
+
+func TestLimiterRemovesCancelledCalls(t *testing.T) {
+	l := New(1, 2)
+	release, _ := l.Acquire(context.Background(), "holder")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := l.Acquire(ctx, "alice")
+		done <- err
+	}()
+	waitFor(t, func() bool { return l.Position("alice") == 1 })
+	bob := enqueue(t, l, "bob")
+
+	if !l.Full() {
+		t.Error("limiter with a full queue not reported full")
+	}
+	if _, err := l.Acquire(context.Background(), "carol"); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("got %v for a call beyond the queue, want ErrQueueFull", err)
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v for a cancelled call", err)
+	}
+	if l.Position("alice") != 0 || l.Position("bob") != 1 || l.Full() {
+		t.Errorf("cancelled call not removed: %d queued", queued(l))
+	}
+
+	release()
+	select {
+	case release := <-bob:
+		release()
+	case <-time.After(time.Second):
+		t.Fatal("bob was not served after alice gave up")
+	}
+}
+
+func TestGroupFullChecksProviders(t *testing.T) {
+	g := &Group{global: New(2, 1), providers: map[string]*Limiter{"slow": New(1, 1)}}
+	release, err := g.Acquire(context.Background(), "slow", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	if g.Full() {
+		t.Fatal("group reported full with empty queues")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go g.Acquire(ctx, "slow", "bob")
+	waitFor(t, func() bool { return g.Position("bob") == 1 })
+
+	if !g.Full() {
+		t.Error("group with a full provider queue not reported full")
+	}
+	// bob waits for the provider without holding a global slot
+	g.global.mu.Lock()
+	defer g.global.mu.Unlock()
+	if g.global.active != 1 {
+		t.Errorf("got %d global slots in use, want 1", g.global.active)
+	}
+}
+
+func TestNewGroupFromConfig(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.Set("llm.concurrency.max_queue", 5)
+	viper.Set("llm.concurrency.providers", map[string]interface{}{
+		"yaml":     2,
+		"float":    3.0,
+		"env":      "4",
+		"disabled": 0,
+		"invalid":  "four",
+		"negative": -1,
+	})
+
+	g := NewGroupFromConfig()
+	want := map[string]int{"yaml": 2, "float": 3, "env": 4}
+	if len(g.providers) != len(want) {
+		t.Errorf("got %d provider limiters, want %d", len(g.providers), len(want))
+	}
+	for provider, capacity := range want {
+		if l, ok := g.providers[provider]; !ok || l.capacity != capacity || l.maxQueue != 5 {
+			t.Errorf("provider %s: got limiter %+v, want capacity %d", provider, l, capacity)
+		}
+	}
+	if g.global != nil || g.RetryAfter != 30*time.Second {
+		t.Errorf("got global limiter %v and retry after %s, want none and 30s", g.global, g.RetryAfter)
+	}
+}
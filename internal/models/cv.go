@@ -0,0 +1,140 @@
+package models
+
+import "strings"
+
+// CVSection represents a single section of a generated CV
+type CVSection struct {
+	Name     string `json:"name"`
+	Title    string `json:"title"`
+	Content  string `json:"content"`
+	Fallback bool   `json:"fallback"`
+	// Model is the provider/model that generated the section, if any
+	Model string `json:"model,omitempty"`
+	// Edited is set when the user changed the section after generation
+	Edited bool `json:"edited,omitempty"`
+}
+
+// CV represents a generated CV as an ordered list of sections
+type CV struct {
+	Sections []CVSection `json:"sections"`
+}
+
+// Section returns the section with the given name, or nil if it does not exist
+func (cv *CV) Section(name string) *CVSection {
+	for i := range cv.Sections {
+		if cv.Sections[i].Name == name {
+			return &cv.Sections[i]
+		}
+	}
+	return nil
+}
+
+// Models returns the distinct models that generated the CV's sections
+func (cv *CV) Models() []string {
+	seen := make(map[string]bool)
+	var models []string
+	for _, section := range cv.Sections {
+		if section.Model != "" && !seen[section.Model] {
+			seen[section.Model] = true
+			models = append(models, section.Model)
+		}
+	}
+	return models
+}
+
+// Markdown assembles all sections into a single markdown document
+func (cv *CV) Markdown() string {
+	var b strings.Builder
+	for i, section := range cv.Sections {
+		if i > 0 {
+			b.WriteString("\n\n")
+		}
+		if section.Title != "" {
+			b.WriteString("## " + section.Title + "\n\n")
+		}
+		b.WriteString(strings.TrimSpace(section.Content))
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// Edit returns the CV with the markdown the user edited, as assembled by
+// Markdown. The markdown is split into sections at its "## " headings, which
+// keep the name and model of the section with the same title; changed
+// sections are marked as edited. A CV generated as a single section stays a
+// single section.
+func (cv *CV) Edit(markdown string) *CV {
+	markdown = strings.ReplaceAll(markdown, "\r\n", "\n")
+	if len(cv.Sections) == 1 && cv.Sections[0].Title == "" {
+		section := cv.Sections[0]
+		section.Content = strings.TrimSpace(markdown)
+		section.Edited = section.Edited || section.Content != strings.TrimSpace(cv.Sections[0].Content)
+		return &CV{Sections: []CVSection{section}}
+	}
+
+	var sections []CVSection
+	var content []string
+	title, started := "", false
+	flush := func() {
+		text := strings.TrimSpace(strings.Join(content, "\n"))
+		if started || text != "" {
+			sections = append(sections, cv.editedSection(title, text))
+		}
+		content = nil
+	}
+	for _, line := range strings.Split(markdown, "\n") {
+		if heading, ok := strings.CutPrefix(line, "## "); ok {
+			flush()
+			title, started = strings.TrimSpace(heading), true
+			continue
+		}
+		content = append(content, line)
+	}
+	flush()
+	return &CV{Sections: sections}
+}
+
+// Revise returns the CV with the markdown of a revision by model, split into
+// sections like Edit. Changed and new sections are attributed to model.
+func (cv *CV) Revise(markdown, model string) *CV {
+	revised := cv.Edit(markdown)
+	for i := range revised.Sections {
+		section := &revised.Sections[i]
+		unchanged := false
+		for _, original := range cv.Sections {
+			if original.Title == section.Title && strings.TrimSpace(original.Content) == section.Content {
+				unchanged = true
+				break
+			}
+		}
+		if !unchanged {
+			section.Model, section.Edited, section.Fallback = model, false, false
+		}
+	}
+	return revised
+}
+
+// editedSection returns the section titled title with the edited content,
+// keeping the name and model of the section with the same title in cv
+func (cv *CV) editedSection(title, content string) CVSection {
+	for _, section := range cv.Sections {
+		if section.Title == title {
+			if strings.TrimSpace(section.Content) != content {
+				section.Content = content
+				section.Edited = true
+			}
+			return section
+		}
+	}
+
+	name := "header"
+	if title != "" {
+		name = strings.Trim(strings.Map(func(r rune) rune {
+			if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+				return r
+			}
+			return '-'
+		}, strings.ToLower(title)), "-")
+	}
+	return CVSection{Name: name, Title: title, Content: content, Edited: true}
+}
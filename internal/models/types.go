@@ -2,7 +2,7 @@ package models
 
 import "time"
 
-// UserProfile represents a GitHub user profile
+// UserProfile represents a developer profile on a code hosting service
 type UserProfile struct {
 	Login           string `json:"login"`
 	Name            string `json:"name"`
@@ -15,10 +15,14 @@ type UserProfile struct {
 	Location        string `json:"location"`
 	Company         string `json:"company"`
 	Blog            string `json:"blog"`
+	Email           string `json:"email"`
 	TwitterUsername string `json:"twitter_username"`
+	HTMLURL         string `json:"html_url"`
+	// Provider names the service the profile is hosted on, e.g. GitHub
+	Provider string `json:"provider"`
 }
 
-// Repository represents a GitHub repository
+// Repository represents a GitHub repository or GitLab project
 type Repository struct {
 	Name        string    `json:"name"`
 	Description string    `json:"description"`
@@ -28,13 +32,17 @@ type Repository struct {
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 	Topics      []string  `json:"topics"`
-	Owner       struct {
+	HTMLURL     string    `json:"html_url"`
+	Private     bool      `json:"private"`
+	// MirrorURL is the URL of the repository this one mirrors, if any
+	MirrorURL string `json:"mirror_url"`
+	Owner     struct {
 		Login string `json:"login"`
 		Type  string `json:"type"`
 	} `json:"owner"`
 }
 
-// PullRequest represents a GitHub pull request
+// PullRequest represents a GitHub pull request or GitLab merge request
 type PullRequest struct {
 	Title        string    `json:"title"`
 	State        string    `json:"state"`
@@ -45,20 +53,39 @@ type PullRequest struct {
 	Additions    int       `json:"additions"`
 	Deletions    int       `json:"deletions"`
 	ChangedFiles int       `json:"changed_files"`
+	HTMLURL      string    `json:"html_url"`
+	// Public is set when the provider reported the repository of the pull
+	// request to be public
+	Public bool `json:"public,omitempty"`
 }
 
-// Organization represents a GitHub organization
+// Organization represents a GitHub organization or GitLab group
 type Organization struct {
 	Login       string `json:"login"`
 	Description string `json:"description"`
 	AvatarURL   string `json:"avatar_url"`
 	Type        string `json:"type"`
+	HTMLURL     string `json:"html_url"`
 }
 
-// GitHubData represents all data collected from GitHub
-type GitHubData struct {
+// ContributionStats summarizes a user's contributions over the last year
+type ContributionStats struct {
+	TotalContributions int `json:"total_contributions"`
+	Commits            int `json:"commits"`
+	PullRequests       int `json:"pull_requests"`
+	Reviews            int `json:"reviews"`
+	Issues             int `json:"issues"`
+}
+
+// DeveloperData represents all data collected about a developer from one or
+// more code hosting services. Field names follow the GitHub API.
+type DeveloperData struct {
 	Profile       *UserProfile
 	Repositories  []Repository
 	Organizations []Organization
 	PullRequests  []PullRequest
+	Contributions *ContributionStats
+	// PrivateLanguages counts the private repositories per language that are
+	// only included in the language statistics
+	PrivateLanguages map[string]int
 }
@@ -0,0 +1,79 @@
+package retry
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is matched by errors returned while a circuit breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// CircuitOpenError is returned when calls are rejected by an open breaker
+type CircuitOpenError struct {
+	Name  string
+	Until time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%s is temporarily unavailable after repeated failures, try again in %v",
+		e.Name, time.Until(e.Until).Round(time.Second))
+}
+
+// Is makes errors.Is(err, ErrCircuitOpen) match
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// Breaker rejects calls for a cooldown period after consecutive failures.
+// After the cooldown a single failure opens it again until a call succeeds.
+type Breaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+
+	mu          sync.Mutex
+	failures    int
+	openedUntil time.Time
+}
+
+// NewBreaker creates a breaker that opens after threshold consecutive failures
+func NewBreaker(name string, threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{
+		name:      name,
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// Allow returns an error if the breaker is open
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if time.Now().Before(b.openedUntil) {
+		return &CircuitOpenError{Name: b.name, Until: b.openedUntil}
+	}
+	return nil
+}
+
+// Success records a successful call and closes the breaker
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+}
+
+// Failure records a failed call and opens the breaker once the threshold is reached
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.threshold > 0 && b.failures >= b.threshold {
+		b.openedUntil = time.Now().Add(b.cooldown)
+		log.Printf("Warning: %s circuit breaker open for %v after %d failures", b.name, b.cooldown, b.failures)
+	}
+}
@@ -0,0 +1,262 @@
+package retry
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ErrExhausted is matched by errors returned when all attempts failed
+var ErrExhausted = errors.New("all retry attempts failed")
+
+// Policy controls how an operation is retried
+type Policy struct {
+	Name        string
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	// MaxElapsed caps the total time spent including delays, 0 means no cap
+	MaxElapsed time.Duration
+	// Jitter is the fraction of each delay that is randomized
+	Jitter float64
+	// Breaker, if set, is tripped by repeated retryable failures
+	Breaker *Breaker
+}
+
+// ExhaustedError is returned when an operation still fails after retrying
+type ExhaustedError struct {
+	Attempts int
+	Err      error
+}
+
+func (e *ExhaustedError) Error() string {
+	return fmt.Sprintf("%v after %d attempts: %v", ErrExhausted, e.Attempts, e.Err)
+}
+
+func (e *ExhaustedError) Unwrap() error {
+	return e.Err
+}
+
+// Is makes errors.Is(err, ErrExhausted) match
+func (e *ExhaustedError) Is(target error) bool {
+	return target == ErrExhausted
+}
+
+// Do calls fn until it succeeds, returns a non-retryable error, the attempts
+// or elapsed time run out, or ctx is done
+func (p Policy) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	start := time.Now()
+	attempts := p.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		if p.Breaker != nil {
+			if err := p.Breaker.Allow(); err != nil {
+				return err
+			}
+		}
+
+		err := fn(ctx)
+		if err == nil {
+			if p.Breaker != nil {
+				p.Breaker.Success()
+			}
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if !Retryable(err) {
+			var perm *permanentError
+			if errors.As(err, &perm) {
+				return perm.err
+			}
+			return err
+		}
+		// Rate limits apply to the token rather than the host, so they don't
+		// trip the breaker shared by all users of the host
+		if p.Breaker != nil && !RateLimited(err) {
+			p.Breaker.Failure()
+		}
+		if attempt >= attempts {
+			return &ExhaustedError{Attempts: attempt, Err: err}
+		}
+
+		delay := p.delay(attempt, err)
+		if p.MaxElapsed > 0 && time.Since(start)+delay > p.MaxElapsed {
+			return &ExhaustedError{Attempts: attempt, Err: err}
+		}
+
+		log.Printf("%s: retry attempt %d/%d after %v delay: %v", p.Name, attempt+1, attempts, delay, err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// delay returns the time to wait before the attempt following attempt
+func (p Policy) delay(attempt int, err error) time.Duration {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) && httpErr.RetryAfter > 0 {
+		return httpErr.RetryAfter
+	}
+
+	delay := time.Duration(float64(p.BaseDelay) * math.Pow(2, float64(attempt-1)))
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		delay -= time.Duration(rand.Float64() * p.Jitter * float64(delay))
+	}
+	return delay
+}
+
+// permanentError marks an error as not retryable
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent wraps err so that it is never retried
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// Retryable reports whether an operation that failed with err may succeed
+// when tried again. Rate limiting, server errors, timeouts, temporary DNS
+// failures and connection errors are retryable, everything else is not,
+// including certificate errors and invalid URLs.
+func Retryable(err error) bool {
+	var perm *permanentError
+	if errors.As(err, &perm) {
+		return false
+	}
+	if errors.Is(err, ErrCircuitOpen) || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Retryable()
+	}
+
+	if certificateError(err) {
+		return false
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTimeout || dnsErr.IsTemporary
+	}
+
+	var netErr net.Error
+	var opErr *net.OpError
+	return errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.As(err, &netErr) && netErr.Timeout() ||
+		errors.As(err, &opErr)
+}
+
+// RateLimited reports whether err is a response to an exhausted rate limit
+func RateLimited(err error) bool {
+	var httpErr *HTTPError
+	return errors.As(err, &httpErr) && (httpErr.RateLimited || httpErr.StatusCode == http.StatusTooManyRequests)
+}
+
+// certificateError reports whether err is a failed TLS handshake, which
+// fails the same way when tried again
+func certificateError(err error) bool {
+	var verification *tls.CertificateVerificationError
+	var record tls.RecordHeaderError
+	var authority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	return errors.As(err, &verification) ||
+		errors.As(err, &record) ||
+		errors.As(err, &authority) ||
+		errors.As(err, &hostname) ||
+		errors.As(err, &invalid)
+}
+
+// HTTPError describes an unsuccessful HTTP response
+type HTTPError struct {
+	StatusCode int
+	Body       string
+	// RetryAfter is the delay requested by the server, if any
+	RetryAfter time.Duration
+	// RateLimited is set when the server reports an exhausted rate limit
+	RateLimited bool
+}
+
+// NewHTTPError creates an HTTPError from a response and its body
+func NewHTTPError(resp *http.Response, body []byte) *HTTPError {
+	e := &HTTPError{
+		StatusCode: resp.StatusCode,
+		Body:       string(body),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+
+	// GitHub reports exhausted rate limits as 403 with a reset timestamp
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		e.RateLimited = true
+		if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil && e.RetryAfter == 0 {
+			e.RetryAfter = time.Until(time.Unix(reset, 0))
+		}
+	}
+	return e
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("request failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+// Retryable reports whether the request may succeed when sent again
+func (e *HTTPError) Retryable() bool {
+	switch {
+	case e.RateLimited, e.StatusCode == http.StatusTooManyRequests, e.StatusCode == http.StatusRequestTimeout:
+		return true
+	case e.StatusCode >= 500:
+		return e.StatusCode != http.StatusNotImplemented
+	default:
+		return false
+	}
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -0,0 +1,192 @@
+package retry
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestPolicyDelay(t *testing.T) {
+	p := Policy{BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+	for attempt, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second} {
+		if got := p.delay(attempt, errors.New("failed")); got != want {
+			t.Errorf("delay after attempt %d = %v, want %v", attempt, got, want)
+		}
+	}
+
+	// Retry-After takes precedence over the backoff
+	if got := p.delay(1, &HTTPError{StatusCode: 429, RetryAfter: 42 * time.Second}); got != 42*time.Second {
+		t.Errorf("got delay %v, want the Retry-After of 42s", got)
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := p.delay(2, errors.New("failed")); got <= time.Second || got > 2*time.Second {
+			t.Fatalf("jittered delay %v outside (1s, 2s]", got)
+		}
+	}
+}
+
+func TestNewHTTPErrorRetryAfter(t *testing.T) {
+	reset := time.Now().Add(time.Minute).Unix()
+	tests := []struct {
+		name        string
+		status      int
+		header      http.Header
+		min, max    time.Duration
+		rateLimited bool
+	}{
+		{"seconds", 429, http.Header{"Retry-After": {"30"}}, 30 * time.Second, 30 * time.Second, false},
+		{"date", 503, http.Header{"Retry-After": {time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)}}, 58 * time.Minute, time.Hour, false},
+		{"invalid", 503, http.Header{"Retry-After": {"soon"}}, 0, 0, false},
+		{"rate limit reset", 403, http.Header{"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {strconv.FormatInt(reset, 10)}}, 58 * time.Second, time.Minute, true},
+	}
+
+	for _, tt := range tests {
+		err := NewHTTPError(&http.Response{StatusCode: tt.status, Header: tt.header}, nil)
+		if err.RetryAfter < tt.min || err.RetryAfter > tt.max {
+			t.Errorf("%s: got Retry-After %v, want between %v and %v", tt.name, err.RetryAfter, tt.min, tt.max)
+		}
+		if err.RateLimited != tt.rateLimited || tt.rateLimited && !err.Retryable() {
+			t.Errorf("%s: got rate limited %v, retryable %v", tt.name, err.RateLimited, err.Retryable())
+		}
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"server error", &HTTPError{StatusCode: 502}, true},
+		{"not implemented", &HTTPError{StatusCode: 501}, false},
+		{"rate limited", &HTTPError{StatusCode: 429}, true},
+		{"forbidden", &HTTPError{StatusCode: 403}, false},
+		{"permanent", Permanent(&HTTPError{StatusCode: 502}), false},
+		{"circuit open", &CircuitOpenError{Name: "api"}, false},
+		{"cancelled", context.Canceled, false},
+		{"deadline", fmt.Errorf("request: %w", context.DeadlineExceeded), true},
+		{"unexpected EOF", io.ErrUnexpectedEOF, true},
+		{"connection refused", &url.Error{Op: "Post", URL: "https://api.example.com", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}, true},
+		{"temporary DNS failure", &net.OpError{Op: "dial", Err: &net.DNSError{Err: "server misbehaving", IsTemporary: true}}, true},
+		{"unknown host", &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", IsNotFound: true}}, false},
+		{"unknown authority", &url.Error{Op: "Get", URL: "https://ghe.example.com", Err: x509.UnknownAuthorityError{}}, false},
+		{"hostname mismatch", &url.Error{Op: "Get", URL: "https://ghe.example.com", Err: x509.HostnameError{Host: "ghe.example.com"}}, false},
+		{"unsupported scheme", &url.Error{Op: "Get", URL: "ftp://example.com", Err: errors.New(`unsupported protocol scheme "ftp"`)}, false},
+	}
+
+	for _, tt := range tests {
+		if got := Retryable(tt.err); got != tt.want {
+			t.Errorf("%s: Retryable = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyDo(t *testing.T) {
+	p := Policy{Name: "test", MaxAttempts: 3, BaseDelay: time.Millisecond}
+
+	calls := 0
+	err := p.Do(context.Background(), func(ctx context.Context) error {
+		calls++
+		if calls < 3 {
+			return &HTTPError{StatusCode: 503}
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("got %v after %d calls, want success after 3", err, calls)
+	}
+
+	calls = 0
+	err = p.Do(context.Background(), func(ctx context.Context) error {
+		calls++
+		return &HTTPError{StatusCode: 503}
+	})
+	if !errors.Is(err, ErrExhausted) || calls != 3 {
+		t.Errorf("got %v after %d calls, want exhausted after 3", err, calls)
+	}
+
+	calls = 0
+	err = p.Do(context.Background(), func(ctx context.Context) error {
+		calls++
+		return Permanent(errors.New("bad request"))
+	})
+	if err == nil || err.Error() != "bad request" || calls != 1 {
+		t.Errorf("got %v after %d calls, want the permanent error after 1", err, calls)
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	b := NewBreaker("api", 2, 20*time.Millisecond)
+
+	b.Failure()
+	if err := b.Allow(); err != nil {
+		t.Fatalf("breaker open below the threshold: %v", err)
+	}
+	b.Success()
+	b.Failure()
+	if err := b.Allow(); err != nil {
+		t.Fatalf("success did not reset the failures: %v", err)
+	}
+
+	b.Failure()
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("got %v at the threshold, want ErrCircuitOpen", err)
+	}
+
+	// Half-open after the cooldown: a single failure opens it again
+	time.Sleep(30 * time.Millisecond)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("breaker still open after the cooldown: %v", err)
+	}
+	b.Failure()
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("got %v after a failure following the cooldown, want ErrCircuitOpen", err)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	b.Success()
+	b.Failure()
+	if err := b.Allow(); err != nil {
+		t.Errorf("breaker open after recovering: %v", err)
+	}
+}
+
+func TestPolicyDoBreaker(t *testing.T) {
+	p := Policy{Name: "test", MaxAttempts: 1, Breaker: NewBreaker("api", 2, time.Minute)}
+	fail := func(err error) func(context.Context) error {
+		return func(context.Context) error { return err }
+	}
+
+	// Rate limits are per token and leave the breaker closed
+	for i := 0; i < 3; i++ {
+		p.Do(context.Background(), fail(&HTTPError{StatusCode: 403, RateLimited: true}))
+		p.Do(context.Background(), fail(&HTTPError{StatusCode: 429}))
+	}
+	if err := p.Breaker.Allow(); err != nil {
+		t.Fatalf("rate limits opened the breaker: %v", err)
+	}
+
+	// Errors that are not retried don't count either
+	p.Do(context.Background(), fail(&HTTPError{StatusCode: 404}))
+	p.Do(context.Background(), fail(&HTTPError{StatusCode: 500}))
+	p.Do(context.Background(), fail(&HTTPError{StatusCode: 500}))
+
+	called := false
+	err := p.Do(context.Background(), func(context.Context) error {
+		called = true
+		return nil
+	})
+	if !errors.Is(err, ErrCircuitOpen) || called {
+		t.Errorf("got %v with the call made: %v, want the open breaker to reject it", err, called)
+	}
+}
@@ -4,18 +4,23 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"math"
 	"net/http"
 	"time"
 
 	"github.com/spf13/viper"
+
+	"opengptmservice/internal/limiter"
+	"opengptmservice/internal/retry"
+	"opengptmservice/internal/usage"
 )
 
 // AtomaConfig holds the configuration for Atoma API
 type AtomaConfig struct {
+	Provider    string
 	APIKey      string
 	Model       string
 	BaseURL     string
@@ -24,19 +29,41 @@ type AtomaConfig struct {
 	Timeout     time.Duration
 	MaxRetries  int
 	RetryDelay  time.Duration
+	// MaxRetryDelay caps the delay between two attempts
+	MaxRetryDelay time.Duration
+	// MaxElapsed caps the total time spent on a request including retries
+	MaxElapsed time.Duration
+	// BreakerThreshold is the number of consecutive upstream failures that
+	// open the circuit breaker for BreakerCooldown
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
 }
 
+// DefaultAtomaBaseURL is the Atoma chat completions endpoint
+const DefaultAtomaBaseURL = "https://api.atoma.network/v1/chat/completions"
+
 // NewAtomaConfig creates a new Atoma configuration from viper
 func NewAtomaConfig() *AtomaConfig {
+	baseURL := viper.GetString("atoma.base_url")
+	if baseURL == "" {
+		baseURL = DefaultAtomaBaseURL
+	}
+
 	return &AtomaConfig{
+		Provider:    "atoma",
 		APIKey:      viper.GetString("atoma.api_key"),
 		Model:       viper.GetString("atoma.model"),
-		BaseURL:     "https://api.atoma.network/v1/chat/completions",
+		BaseURL:     baseURL,
 		MaxTokens:   2000,
 		Temperature: 0.7,
 		Timeout:     120 * time.Second, // Increased to 2 minutes
 		MaxRetries:  3,                 // Maximum number of retries
 		RetryDelay:  5 * time.Second,   // Initial delay between retries
+
+		MaxRetryDelay:    30 * time.Second,
+		MaxElapsed:       5 * time.Minute,
+		BreakerThreshold: 5,
+		BreakerCooldown:  time.Minute,
 	}
 }
 
@@ -54,6 +81,13 @@ type Message struct {
 	Content string `json:"content"`
 }
 
+// Roles of chat messages
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
 // AtomaResponse represents the response from Atoma API
 type AtomaResponse struct {
 	ID      string `json:"id"`
@@ -62,6 +96,11 @@ type AtomaResponse struct {
 			Content string `json:"content"`
 		} `json:"message"`
 	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+		TotalTokens      int `json:"total_tokens"`
+	} `json:"usage"`
 	Error *struct {
 		Message string `json:"message"`
 	} `json:"error"`
@@ -69,8 +108,10 @@ type AtomaResponse struct {
 
 // AtomaClient handles communication with Atoma API
 type AtomaClient struct {
-	config *AtomaConfig
-	client *http.Client
+	config  *AtomaConfig
+	client  *http.Client
+	policy  retry.Policy
+	limiter *limiter.Group
 }
 
 // NewAtomaClient creates a new Atoma client
@@ -80,115 +121,140 @@ func NewAtomaClient(config *AtomaConfig) *AtomaClient {
 		client: &http.Client{
 			Timeout: config.Timeout,
 		},
+		policy: retry.Policy{
+			Name:        config.Provider + "/" + config.Model,
+			MaxAttempts: config.MaxRetries + 1,
+			BaseDelay:   config.RetryDelay,
+			MaxDelay:    config.MaxRetryDelay,
+			MaxElapsed:  config.MaxElapsed,
+			Jitter:      0.2,
+			Breaker:     retry.NewBreaker(config.Provider+"/"+config.Model, config.BreakerThreshold, config.BreakerCooldown),
+		},
 	}
 }
 
-// GenerateText sends a request to Atoma API and returns the generated text
-func (c *AtomaClient) GenerateText(prompt string) (string, error) {
-	var lastErr error
-	for attempt := 0; attempt <= c.config.MaxRetries; attempt++ {
-		if attempt > 0 {
-			// Calculate exponential backoff delay
-			delay := time.Duration(math.Pow(2, float64(attempt-1))) * c.config.RetryDelay
-			log.Printf("Retry attempt %d/%d after %v delay", attempt, c.config.MaxRetries, delay)
-			time.Sleep(delay)
-		}
+// Name returns the provider and model the client talks to
+func (c *AtomaClient) Name() string {
+	return c.config.Provider + "/" + c.config.Model
+}
 
-		startTime := time.Now()
-		log.Printf("Starting Atoma API request (attempt %d/%d) at %v", attempt+1, c.config.MaxRetries+1, startTime)
-
-		// Create context with timeout
-		ctx, cancel := context.WithTimeout(context.Background(), c.config.Timeout)
-		defer cancel()
-
-		// Prepare the request
-		reqBody := AtomaRequest{
-			Model: c.config.Model,
-			Messages: []Message{
-				{
-					Role:    "user",
-					Content: prompt,
-				},
-			},
-			Temperature: c.config.Temperature,
-			MaxTokens:   c.config.MaxTokens,
-		}
+// GenerateText sends prompt to Atoma API as a single user message and returns
+// the generated text along with the tokens used
+func (c *AtomaClient) GenerateText(ctx context.Context, prompt string) (*Completion, error) {
+	return c.Chat(ctx, []Message{{Role: RoleUser, Content: prompt}})
+}
 
-		// Convert request body to JSON
-		jsonData, err := json.Marshal(reqBody)
-		if err != nil {
-			lastErr = fmt.Errorf("failed to marshal request: %v", err)
-			continue
-		}
+// Chat sends a conversation to Atoma API and returns the next message of the
+// assistant along with the tokens used. Retries follow the client's retry
+// policy and stop as soon as ctx is done. Each attempt waits for a slot of
+// the client's concurrency limiter, if any.
+func (c *AtomaClient) Chat(ctx context.Context, messages []Message) (*Completion, error) {
+	var completion *Completion
+	attempt := 0
+	err := c.policy.Do(ctx, func(ctx context.Context) error {
+		attempt++
 
-		// Create HTTP request with context
-		req, err := http.NewRequestWithContext(ctx, "POST", c.config.BaseURL, bytes.NewBuffer(jsonData))
+		// Slots are held per attempt so retry delays don't block other users
+		release, err := c.limiter.Acquire(ctx, c.config.Provider, usage.ScopeFrom(ctx).User)
 		if err != nil {
-			lastErr = fmt.Errorf("failed to create request: %v", err)
-			continue
+			return retry.Permanent(err)
 		}
+		defer release()
 
-		// Set headers
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("Authorization", "Bearer "+c.config.APIKey)
+		completion, err = c.generateOnce(ctx, messages, attempt)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return completion, nil
+}
 
-		// Send request
-		log.Printf("Sending request to Atoma API...")
-		resp, err := c.client.Do(req)
-		if err != nil {
-			if err == context.DeadlineExceeded {
-				lastErr = fmt.Errorf("request timed out after %v", c.config.Timeout)
-				continue
-			}
-			lastErr = fmt.Errorf("failed to send request: %v", err)
-			continue
-		}
+// generateOnce performs a single request to Atoma API
+func (c *AtomaClient) generateOnce(ctx context.Context, messages []Message, attempt int) (*Completion, error) {
+	startTime := time.Now()
+	log.Printf("Starting Atoma API request (attempt %d/%d) at %v", attempt, c.policy.MaxAttempts, startTime)
 
-		// Log response status and timing
-		elapsed := time.Since(startTime)
-		log.Printf("Atoma API response received after %v", elapsed)
-		log.Printf("Atoma API response status: %d", resp.StatusCode)
+	// Create context with timeout
+	ctx, cancel := context.WithTimeout(ctx, c.config.Timeout)
+	defer cancel()
 
-		// Read response body
-		body, err := io.ReadAll(resp.Body)
-		resp.Body.Close() // Close body immediately after reading
-		if err != nil {
-			lastErr = fmt.Errorf("failed to read response body: %v", err)
-			continue
-		}
+	// Prepare the request
+	reqBody := AtomaRequest{
+		Model:       c.config.Model,
+		Messages:    messages,
+		Temperature: c.config.Temperature,
+		MaxTokens:   c.config.MaxTokens,
+	}
 
-		// Check for errors
-		if resp.StatusCode != http.StatusOK {
-			lastErr = fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
-			// Don't retry on 4xx errors (client errors)
-			if resp.StatusCode >= 400 && resp.StatusCode < 500 {
-				return "", lastErr
-			}
-			continue
-		}
+	// Convert request body to JSON
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %v", err)
+	}
 
-		// Parse response
-		var atomaResp AtomaResponse
-		if err := json.Unmarshal(body, &atomaResp); err != nil {
-			lastErr = fmt.Errorf("failed to parse response: %v", err)
-			continue
-		}
+	// Create HTTP request with context
+	req, err := http.NewRequestWithContext(ctx, "POST", c.config.BaseURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
 
-		// Check for errors in response
-		if atomaResp.Error != nil {
-			lastErr = fmt.Errorf("API returned error: %s", atomaResp.Error.Message)
-			continue
-		}
+	// Set headers
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.config.APIKey)
 
-		// Return the generated text
-		if len(atomaResp.Choices) > 0 {
-			totalTime := time.Since(startTime)
-			log.Printf("Successfully generated text in %v", totalTime)
-			return atomaResp.Choices[0].Message.Content, nil
+	// Send request
+	log.Printf("Sending request to Atoma API...")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, fmt.Errorf("request timed out after %v: %w", c.config.Timeout, err)
 		}
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
 
-		lastErr = fmt.Errorf("no response content generated")
+	// Log response status and timing
+	elapsed := time.Since(startTime)
+	log.Printf("Atoma API response received after %v", elapsed)
+	log.Printf("Atoma API response status: %d", resp.StatusCode)
+
+	// Read response body
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close() // Close body immediately after reading
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	// Check for errors; the retry policy decides which statuses are retried
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API request failed: %w", retry.NewHTTPError(resp, body))
+	}
+
+	// Parse response
+	var atomaResp AtomaResponse
+	if err := json.Unmarshal(body, &atomaResp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %v", err)
+	}
+
+	// Check for errors in response
+	if atomaResp.Error != nil {
+		return nil, fmt.Errorf("API returned error: %s", atomaResp.Error.Message)
+	}
+
+	// Return the generated text
+	if len(atomaResp.Choices) > 0 {
+		totalTime := time.Since(startTime)
+		log.Printf("Successfully generated text in %v", totalTime)
+		completion := &Completion{
+			Text:  atomaResp.Choices[0].Message.Content,
+			Model: c.Name(),
+		}
+		if atomaResp.Usage != nil {
+			completion.PromptTokens = atomaResp.Usage.PromptTokens
+			completion.CompletionTokens = atomaResp.Usage.CompletionTokens
+		}
+		return completion, nil
 	}
 
-	return "", fmt.Errorf("all retry attempts failed: %v", lastErr)
+	return nil, fmt.Errorf("no response content generated")
 }
@@ -0,0 +1,243 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"opengptmservice/internal/fakellm"
+	"opengptmservice/internal/retry"
+)
+
+// newTestClient returns a client talking to a fake LLM server with short
+// delays so retries don't slow the tests down
+func newTestClient(t *testing.T) (*AtomaClient, *fakellm.Server) {
+	t.Helper()
+
+	fake := fakellm.New()
+	fake.APIKey = "test-key"
+	ts := httptest.NewServer(fake)
+	t.Cleanup(ts.Close)
+
+	client := NewAtomaClient(&AtomaConfig{
+		Provider:         "fake",
+		APIKey:           "test-key",
+		Model:            "fake-model",
+		BaseURL:          ts.URL + "/v1/chat/completions",
+		MaxTokens:        100,
+		Timeout:          time.Second,
+		MaxRetries:       2,
+		RetryDelay:       10 * time.Millisecond,
+		MaxRetryDelay:    50 * time.Millisecond,
+		MaxElapsed:       5 * time.Second,
+		BreakerThreshold: 10,
+		BreakerCooldown:  time.Minute,
+	})
+	return client, fake
+}
+
+func TestGenerateTextSuccess(t *testing.T) {
+	client, fake := newTestClient(t)
+	fake.Enqueue(fakellm.Behaviour{Kind: fakellm.KindRespond, Content: "# CV", PromptTokens: 12, CompletionTokens: 34})
+
+	completion, err := client.GenerateText(context.Background(), "write a CV")
+	if err != nil {
+		t.Fatalf("GenerateText() error = %v", err)
+	}
+	if completion.Text != "# CV" {
+		t.Errorf("Text = %q, want %q", completion.Text, "# CV")
+	}
+	if completion.Model != "fake/fake-model" {
+		t.Errorf("Model = %q, want %q", completion.Model, "fake/fake-model")
+	}
+	if completion.PromptTokens != 12 || completion.CompletionTokens != 34 {
+		t.Errorf("tokens = %d/%d, want 12/34", completion.PromptTokens, completion.CompletionTokens)
+	}
+
+	requests := fake.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(requests))
+	}
+	if requests[0].Model != "fake-model" || requests[0].Messages[0].Content != "write a CV" {
+		t.Errorf("unexpected request %+v", requests[0])
+	}
+}
+
+func TestGenerateTextRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		behaviours []fakellm.Behaviour
+		requests   int
+		wantErr    bool
+		exhausted  bool
+	}{
+		{
+			name:       "server error then success",
+			behaviours: []fakellm.Behaviour{fakellm.Fail(http.StatusInternalServerError), fakellm.Respond("ok")},
+			requests:   2,
+		},
+		{
+			name:       "bad gateway then success",
+			behaviours: []fakellm.Behaviour{fakellm.Fail(http.StatusBadGateway), fakellm.Fail(http.StatusServiceUnavailable), fakellm.Respond("ok")},
+			requests:   3,
+		},
+		{
+			name:       "rate limited then success",
+			behaviours: []fakellm.Behaviour{fakellm.Fail(http.StatusTooManyRequests), fakellm.Respond("ok")},
+			requests:   2,
+		},
+		{
+			name:       "unauthorized is not retried",
+			behaviours: []fakellm.Behaviour{fakellm.Fail(http.StatusUnauthorized)},
+			requests:   1,
+			wantErr:    true,
+		},
+		{
+			name:       "bad request is not retried",
+			behaviours: []fakellm.Behaviour{fakellm.Fail(http.StatusBadRequest)},
+			requests:   1,
+			wantErr:    true,
+		},
+		{
+			name:       "malformed JSON is not retried",
+			behaviours: []fakellm.Behaviour{fakellm.Malformed()},
+			requests:   1,
+			wantErr:    true,
+		},
+		{
+			name: "retries exhausted",
+			behaviours: []fakellm.Behaviour{
+				fakellm.Fail(http.StatusInternalServerError),
+				fakellm.Fail(http.StatusInternalServerError),
+				fakellm.Fail(http.StatusInternalServerError),
+			},
+			requests:  3,
+			wantErr:   true,
+			exhausted: true,
+		},
+		{
+			name:       "attempt timeout is retried",
+			behaviours: []fakellm.Behaviour{fakellm.Slow(2*time.Second, fakellm.Respond("late")), fakellm.Respond("ok")},
+			requests:   2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, fake := newTestClient(t)
+			fake.Enqueue(tt.behaviours...)
+
+			completion, err := client.GenerateText(context.Background(), "prompt")
+			if got := len(fake.Requests()); got != tt.requests {
+				t.Errorf("got %d requests, want %d", got, tt.requests)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GenerateText() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if errors.Is(err, retry.ErrExhausted) != tt.exhausted {
+				t.Errorf("errors.Is(err, ErrExhausted) = %v, want %v", !tt.exhausted, tt.exhausted)
+			}
+			if err == nil && completion.Text != "ok" {
+				t.Errorf("Text = %q, want %q", completion.Text, "ok")
+			}
+		})
+	}
+}
+
+func TestGenerateTextHonoursRetryAfter(t *testing.T) {
+	client, fake := newTestClient(t)
+	fake.Enqueue(fakellm.RateLimited("1"), fakellm.Respond("ok"))
+
+	start := time.Now()
+	if _, err := client.GenerateText(context.Background(), "prompt"); err != nil {
+		t.Fatalf("GenerateText() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %v, want at least the 1s Retry-After", elapsed)
+	}
+}
+
+func TestGenerateTextHTTPErrorDetails(t *testing.T) {
+	client, fake := newTestClient(t)
+	fake.Enqueue(fakellm.Behaviour{Kind: fakellm.KindError, Status: http.StatusBadRequest, Body: `{"error": {"message": "context_length_exceeded"}}`})
+
+	_, err := client.GenerateText(context.Background(), "prompt")
+	var httpErr *retry.HTTPError
+	if !errors.As(err, &httpErr) {
+		t.Fatalf("error %v is not an HTTPError", err)
+	}
+	if httpErr.StatusCode != http.StatusBadRequest || !strings.Contains(httpErr.Body, "context_length_exceeded") {
+		t.Errorf("unexpected HTTPError %+v", httpErr)
+	}
+	if !isContextLengthError(err) {
+		t.Errorf("isContextLengthError() = false, want true")
+	}
+}
+
+func TestGenerateTextCancelledDuringRetryDelay(t *testing.T) {
+	client, fake := newTestClient(t)
+	client.policy.MaxElapsed = time.Minute
+	fake.Enqueue(fakellm.RateLimited("30"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := client.GenerateText(ctx, "prompt")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("GenerateText() error = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("returned after %v, want the retry delay to be aborted", elapsed)
+	}
+}
+
+func TestGenerateTextRetryAfterBeyondMaxElapsed(t *testing.T) {
+	client, fake := newTestClient(t)
+	fake.Enqueue(fakellm.RateLimited("30"))
+
+	start := time.Now()
+	_, err := client.GenerateText(context.Background(), "prompt")
+	if !errors.Is(err, retry.ErrExhausted) {
+		t.Fatalf("GenerateText() error = %v, want ErrExhausted", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("returned after %v, want to give up without waiting", elapsed)
+	}
+}
+
+func TestGenerateTextCircuitBreaker(t *testing.T) {
+	client, fake := newTestClient(t)
+	client.policy.Breaker = retry.NewBreaker("fake", 3, time.Minute)
+	fake.SetDefault(fakellm.Fail(http.StatusInternalServerError))
+
+	if _, err := client.GenerateText(context.Background(), "prompt"); err == nil {
+		t.Fatal("GenerateText() succeeded, want error")
+	}
+	requests := len(fake.Requests())
+
+	_, err := client.GenerateText(context.Background(), "prompt")
+	if !errors.Is(err, retry.ErrCircuitOpen) {
+		t.Fatalf("GenerateText() error = %v, want ErrCircuitOpen", err)
+	}
+	if got := len(fake.Requests()); got != requests {
+		t.Errorf("open breaker sent %d requests, want none", got-requests)
+	}
+}
+
+func TestGenerateTextStreamedResponseIsRejected(t *testing.T) {
+	client, fake := newTestClient(t)
+	fake.Enqueue(fakellm.Stream("Hello", ", world"))
+
+	// The client does not request streaming, so an event stream is malformed
+	if _, err := client.GenerateText(context.Background(), "prompt"); err == nil {
+		t.Fatal("GenerateText() succeeded on an event stream, want error")
+	}
+	if got := len(fake.Requests()); got != 1 {
+		t.Errorf("got %d requests, want 1", got)
+	}
+}
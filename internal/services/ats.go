@@ -0,0 +1,499 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/yuin/goldmark/ast"
+	extast "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/text"
+
+	"opengptmservice/internal/models"
+)
+
+// atsHeadings maps section titles that applicant tracking systems recognize
+// to the heading they are written with in the plain-text export
+var atsHeadings = map[string]string{
+	"summary":                     "SUMMARY",
+	"professional summary":        "SUMMARY",
+	"profile":                     "SUMMARY",
+	"professional profile":        "SUMMARY",
+	"about":                       "SUMMARY",
+	"about me":                    "SUMMARY",
+	"objective":                   "SUMMARY",
+	"career objective":            "SUMMARY",
+	"skills":                      "SKILLS",
+	"technical skills":            "SKILLS",
+	"key skills":                  "SKILLS",
+	"core skills":                 "SKILLS",
+	"core competencies":           "SKILLS",
+	"technologies":                "SKILLS",
+	"tech stack":                  "SKILLS",
+	"experience":                  "EXPERIENCE",
+	"professional experience":     "EXPERIENCE",
+	"work experience":             "EXPERIENCE",
+	"work history":                "EXPERIENCE",
+	"employment":                  "EXPERIENCE",
+	"employment history":          "EXPERIENCE",
+	"career history":              "EXPERIENCE",
+	"projects":                    "PROJECTS",
+	"notable projects":            "PROJECTS",
+	"key projects":                "PROJECTS",
+	"selected projects":           "PROJECTS",
+	"personal projects":           "PROJECTS",
+	"open source projects":        "PROJECTS",
+	"open source contributions":   "OPEN SOURCE CONTRIBUTIONS",
+	"contributions":               "OPEN SOURCE CONTRIBUTIONS",
+	"open source":                 "OPEN SOURCE CONTRIBUTIONS",
+	"education":                   "EDUCATION",
+	"academic background":         "EDUCATION",
+	"certifications":              "CERTIFICATIONS",
+	"certificates":                "CERTIFICATIONS",
+	"licenses and certifications": "CERTIFICATIONS",
+	"awards":                      "AWARDS",
+	"honors and awards":           "AWARDS",
+	"achievements":                "AWARDS",
+	"publications":                "PUBLICATIONS",
+	"languages":                   "LANGUAGES",
+	"volunteering":                "VOLUNTEER EXPERIENCE",
+	"volunteer experience":        "VOLUNTEER EXPERIENCE",
+	"contact":                     "CONTACT",
+	"contact information":         "CONTACT",
+}
+
+// ATSHeading returns the normalized heading of a section title and whether
+// the title is one applicant tracking systems recognize. Unknown titles are
+// kept, in upper case.
+func ATSHeading(title string) (string, bool) {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.ReplaceAll(title, "&", " and ")) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune(' ')
+		}
+	}
+	key := strings.Join(strings.Fields(b.String()), " ")
+	if heading, ok := atsHeadings[key]; ok {
+		return heading, true
+	}
+	return strings.ToUpper(strings.TrimSpace(title)), false
+}
+
+// ATSSection is a section heading found in a CV
+type ATSSection struct {
+	Title    string
+	Heading  string
+	Standard bool
+}
+
+// KeywordDensity is how often a keyword appears in a CV
+type KeywordDensity struct {
+	Keyword string
+	Count   int
+	// Density is the share of the words of the CV taken by the keyword, in
+	// percent
+	Density float64
+}
+
+// ATSReport is the analysis of how applicant tracking systems read a CV
+type ATSReport struct {
+	// Parseability estimates from 0 to 100 how much of the CV applicant
+	// tracking systems extract correctly
+	Parseability int
+	// KeywordScore is the percentage of the keywords found in the CV
+	KeywordScore int
+	Words        int
+	Keywords     []KeywordDensity
+	Sections     []ATSSection
+	// NonStandardSections are the titles of sections that applicant
+	// tracking systems may not recognize
+	NonStandardSections []string
+	// MissingContact names the kinds of contact information not found
+	MissingContact []string
+	Issues         []string
+}
+
+// atsDocument is a CV converted to plain text, with what was dropped or
+// flattened on the way
+type atsDocument struct {
+	text     string
+	sections []ATSSection
+	tables   int
+	images   int
+	html     int
+}
+
+// ATSText converts cv to plain text for applicant tracking systems: section
+// titles become normalized upper-case headings, tables become lines of
+// "header: value" pairs, and formatting, images and raw HTML are dropped
+func ATSText(cv *models.CV) string {
+	return convertATS(cv).text
+}
+
+func convertATS(cv *models.CV) *atsDocument {
+	doc := &atsDocument{}
+	var b strings.Builder
+	for _, section := range cv.Sections {
+		if section.Title != "" {
+			b.WriteString(doc.heading(section.Title) + "\n\n")
+		}
+		source := []byte(section.Content)
+		root := markdownRenderer.Parser().Parse(text.NewReader(source))
+		w := &atsWriter{doc: doc, source: source}
+		for child := root.FirstChild(); child != nil; child = child.NextSibling() {
+			w.block(child, "")
+		}
+		if content := strings.TrimSpace(w.String()); content != "" {
+			b.WriteString(content + "\n\n")
+		}
+	}
+	doc.text = strings.TrimSpace(b.String()) + "\n"
+	return doc
+}
+
+// heading records a section title and returns its normalized heading
+func (d *atsDocument) heading(title string) string {
+	heading, standard := ATSHeading(title)
+	d.sections = append(d.sections, ATSSection{Title: title, Heading: heading, Standard: standard})
+	return heading
+}
+
+// atsWriter writes the plain text of markdown blocks
+type atsWriter struct {
+	strings.Builder
+	doc    *atsDocument
+	source []byte
+}
+
+// block writes a block and its children, prefixing list items with indent
+func (w *atsWriter) block(n ast.Node, indent string) {
+	switch n := n.(type) {
+	case *ast.Heading:
+		// "## " headings are sections of CVs written as a single section
+		title := w.inline(n)
+		if n.Level == 2 {
+			title = w.doc.heading(title)
+		}
+		w.line(title)
+		w.WriteString("\n")
+	case *ast.Paragraph, *ast.TextBlock:
+		w.line(indent + w.inline(n))
+		if n.Kind() == ast.KindParagraph && indent == "" {
+			w.WriteString("\n")
+		}
+	case *ast.List:
+		number := n.Start
+		for item := n.FirstChild(); item != nil; item = item.NextSibling() {
+			marker := "- "
+			if n.IsOrdered() {
+				marker = fmt.Sprintf("%d. ", number)
+				number++
+			}
+			w.listItem(item, indent, marker)
+		}
+		if indent == "" {
+			w.WriteString("\n")
+		}
+	case *ast.FencedCodeBlock, *ast.CodeBlock:
+		lines := n.Lines()
+		for i := 0; i < lines.Len(); i++ {
+			segment := lines.At(i)
+			w.line(indent + strings.TrimRight(string(segment.Value(w.source)), "\n"))
+		}
+		w.WriteString("\n")
+	case *ast.Blockquote:
+		for child := n.FirstChild(); child != nil; child = child.NextSibling() {
+			w.block(child, indent)
+		}
+	case *ast.HTMLBlock:
+		w.doc.html++
+	case *extast.Table:
+		w.doc.tables++
+		w.table(n)
+		w.WriteString("\n")
+	case *ast.ThematicBreak:
+	default:
+		for child := n.FirstChild(); child != nil; child = child.NextSibling() {
+			w.block(child, indent)
+		}
+	}
+}
+
+// listItem writes the first block of item after marker and the others, such
+// as nested lists, indented below it
+func (w *atsWriter) listItem(item ast.Node, indent, marker string) {
+	first := true
+	for child := item.FirstChild(); child != nil; child = child.NextSibling() {
+		if first && (child.Kind() == ast.KindTextBlock || child.Kind() == ast.KindParagraph) {
+			w.line(indent + marker + w.inline(child))
+		} else {
+			w.block(child, indent+"  ")
+		}
+		first = false
+	}
+}
+
+// table writes every row of a table as "header: value" pairs, so that the
+// columns survive in plain text
+func (w *atsWriter) table(table *extast.Table) {
+	var headers []string
+	for row := table.FirstChild(); row != nil; row = row.NextSibling() {
+		var cells []string
+		for cell := row.FirstChild(); cell != nil; cell = cell.NextSibling() {
+			cells = append(cells, w.inline(cell))
+		}
+		if row.Kind() == extast.KindTableHeader {
+			headers = cells
+			continue
+		}
+		var pairs []string
+		for i, cell := range cells {
+			if cell == "" {
+				continue
+			}
+			if i < len(headers) && headers[i] != "" {
+				cell = headers[i] + ": " + cell
+			}
+			pairs = append(pairs, cell)
+		}
+		w.line("- " + strings.Join(pairs, "; "))
+	}
+}
+
+func (w *atsWriter) line(s string) {
+	if strings.TrimSpace(s) != "" {
+		w.WriteString(strings.TrimRight(s, " ") + "\n")
+	}
+}
+
+// inline returns the text of the inline children of n. Links keep their
+// address, which applicant tracking systems cannot follow otherwise.
+func (w *atsWriter) inline(n ast.Node) string {
+	var b strings.Builder
+	for child := n.FirstChild(); child != nil; child = child.NextSibling() {
+		switch child := child.(type) {
+		case *ast.Text:
+			b.Write(child.Segment.Value(w.source))
+			if child.HardLineBreak() {
+				b.WriteString("\n")
+			} else if child.SoftLineBreak() {
+				b.WriteString(" ")
+			}
+		case *ast.String:
+			b.Write(child.Value)
+		case *ast.AutoLink:
+			b.Write(child.URL(w.source))
+		case *ast.Link:
+			label := w.inline(child)
+			destination := string(child.Destination)
+			if label == "" || label == destination || strings.HasPrefix(destination, "#") {
+				b.WriteString(label)
+			} else {
+				b.WriteString(label + " (" + destination + ")")
+			}
+		case *ast.Image:
+			w.doc.images++
+		case *ast.RawHTML:
+			w.doc.html++
+		case *extast.TaskCheckBox:
+			if child.IsChecked {
+				b.WriteString("[x] ")
+			} else {
+				b.WriteString("[ ] ")
+			}
+		default:
+			b.WriteString(w.inline(child))
+		}
+	}
+	return b.String()
+}
+
+var (
+	atsEmail   = regexp.MustCompile(`[\w.+-]+@[\w-]+\.[\w.-]+`)
+	atsPhone   = regexp.MustCompile(`(?:\+\d{1,3}[\s.-]?)?\(?\d{2,4}\)?[\s.-]?\d{3,4}[\s.-]?\d{3,4}`)
+	atsProfile = regexp.MustCompile(`(?i)https?://|(?:github|gitlab|linkedin)\.com/`)
+)
+
+// keywordStuffing is the density in percent above which a keyword looks
+// stuffed into the CV
+const keywordStuffing = 5.0
+
+// AnalyzeATS reports how applicant tracking systems read cv and how often
+// keywords, such as the skills of a job offer, appear in it
+func AnalyzeATS(cv *models.CV, keywords []string) *ATSReport {
+	doc := convertATS(cv)
+	words := atsWords(doc.text)
+	report := &ATSReport{Words: len(words), Sections: doc.sections}
+	penalty := 0
+
+	if len(doc.sections) == 0 {
+		report.Issues = append(report.Issues, "The CV has no section headings, so applicant tracking systems cannot tell its parts apart.")
+		penalty += 25
+	}
+	for _, section := range doc.sections {
+		if !section.Standard {
+			report.NonStandardSections = append(report.NonStandardSections, section.Title)
+		}
+	}
+	if n := len(report.NonStandardSections); n > 0 {
+		report.Issues = append(report.Issues, fmt.Sprintf("%d section titles are not standard and may not be recognized: %s.", n, strings.Join(report.NonStandardSections, ", ")))
+		penalty += int(math.Min(float64(5*n), 20))
+	}
+
+	if !atsEmail.MatchString(doc.text) {
+		report.MissingContact = append(report.MissingContact, "email")
+		penalty += 15
+	}
+	if !atsPhone.MatchString(doc.text) {
+		report.MissingContact = append(report.MissingContact, "phone")
+		penalty += 10
+	}
+	if !atsProfile.MatchString(doc.text) {
+		report.MissingContact = append(report.MissingContact, "profile link")
+		penalty += 5
+	}
+	if len(report.MissingContact) > 0 {
+		report.Issues = append(report.Issues, "Contact information is missing: "+strings.Join(report.MissingContact, ", ")+".")
+	}
+
+	if doc.tables > 0 {
+		report.Issues = append(report.Issues, fmt.Sprintf("The CV has %d tables, which applicant tracking systems often read out of order. Use lists instead.", doc.tables))
+		penalty += int(math.Min(float64(10*doc.tables), 20))
+	}
+	if doc.images > 0 {
+		report.Issues = append(report.Issues, "Images are ignored by applicant tracking systems, so text in them is lost.")
+		penalty += 10
+	}
+	if doc.html > 0 {
+		report.Issues = append(report.Issues, "Raw HTML in the CV is dropped by the export.")
+		penalty += 5
+	}
+	if atsSymbols(doc.text) {
+		report.Issues = append(report.Issues, "Emoji and symbols may be dropped or garbled by applicant tracking systems.")
+		penalty += 5
+	}
+	if report.Words < 150 {
+		report.Issues = append(report.Issues, fmt.Sprintf("The CV has only %d words, too few to match most job offers.", report.Words))
+		penalty += 10
+	}
+	report.Parseability = int(math.Max(0, float64(100-penalty)))
+
+	var missing []string
+	found := 0
+	for _, keyword := range keywords {
+		count := countKeyword(words, atsWords(keyword))
+		if count == 0 {
+			missing = append(missing, keyword)
+		} else {
+			found++
+		}
+		density := 0.0
+		if len(words) > 0 {
+			density = math.Round(float64(count)*1000/float64(len(words))) / 10
+		}
+		report.Keywords = append(report.Keywords, KeywordDensity{Keyword: keyword, Count: count, Density: density})
+		if density > keywordStuffing {
+			report.Issues = append(report.Issues, fmt.Sprintf("%q makes up %.1f%% of the words, which may be treated as keyword stuffing.", keyword, density))
+		}
+	}
+	if len(keywords) > 0 {
+		report.KeywordScore = found * 100 / len(keywords)
+	}
+	if len(missing) > 0 {
+		report.Issues = append(report.Issues, "Keywords not found in the CV: "+strings.Join(missing, ", ")+".")
+	}
+	return report
+}
+
+// atsWords splits s into lower-case words, keeping characters such as the
+// "+" of "C++" and the "." of "Node.js"
+func atsWords(s string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("+#.-", r)
+	})
+	words := fields[:0]
+	for _, field := range fields {
+		if field = strings.TrimRight(strings.TrimLeft(field, ".-"), ".-"); field != "" {
+			words = append(words, field)
+		}
+	}
+	return words
+}
+
+// countKeyword counts the occurrences of the words of a keyword in words
+func countKeyword(words, keyword []string) int {
+	if len(keyword) == 0 {
+		return 0
+	}
+	count := 0
+	for i := 0; i+len(keyword) <= len(words); i++ {
+		match := true
+		for j, word := range keyword {
+			if words[i+j] != word {
+				match = false
+				break
+			}
+		}
+		if match {
+			count++
+		}
+	}
+	return count
+}
+
+// atsSymbols reports whether s contains emoji or other symbols
+func atsSymbols(s string) bool {
+	for _, r := range s {
+		if unicode.Is(unicode.So, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// ATSKeywords returns up to n keywords of data to check a CV for: the most
+// used languages followed by the most frequent repository topics
+func ATSKeywords(data *models.DeveloperData, n int) []string {
+	keywords := newCVView(data).TopLanguages(n)
+
+	counts := make(map[string]int)
+	for _, repo := range data.Repositories {
+		for _, topic := range repo.Topics {
+			counts[topic]++
+		}
+	}
+	topics := make([]string, 0, len(counts))
+	for topic := range counts {
+		topics = append(topics, topic)
+	}
+	sort.Slice(topics, func(i, j int) bool {
+		if counts[topics[i]] != counts[topics[j]] {
+			return counts[topics[i]] > counts[topics[j]]
+		}
+		return topics[i] < topics[j]
+	})
+
+	for _, topic := range topics {
+		if len(keywords) >= n {
+			break
+		}
+		if !containsFold(keywords, topic) {
+			keywords = append(keywords, topic)
+		}
+	}
+	return keywords
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"opengptmservice/internal/models"
+)
+
+func atsTestCV() *models.CV {
+	return &models.CV{Sections: []models.CVSection{
+		{Name: SectionHeader, Content: "# Jane Doe\n\n[GitHub](https://github.com/jdoe) · Berlin"},
+		{Name: SectionSummary, Title: "Professional Summary", Content: "Backend **developer** writing Go and Node.js services."},
+		{Name: SectionSkills, Title: "Technical Skills", Content: "- **Languages:** Go, C++\n  - Python\n- Docker ![logo](logo.png)"},
+		{Name: SectionProjects, Title: "Things I Built 🚀", Content: "| Project | Stars |\n| --- | --- |\n| [website](https://github.com/jdoe/website) | 10 |"},
+	}}
+}
+
+func TestATSText(t *testing.T) {
+	want := `Jane Doe
+
+GitHub (https://github.com/jdoe) · Berlin
+
+SUMMARY
+
+Backend developer writing Go and Node.js services.
+
+SKILLS
+
+- Languages: Go, C++
+  - Python
+- Docker
+
+THINGS I BUILT 🚀
+
+- Project: website (https://github.com/jdoe/website); Stars: 10
+`
+	if got := ATSText(atsTestCV()); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestATSHeading(t *testing.T) {
+	for title, want := range map[string]string{
+		"Professional Experience":   "EXPERIENCE",
+		"Skills & Tools":            "SKILLS & TOOLS",
+		"Licenses & Certifications": "CERTIFICATIONS",
+		"work history:":             "EXPERIENCE",
+	} {
+		if got, _ := ATSHeading(title); got != want {
+			t.Errorf("ATSHeading(%q) = %q, want %q", title, got, want)
+		}
+	}
+}
+
+func TestAnalyzeATS(t *testing.T) {
+	report := AnalyzeATS(atsTestCV(), []string{"Go", "node.js", "c++", "Kubernetes"})
+
+	if !reflect.DeepEqual(report.NonStandardSections, []string{"Things I Built 🚀"}) {
+		t.Errorf("got non-standard sections %v", report.NonStandardSections)
+	}
+	if !reflect.DeepEqual(report.MissingContact, []string{"email", "phone"}) {
+		t.Errorf("got missing contact information %v", report.MissingContact)
+	}
+	counts := make(map[string]int)
+	for _, k := range report.Keywords {
+		counts[k.Keyword] = k.Count
+	}
+	if counts["Go"] != 2 || counts["node.js"] != 1 || counts["c++"] != 1 || counts["Kubernetes"] != 0 {
+		t.Errorf("got keyword counts %v", counts)
+	}
+	if report.KeywordScore != 75 {
+		t.Errorf("got keyword score %d, want 75", report.KeywordScore)
+	}
+	// Penalties: a non-standard section, email, phone, a table, an image,
+	// an emoji and a short CV
+	if report.Parseability != 100-5-15-10-10-10-5-10 {
+		t.Errorf("got parseability %d", report.Parseability)
+	}
+	for _, want := range []string{"Kubernetes", "tables", "Images"} {
+		if !strings.Contains(strings.Join(report.Issues, "\n"), want) {
+			t.Errorf("issues do not mention %q: %v", want, report.Issues)
+		}
+	}
+
+	stuffed := &models.CV{Sections: []models.CVSection{{Title: "Skills", Content: "Go Go Go developer"}}}
+	if report := AnalyzeATS(stuffed, []string{"go"}); report.Keywords[0].Density != 60 || !strings.Contains(strings.Join(report.Issues, "\n"), "stuffing") {
+		t.Errorf("keyword stuffing not reported: %+v", report)
+	}
+}
+
+func TestATSKeywords(t *testing.T) {
+	data := privacyTestData()
+	data.Repositories[0].Language = "Go"
+	data.Repositories[0].Topics = []string{"web", "go"}
+	data.Repositories[2].Topics = []string{"web"}
+
+	if got := ATSKeywords(data, 3); !reflect.DeepEqual(got, []string{"Go", "Python", "web"}) {
+		t.Errorf("got keywords %v", got)
+	}
+}
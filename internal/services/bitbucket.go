@@ -0,0 +1,240 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"opengptmservice/internal/auth"
+	"opengptmservice/internal/models"
+	"opengptmservice/internal/retry"
+)
+
+// BitbucketService collects a developer's activity from Bitbucket Cloud
+type BitbucketService struct {
+	host   *auth.Host
+	policy retry.Policy
+}
+
+// NewBitbucketService creates a new Bitbucket service instance for host
+func NewBitbucketService(host *auth.Host) *BitbucketService {
+	return &BitbucketService{
+		host:   host,
+		policy: newAPIPolicy("Bitbucket API (" + host.Name + ")"),
+	}
+}
+
+// bitbucketLink is the shape of the links in Bitbucket API responses
+type bitbucketLink struct {
+	Href string `json:"href"`
+}
+
+// GetUserData fetches the user's profile, repositories, workspaces and pull
+// requests from Bitbucket, aborting when ctx is done. Bitbucket has no stars,
+// so repositories are ordered by their last update.
+func (s *BitbucketService) GetUserData(ctx context.Context, accessToken string) (*models.DeveloperData, error) {
+	profile, uuid, err := s.getUserProfile(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	workspaces, err := s.getWorkspaces(ctx, accessToken)
+	if err != nil {
+		log.Printf("Warning: Failed to get workspaces: %v", err)
+	}
+
+	prs, err := s.getPullRequests(ctx, accessToken, uuid)
+	if err != nil {
+		log.Printf("Warning: Failed to get pull requests: %v", err)
+	}
+
+	repos, err := s.getRepositories(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	profile.PublicRepos = len(repos)
+
+	return &models.DeveloperData{
+		Profile:       profile,
+		Repositories:  repos,
+		Organizations: workspaces,
+		PullRequests:  prs,
+	}, nil
+}
+
+// getJSON fetches a Bitbucket API URL and decodes the JSON response into v
+func (s *BitbucketService) getJSON(ctx context.Context, accessToken, url string, v interface{}) error {
+	return getBearerJSON(ctx, s.host, s.policy, accessToken, url, v)
+}
+
+func (s *BitbucketService) getUserProfile(ctx context.Context, accessToken string) (*models.UserProfile, string, error) {
+	var user struct {
+		UUID        string `json:"uuid"`
+		Username    string `json:"username"`
+		DisplayName string `json:"display_name"`
+		Location    string `json:"location"`
+		CreatedOn   string `json:"created_on"`
+		Links       struct {
+			HTML bitbucketLink `json:"html"`
+		} `json:"links"`
+	}
+	if err := s.getJSON(ctx, accessToken, s.host.APIURL+"/user", &user); err != nil {
+		return nil, "", fmt.Errorf("failed to get user profile: %w", err)
+	}
+
+	return &models.UserProfile{
+		Login:     user.Username,
+		Name:      user.DisplayName,
+		Location:  user.Location,
+		CreatedAt: user.CreatedOn,
+		HTMLURL:   user.Links.HTML.Href,
+		Provider:  "Bitbucket",
+	}, user.UUID, nil
+}
+
+func (s *BitbucketService) getWorkspaces(ctx context.Context, accessToken string) ([]models.Organization, error) {
+	var page struct {
+		Values []struct {
+			Slug  string `json:"slug"`
+			Name  string `json:"name"`
+			Links struct {
+				HTML   bitbucketLink `json:"html"`
+				Avatar bitbucketLink `json:"avatar"`
+			} `json:"links"`
+		} `json:"values"`
+	}
+	if err := s.getJSON(ctx, accessToken, s.host.APIURL+"/workspaces?role=member&pagelen=100", &page); err != nil {
+		return nil, fmt.Errorf("failed to get workspaces: %w", err)
+	}
+
+	orgs := make([]models.Organization, len(page.Values))
+	for i, w := range page.Values {
+		orgs[i] = models.Organization{
+			Login:       w.Slug,
+			Description: w.Name,
+			AvatarURL:   w.Links.Avatar.Href,
+			Type:        "Workspace",
+			HTMLURL:     w.Links.HTML.Href,
+		}
+	}
+
+	return orgs, nil
+}
+
+func (s *BitbucketService) getPullRequests(ctx context.Context, accessToken, uuid string) ([]models.PullRequest, error) {
+	var page struct {
+		Values []struct {
+			ID        int       `json:"id"`
+			Title     string    `json:"title"`
+			State     string    `json:"state"`
+			CreatedOn time.Time `json:"created_on"`
+			UpdatedOn time.Time `json:"updated_on"`
+			Links     struct {
+				HTML bitbucketLink `json:"html"`
+			} `json:"links"`
+			Destination struct {
+				Repository struct {
+					Links struct {
+						HTML bitbucketLink `json:"html"`
+					} `json:"links"`
+				} `json:"repository"`
+			} `json:"destination"`
+		} `json:"values"`
+	}
+	prURL := fmt.Sprintf("%s/pullrequests/%s?state=OPEN&state=MERGED&state=DECLINED&pagelen=50", s.host.APIURL, url.PathEscape(uuid))
+	if err := s.getJSON(ctx, accessToken, prURL, &page); err != nil {
+		return nil, fmt.Errorf("failed to get pull requests: %w", err)
+	}
+
+	prs := make([]models.PullRequest, len(page.Values))
+	for i, pr := range page.Values {
+		// Bitbucket pull requests are OPEN, MERGED, DECLINED or SUPERSEDED
+		state := "closed"
+		if pr.State == "OPEN" {
+			state = "open"
+		}
+		prs[i] = models.PullRequest{
+			Title:     pr.Title,
+			State:     state,
+			CreatedAt: pr.CreatedOn,
+			UpdatedAt: pr.UpdatedOn,
+			Repo:      pr.Destination.Repository.Links.HTML.Href,
+			Number:    pr.ID,
+			HTMLURL:   pr.Links.HTML.Href,
+		}
+	}
+
+	return prs, nil
+}
+
+func (s *BitbucketService) getRepositories(ctx context.Context, accessToken string) ([]models.Repository, error) {
+	var page struct {
+		Values []struct {
+			Name        string    `json:"name"`
+			Description string    `json:"description"`
+			Language    string    `json:"language"`
+			IsPrivate   bool      `json:"is_private"`
+			CreatedOn   time.Time `json:"created_on"`
+			UpdatedOn   time.Time `json:"updated_on"`
+			Links       struct {
+				HTML bitbucketLink `json:"html"`
+			} `json:"links"`
+			Owner struct {
+				Type string `json:"type"`
+			} `json:"owner"`
+			Workspace struct {
+				Slug string `json:"slug"`
+			} `json:"workspace"`
+		} `json:"values"`
+	}
+	if err := s.getJSON(ctx, accessToken, s.host.APIURL+"/repositories?role=member&sort=-updated_on&pagelen=100", &page); err != nil {
+		return nil, fmt.Errorf("failed to get repositories: %w", err)
+	}
+
+	repos := make([]models.Repository, len(page.Values))
+	for i, r := range page.Values {
+		repos[i] = models.Repository{
+			Name:        r.Name,
+			Description: r.Description,
+			Language:    bitbucketLanguage(r.Language),
+			CreatedAt:   r.CreatedOn,
+			UpdatedAt:   r.UpdatedOn,
+			HTMLURL:     r.Links.HTML.Href,
+			Private:     r.IsPrivate,
+		}
+		repos[i].Owner.Login = r.Workspace.Slug
+		repos[i].Owner.Type = "User"
+		if r.Owner.Type == "team" {
+			repos[i].Owner.Type = "Organization"
+		}
+	}
+
+	return repos, nil
+}
+
+// bitbucketLanguages maps the lowercase language names used by Bitbucket to
+// the names used by GitHub where capitalizing is not enough
+var bitbucketLanguages = map[string]string{
+	"c#":          "C#",
+	"c++":         "C++",
+	"css":         "CSS",
+	"html/css":    "HTML",
+	"javascript":  "JavaScript",
+	"objective-c": "Objective-C",
+	"php":         "PHP",
+	"typescript":  "TypeScript",
+}
+
+// bitbucketLanguage returns the GitHub name of a Bitbucket language
+func bitbucketLanguage(language string) string {
+	if name, ok := bitbucketLanguages[language]; ok {
+		return name
+	}
+	if language == "" {
+		return ""
+	}
+	return strings.ToUpper(language[:1]) + language[1:]
+}
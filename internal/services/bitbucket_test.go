@@ -0,0 +1,58 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"opengptmservice/internal/auth"
+)
+
+// bitbucketResponses are canned Bitbucket Cloud API 2.0 responses keyed by request URI
+var bitbucketResponses = map[string]string{
+	"/user": `{"uuid": "{1234}", "username": "jdoe", "display_name": "Jane Doe",
+		"created_on": "2012-02-01T00:00:00Z", "links": {"html": {"href": "https://bitbucket.org/jdoe/"}}}`,
+	"/workspaces?role=member&pagelen=100": `{"values": [{"slug": "acme", "name": "Acme Inc",
+		"links": {"html": {"href": "https://bitbucket.org/acme/"}}}]}`,
+	"/pullrequests/%7B1234%7D?state=OPEN&state=MERGED&state=DECLINED&pagelen=50": `{"values": [
+		{"id": 3, "title": "Add retries", "state": "MERGED", "created_on": "2024-01-01T00:00:00Z",
+		 "updated_on": "2024-01-02T00:00:00Z", "links": {"html": {"href": "https://bitbucket.org/acme/api/pull-requests/3"}},
+		 "destination": {"repository": {"links": {"html": {"href": "https://bitbucket.org/acme/api"}}}}}]}`,
+	"/repositories?role=member&sort=-updated_on&pagelen=100": `{"values": [
+		{"name": "api", "description": "Public API", "language": "javascript", "owner": {"type": "team"},
+		 "workspace": {"slug": "acme"}, "links": {"html": {"href": "https://bitbucket.org/acme/api"}}},
+		{"name": "scripts", "language": "python", "owner": {"type": "user"},
+		 "workspace": {"slug": "jdoe"}, "links": {"html": {"href": "https://bitbucket.org/jdoe/scripts"}}}]}`,
+}
+
+func TestBitbucketGetUserData(t *testing.T) {
+	server := newCannedServer(t, bitbucketResponses)
+	host, err := auth.NewHost(auth.HostConfig{Type: auth.TypeBitbucket, APIURL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := NewCollector(host).GetUserData(context.Background(), "test-token")
+	if err != nil {
+		t.Fatalf("GetUserData: %v", err)
+	}
+
+	p := data.Profile
+	if p.Login != "jdoe" || p.Name != "Jane Doe" || p.Provider != "Bitbucket" || p.PublicRepos != 2 {
+		t.Errorf("unexpected profile %+v", p)
+	}
+	if len(data.Repositories) != 2 {
+		t.Fatalf("got %d repositories, want 2", len(data.Repositories))
+	}
+	if api := data.Repositories[0]; api.Language != "JavaScript" || api.Owner.Login != "acme" || api.Owner.Type != "Organization" {
+		t.Errorf("unexpected repository %+v", api)
+	}
+	if lang := data.Repositories[1].Language; lang != "Python" {
+		t.Errorf("got language %q, want Python", lang)
+	}
+	if len(data.Organizations) != 1 || data.Organizations[0].Login != "acme" {
+		t.Errorf("unexpected workspaces %+v", data.Organizations)
+	}
+	if len(data.PullRequests) != 1 || data.PullRequests[0].State != "closed" || data.PullRequests[0].Repo != "https://bitbucket.org/acme/api" {
+		t.Errorf("unexpected pull requests %+v", data.PullRequests)
+	}
+}
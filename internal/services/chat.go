@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"opengptmservice/internal/models"
+)
+
+// RouteChat is the llm.routes key of the refinement chat
+const RouteChat = "chat"
+
+// maxChatTurns is the number of previous turns sent to the LLM along with
+// each instruction
+const maxChatTurns = 10
+
+// chatSystemPrompt sets up the refinement chat
+const chatSystemPrompt = `You refine the software developer CV of the user, written in markdown, following their instructions one at a time.
+
+Apply each instruction to the latest version of the CV and change nothing else. Keep every "## " section heading unless the instruction asks to change it. Keep the facts of the CV and do not invent experience, employers, dates or skills. Respond with the complete revised CV in markdown and nothing else.`
+
+// Chat is a conversation with the LLM refining a CV, one instruction of the
+// user per turn
+type Chat struct {
+	Turns []ChatTurn `json:"turns"`
+}
+
+// ChatTurn is an instruction of the user and the CV the LLM answered with
+type ChatTurn struct {
+	Instruction string `json:"instruction"`
+	// Result is the markdown of the CV after the turn
+	Result string `json:"result"`
+	// Previous is the CV before the turn and PreviousID the ID of its stored
+	// version, restored by undo
+	Previous   *models.CV `json:"-"`
+	PreviousID string     `json:"-"`
+}
+
+// Add records a turn that turned previous, stored as previousID, into result
+func (c *Chat) Add(instruction string, previous *models.CV, previousID string, result *models.CV) {
+	c.Turns = append(c.Turns, ChatTurn{
+		Instruction: instruction,
+		Result:      result.Markdown(),
+		Previous:    previous,
+		PreviousID:  previousID,
+	})
+}
+
+// Undo removes the last turn and returns it, or returns false when there is
+// no turn to undo
+func (c *Chat) Undo() (ChatTurn, bool) {
+	if len(c.Turns) == 0 {
+		return ChatTurn{}, false
+	}
+	turn := c.Turns[len(c.Turns)-1]
+	c.Turns = c.Turns[:len(c.Turns)-1]
+	return turn, true
+}
+
+// Messages returns the conversation sent to the LLM for instruction on cv:
+// the system prompt, the last turns and the instruction. The CV is sent
+// along with the first instruction and whenever it changed since the last
+// answer, e.g. because the user edited it.
+func (c *Chat) Messages(cv *models.CV, instruction string) []Message {
+	messages := []Message{{Role: RoleSystem, Content: chatSystemPrompt}}
+	turns := c.Turns
+	if len(turns) > maxChatTurns {
+		turns = turns[len(turns)-maxChatTurns:]
+	}
+
+	last := ""
+	for _, turn := range turns {
+		messages = append(messages,
+			Message{Role: RoleUser, Content: chatInstruction(turn.Previous, last, turn.Instruction)},
+			Message{Role: RoleAssistant, Content: turn.Result})
+		last = turn.Result
+	}
+	return append(messages, Message{Role: RoleUser, Content: chatInstruction(cv, last, instruction)})
+}
+
+// chatInstruction returns the message of an instruction on cv, which is
+// included unless it is the last answer of the LLM
+func chatInstruction(cv *models.CV, last, instruction string) string {
+	markdown := cv.Markdown()
+	if markdown == last {
+		return instruction
+	}
+	return "My CV is now:\n\n" + markdown + "\nInstruction: " + instruction
+}
+
+// Refine applies the instruction of the user to cv as the next turn of chat
+// and returns the revised CV. The caller adds the turn to chat.
+func (s *CVService) Refine(ctx context.Context, data *models.DeveloperData, chat *Chat, cv *models.CV, instruction string, opts GenerateOptions) (*models.CV, error) {
+	if !s.llmAvailable() {
+		return nil, errors.New("refining a CV requires an LLM")
+	}
+	redactor := s.redactor(data, opts)
+	messages := chat.Messages(cv, strings.TrimSpace(instruction))
+	for i := range messages {
+		messages[i].Content = redactor.Redact(messages[i].Content)
+	}
+
+	log.Printf("Refining CV in chat (turn %d)", len(chat.Turns)+1)
+	completion, err := s.llm.Chat(ctx, messages, RouteChat, opts.Length)
+	if err != nil {
+		return nil, err
+	}
+	markdown := cleanRevision(redactor.Restore(completion.Text))
+	if markdown == "" {
+		return nil, fmt.Errorf("%s: empty response", completion.Model)
+	}
+	return cv.Revise(markdown, completion.Model), nil
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"opengptmservice/internal/models"
+)
+
+func chatTestCV(summary string) *models.CV {
+	return &models.CV{Sections: []models.CVSection{
+		{Name: SectionHeader, Content: "# Jane Doe"},
+		{Name: SectionSummary, Title: "Summary", Content: summary},
+	}}
+}
+
+func TestChatMessages(t *testing.T) {
+	var chat Chat
+	first := chatTestCV("Long summary")
+	messages := chat.Messages(first, "shorten the summary")
+	if len(messages) != 2 || messages[0].Role != RoleSystem || messages[1].Role != RoleUser ||
+		!strings.Contains(messages[1].Content, "## Summary\n\nLong summary") || !strings.HasSuffix(messages[1].Content, "Instruction: shorten the summary") {
+		t.Fatalf("got first messages %+v", messages)
+	}
+
+	second := chatTestCV("Short")
+	chat.Add("shorten the summary", first, "v1", second)
+	messages = chat.Messages(second, "mention Go")
+	if len(messages) != 4 || messages[2].Role != RoleAssistant || messages[2].Content != second.Markdown() || messages[3].Content != "mention Go" {
+		t.Errorf("got messages %+v, want the instruction alone", messages)
+	}
+
+	// A CV changed outside the chat is sent again
+	edited := chatTestCV("Edited by hand")
+	if messages := chat.Messages(edited, "mention Go"); !strings.Contains(messages[3].Content, "Edited by hand") {
+		t.Errorf("edited CV not sent: %q", messages[3].Content)
+	}
+
+	turn, ok := chat.Undo()
+	if !ok || turn.Previous != first || turn.PreviousID != "v1" || len(chat.Turns) != 0 {
+		t.Errorf("got undone turn %+v, %v", turn, ok)
+	}
+	if _, ok := chat.Undo(); ok {
+		t.Error("undid a turn of an empty chat")
+	}
+}
+
+func TestChatMessagesKeepsLastTurns(t *testing.T) {
+	var chat Chat
+	cv := chatTestCV("Summary 0")
+	for i := 1; i <= maxChatTurns+2; i++ {
+		next := chatTestCV(fmt.Sprintf("Summary %d", i))
+		chat.Add(fmt.Sprintf("turn %d", i), cv, "", next)
+		cv = next
+	}
+
+	messages := chat.Messages(cv, "next")
+	if len(messages) != 2+2*maxChatTurns {
+		t.Fatalf("got %d messages, want %d", len(messages), 2+2*maxChatTurns)
+	}
+	// The oldest turn sent carries the CV it started from
+	if !strings.Contains(messages[1].Content, "Summary 2") || !strings.HasSuffix(messages[1].Content, "Instruction: turn 3") {
+		t.Errorf("oldest turn sent without its CV: %q", messages[1].Content)
+	}
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"opengptmservice/internal/auth"
+	"opengptmservice/internal/models"
+	"opengptmservice/internal/retry"
+)
+
+// Collector collects a developer's activity from one code hosting service
+type Collector interface {
+	GetUserData(ctx context.Context, accessToken string) (*models.DeveloperData, error)
+}
+
+// ReadmeReader is implemented by collectors that can read the README of a
+// repository on their host
+type ReadmeReader interface {
+	GetReadme(ctx context.Context, accessToken string, repo models.Repository) (string, error)
+}
+
+// NewCollector creates the collector for the type of host
+func NewCollector(host *auth.Host) Collector {
+	switch host.Type {
+	case auth.TypeGitLab:
+		return NewGitLabService(host)
+	case auth.TypeGitea:
+		return NewGiteaService(host)
+	case auth.TypeBitbucket:
+		return NewBitbucketService(host)
+	}
+	return NewGitHubService(host)
+}
+
+// newAPIPolicy returns the retry policy used for the API of a code hosting service
+func newAPIPolicy(name string) retry.Policy {
+	return retry.Policy{
+		Name:        name,
+		MaxAttempts: 3,
+		BaseDelay:   time.Second,
+		MaxDelay:    10 * time.Second,
+		MaxElapsed:  time.Minute,
+		Jitter:      0.2,
+		Breaker:     retry.NewBreaker(name, 10, time.Minute),
+	}
+}
+
+// getBearerJSON fetches url with accessToken as bearer token and decodes the
+// JSON response into v, retrying according to policy
+func getBearerJSON(ctx context.Context, host *auth.Host, policy retry.Policy, accessToken, url string, v interface{}) error {
+	return policy.Do(ctx, func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return retry.Permanent(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		req.Header.Set("Accept", "application/json")
+
+		resp, err := host.Client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			return retry.NewHTTPError(resp, body)
+		}
+
+		return json.NewDecoder(resp.Body).Decode(v)
+	})
+}
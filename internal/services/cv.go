@@ -1,29 +1,206 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
 
+	"opengptmservice/internal/limiter"
 	"opengptmservice/internal/models"
+	"opengptmservice/internal/usage"
 )
 
+// Generation modes supported by CVService.Generate
+const (
+	ModeSingle   = "single"
+	ModePipeline = "pipeline"
+	ModeTemplate = "template"
+)
+
+// CV lengths supported by GenerateOptions. Each length can be routed to
+// different models with llm.routes.
+const (
+	LengthShort    = "short"
+	LengthStandard = "standard"
+	LengthLong     = "long"
+)
+
+// lengthInstructions is appended to prompts to control the CV length
+var lengthInstructions = map[string]string{
+	LengthShort: "\n\nKeep it concise: the whole CV must fit on a single page.",
+	LengthLong:  "\n\nBe thorough and describe projects and contributions in detail.",
+}
+
+// GenerateOptions controls how a CV is generated
+type GenerateOptions struct {
+	Mode   string `json:"mode"`
+	Length string `json:"length"`
+	// Force skips the cache and always generates a new CV
+	Force bool `json:"-"`
+	// Redact replaces personal identifiers in prompts with placeholders
+	Redact bool `json:"redact"`
+}
+
 // CVService handles CV generation operations
 type CVService struct {
-	atomaClient *AtomaClient
+	llm       *ModelRouter
+	templates *TemplateGenerator
+	cache     *CVCache
+	redaction RedactionConfig
 }
 
-// NewCVService creates a new CV service instance
-func NewCVService() *CVService {
-	config := NewAtomaConfig()
+// NewCVService creates a new CV service instance recording LLM usage in
+// tracker, limiting concurrent LLM calls with limits and caching generated
+// CVs in cvCache, which may be nil
+func NewCVService(tracker *usage.Tracker, limits *limiter.Group, cvCache *CVCache) *CVService {
 	return &CVService{
-		atomaClient: NewAtomaClient(config),
+		llm:       NewModelRouter(tracker, limits),
+		templates: NewTemplateGenerator(),
+		cache:     cvCache,
+		redaction: NewRedactionConfig(),
+	}
+}
+
+// Generate generates a CV using the given options. When the LLM is not
+// configured or fails, the CV is built from templates instead. LLM generated
+// CVs are cached unless opts.Force is set.
+func (s *CVService) Generate(ctx context.Context, data *models.DeveloperData, opts GenerateOptions) (*models.CV, error) {
+	if opts.Mode == ModeTemplate {
+		return s.templates.Generate(data)
+	}
+	if !s.llmAvailable() {
+		log.Printf("Warning: No LLM API key configured, generating CV from templates")
+		return s.templateFallback(data)
+	}
+
+	key := cacheKey(data, s.llm.Signature(), opts)
+	if !opts.Force {
+		if cv, ok := s.cache.Get(key); ok {
+			log.Printf("Using cached CV for %s", data.Profile.Login)
+			return cv, nil
+		}
+	}
+
+	cv, err := s.generateLLM(ctx, data, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Never cache degraded CVs so the next attempt uses the LLM again
+	for _, section := range cv.Sections {
+		if section.Fallback {
+			return cv, nil
+		}
+	}
+	s.cache.Set(key, cv)
+	return cv, nil
+}
+
+// CacheStats returns the CV cache hit and miss counters
+func (s *CVService) CacheStats() CacheStats {
+	return s.cache.Stats()
+}
+
+// generateLLM generates a CV with the LLM in single prompt or pipeline mode
+func (s *CVService) generateLLM(ctx context.Context, data *models.DeveloperData, opts GenerateOptions) (*models.CV, error) {
+	if opts.Mode == ModePipeline {
+		return s.GenerateCVPipeline(ctx, data, opts)
+	}
+
+	completion, err := s.GenerateCV(ctx, data, opts)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if unavailable(err) {
+			return nil, err
+		}
+		log.Printf("Warning: Failed to generate CV with LLM, generating from templates: %v", err)
+		return s.templateFallback(data)
+	}
+	return &models.CV{Sections: []models.CVSection{{
+		Name:    "cv",
+		Content: completion.Text,
+		Model:   completion.Model,
+	}}}, nil
+}
+
+// unavailable reports whether err means the LLM refused the call because the
+// budget is spent or too many calls are waiting, which callers report to the
+// user rather than falling back to templates
+func unavailable(err error) bool {
+	return errors.Is(err, usage.ErrBudgetExceeded) || errors.Is(err, limiter.ErrQueueFull)
+}
+
+// llmAvailable reports whether any LLM model is configured
+func (s *CVService) llmAvailable() bool {
+	return s.llm.Available()
+}
+
+// templateFallback generates a template CV with every section marked as fallback
+func (s *CVService) templateFallback(data *models.DeveloperData) (*models.CV, error) {
+	cv, err := s.templates.Generate(data)
+	if err != nil {
+		return nil, err
+	}
+	for i := range cv.Sections {
+		cv.Sections[i].Fallback = true
+	}
+	return cv, nil
+}
+
+// Prompt is a prompt sent to the LLM, shown to users before generation
+type Prompt struct {
+	Title string
+	Text  string
+}
+
+// Prompts returns the prompts Generate sends to the LLM for data with opts,
+// none when the CV is built from templates
+func (s *CVService) Prompts(data *models.DeveloperData, opts GenerateOptions) []Prompt {
+	if opts.Mode == ModeTemplate || !s.llmAvailable() {
+		return nil
+	}
+	redactor := s.redactor(data, opts)
+	if opts.Mode != ModePipeline {
+		return []Prompt{{Title: "CV", Text: redactor.Redact(s.cvPrompt(data, opts))}}
+	}
+
+	prompts := make([]Prompt, len(pipelineSections))
+	for i, spec := range pipelineSections {
+		prompts[i] = Prompt{Title: spec.title, Text: redactor.Redact(s.sectionPrompt(data, spec, opts))}
 	}
+	return prompts
 }
 
-// GenerateCV generates a CV based on GitHub data
-func (s *CVService) GenerateCV(data *models.GitHubData) (string, error) {
+// redactor returns the redactor of the personal identifiers in data, nil
+// when the prompts are not redacted
+func (s *CVService) redactor(data *models.DeveloperData, opts GenerateOptions) *Redactor {
+	if !opts.Redact && !s.redaction.Always {
+		return nil
+	}
+	return NewRedactor(data.Profile, s.redaction.Fields)
+}
+
+// GenerateCV generates a CV based on GitHub data with a single prompt
+func (s *CVService) GenerateCV(ctx context.Context, data *models.DeveloperData, opts GenerateOptions) (*Completion, error) {
+	redactor := s.redactor(data, opts)
+
+	log.Printf("Generating CV with LLM")
+	completion, err := s.llm.Generate(ctx, redactor.Redact(s.cvPrompt(data, opts)), opts.Length)
+	if err != nil {
+		return nil, err
+	}
+	completion.Text = redactor.Restore(completion.Text)
+	return completion, nil
+}
+
+// cvPrompt returns the single prompt generating the whole CV
+func (s *CVService) cvPrompt(data *models.DeveloperData, opts GenerateOptions) string {
 	// Create a detailed prompt for CV generation
-	prompt := fmt.Sprintf(`Generate a professional CV for a software developer based on their GitHub profile and activity.
+	return fmt.Sprintf(`Generate a professional CV for a software developer based on their GitHub profile and activity.
 
 User Profile:
 - Name: %s
@@ -38,6 +215,7 @@ User Profile:
 - Followers: %d
 - Following: %d
 - Member since: %s
+- Contributions in the last year: %s
 
 Organizations:
 %s
@@ -57,7 +235,7 @@ Please generate a professional CV in markdown format with the following sections
 6. Social Presence (GitHub, Twitter, Blog)
 7. Additional Information
 
-Format the CV in a clean, professional style using markdown. Include relevant links to GitHub repositories and pull requests.`,
+Format the CV in a clean, professional style using markdown. Include relevant links to GitHub repositories and pull requests.%s`,
 		data.Profile.Name,
 		data.Profile.Login,
 		data.Profile.Bio,
@@ -70,12 +248,19 @@ Format the CV in a clean, professional style using markdown. Include relevant li
 		data.Profile.Followers,
 		data.Profile.Following,
 		data.Profile.CreatedAt,
+		s.formatContributions(data.Contributions),
 		s.formatOrganizations(data.Organizations),
-		s.formatRepositories(data.Repositories),
-		s.formatPullRequests(data.PullRequests))
+		s.formatRepositories(data.Repositories)+s.formatPrivateLanguages(data.PrivateLanguages),
+		s.formatPullRequests(data.PullRequests),
+		lengthInstructions[opts.Length])
+}
 
-	log.Printf("Generating CV with Atoma API")
-	return s.atomaClient.GenerateText(prompt)
+func (s *CVService) formatContributions(c *models.ContributionStats) string {
+	if c == nil {
+		return "unknown"
+	}
+	return fmt.Sprintf("%d (%d commits, %d pull requests, %d reviews, %d issues)",
+		c.TotalContributions, c.Commits, c.PullRequests, c.Reviews, c.Issues)
 }
 
 func (s *CVService) formatOrganizations(orgs []models.Organization) string {
@@ -89,16 +274,30 @@ func (s *CVService) formatOrganizations(orgs []models.Organization) string {
 func (s *CVService) formatRepositories(repos []models.Repository) string {
 	var result string
 	for _, repo := range repos {
-		result += fmt.Sprintf("- %s: %s (Language: %s, Stars: %d, Forks: %d)\n",
+		result += fmt.Sprintf("- %s: %s (Language: %s, Stars: %d, Forks: %d, URL: %s)\n",
 			repo.Name,
 			repo.Description,
 			repo.Language,
 			repo.Stars,
-			repo.Forks)
+			repo.Forks,
+			repo.HTMLURL)
 	}
 	return result
 }
 
+// formatPrivateLanguages lists the languages of the private repositories
+// only included in the language statistics
+func (s *CVService) formatPrivateLanguages(private map[string]int) string {
+	if len(private) == 0 {
+		return ""
+	}
+	var languages []string
+	for _, l := range languageStats(nil, private) {
+		languages = append(languages, fmt.Sprintf("%s (%d)", l.Name, l.Repos))
+	}
+	return fmt.Sprintf("- Private repositories by language: %s\n", strings.Join(languages, ", "))
+}
+
 func (s *CVService) formatPullRequests(prs []models.PullRequest) string {
 	var result string
 	for _, pr := range prs {
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"opengptmservice/internal/cache"
+	"opengptmservice/internal/models"
+)
+
+// PromptVersion identifies the prompt templates. Bump it whenever prompts
+// change so cached CVs generated with older prompts are not reused.
+const PromptVersion = 4
+
+// CacheStats reports how effective the CV cache is
+type CacheStats struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+	Errors int64 `json:"errors"`
+}
+
+// CVCache caches generated CVs keyed by a fingerprint of their inputs
+type CVCache struct {
+	store cache.Store
+	ttl   time.Duration
+
+	hits   atomic.Int64
+	misses atomic.Int64
+	errors atomic.Int64
+}
+
+// NewCVCache creates a CV cache on top of store. A nil store disables caching.
+func NewCVCache(store cache.Store, ttl time.Duration) *CVCache {
+	return &CVCache{store: store, ttl: ttl}
+}
+
+// Get returns the cached CV for key
+func (c *CVCache) Get(key string) (*models.CV, bool) {
+	if c == nil || c.store == nil {
+		return nil, false
+	}
+
+	data, ok, err := c.store.Get(key)
+	if err != nil {
+		c.errors.Add(1)
+		log.Printf("Warning: Failed to read CV cache: %v", err)
+		return nil, false
+	}
+	if !ok {
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	var cv models.CV
+	if err := json.Unmarshal(data, &cv); err != nil {
+		c.errors.Add(1)
+		log.Printf("Warning: Failed to decode cached CV: %v", err)
+		return nil, false
+	}
+	c.hits.Add(1)
+	return &cv, true
+}
+
+// Set stores cv under key
+func (c *CVCache) Set(key string, cv *models.CV) {
+	if c == nil || c.store == nil {
+		return
+	}
+
+	data, err := json.Marshal(cv)
+	if err == nil {
+		err = c.store.Set(key, data, c.ttl)
+	}
+	if err != nil {
+		c.errors.Add(1)
+		log.Printf("Warning: Failed to write CV cache: %v", err)
+	}
+}
+
+// Stats returns the cache hit and miss counters
+func (c *CVCache) Stats() CacheStats {
+	if c == nil {
+		return CacheStats{}
+	}
+	return CacheStats{
+		Hits:   c.hits.Load(),
+		Misses: c.misses.Load(),
+		Errors: c.errors.Load(),
+	}
+}
+
+// cacheKey returns a stable hash of everything that affects the generated CV:
+// the normalized GitHub data, the prompt version, the models and the options
+func cacheKey(data *models.DeveloperData, modelSignature string, opts GenerateOptions) string {
+	payload, err := json.Marshal(struct {
+		Data          *models.DeveloperData
+		PromptVersion int
+		Models        string
+		Mode          string
+		Length        string
+	}{normalizeDeveloperData(data), PromptVersion, modelSignature, opts.Mode, opts.Length})
+	if err != nil {
+		// DeveloperData only holds plain values, so this cannot happen
+		panic(err)
+	}
+
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeDeveloperData returns a copy of data with all lists in a stable order
+// and fields that change without affecting the CV cleared
+func normalizeDeveloperData(data *models.DeveloperData) *models.DeveloperData {
+	normalized := &models.DeveloperData{
+		Profile:       data.Profile,
+		Repositories:  make([]models.Repository, len(data.Repositories)),
+		Organizations: append([]models.Organization(nil), data.Organizations...),
+		PullRequests:  make([]models.PullRequest, len(data.PullRequests)),
+		Contributions: data.Contributions,
+	}
+	for i, pr := range data.PullRequests {
+		pr.UpdatedAt = time.Time{}
+		normalized.PullRequests[i] = pr
+	}
+
+	for i, repo := range data.Repositories {
+		repo.UpdatedAt = time.Time{}
+		repo.Topics = append([]string(nil), repo.Topics...)
+		sort.Strings(repo.Topics)
+		normalized.Repositories[i] = repo
+	}
+	sort.Slice(normalized.Repositories, func(i, j int) bool {
+		a, b := normalized.Repositories[i], normalized.Repositories[j]
+		return strings.ToLower(a.Owner.Login+"/"+a.Name) < strings.ToLower(b.Owner.Login+"/"+b.Name)
+	})
+	sort.Slice(normalized.Organizations, func(i, j int) bool {
+		return normalized.Organizations[i].Login < normalized.Organizations[j].Login
+	})
+	sort.Slice(normalized.PullRequests, func(i, j int) bool {
+		a, b := normalized.PullRequests[i], normalized.PullRequests[j]
+		if a.Repo != b.Repo {
+			return a.Repo < b.Repo
+		}
+		return a.Number < b.Number
+	})
+
+	return normalized
+}
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"opengptmservice/internal/models"
+)
+
+func TestCacheKeyContributions(t *testing.T) {
+	data := privacyTestData()
+	key := cacheKey(data, "model", GenerateOptions{})
+
+	data.Contributions = &models.ContributionStats{TotalContributions: 120, Commits: 100}
+	withContributions := cacheKey(data, "model", GenerateOptions{})
+	if withContributions == key {
+		t.Error("adding contributions kept the cache key")
+	}
+
+	data.Contributions = &models.ContributionStats{TotalContributions: 150, Commits: 130}
+	if cacheKey(data, "model", GenerateOptions{}) == withContributions {
+		t.Error("changed contributions kept the cache key")
+	}
+}
+
+func TestCacheKeyIgnoresOrder(t *testing.T) {
+	data := privacyTestData()
+	data.Repositories[0].Topics = []string{"web", "blog"}
+	data.Organizations = []models.Organization{{Login: "acme"}, {Login: "golang"}}
+	key := cacheKey(data, "model", GenerateOptions{Mode: ModePipeline})
+
+	reordered := privacyTestData()
+	reordered.Repositories[0].Topics = []string{"blog", "web"}
+	reordered.Repositories[0], reordered.Repositories[2] = reordered.Repositories[2], reordered.Repositories[0]
+	reordered.PullRequests[0], reordered.PullRequests[1] = reordered.PullRequests[1], reordered.PullRequests[0]
+	reordered.Organizations = []models.Organization{{Login: "golang"}, {Login: "acme"}}
+	// Activity timestamps don't change the CV either
+	reordered.Repositories[1].UpdatedAt = time.Now()
+	reordered.PullRequests[2].UpdatedAt = time.Now()
+	if got := cacheKey(reordered, "model", GenerateOptions{Mode: ModePipeline}); got != key {
+		t.Error("reordered data changed the cache key")
+	}
+	if len(reordered.Repositories[2].Topics) != 2 || reordered.Repositories[2].Topics[0] != "blog" {
+		t.Error("cacheKey modified the data")
+	}
+
+	for name, other := range map[string]string{
+		"model":  cacheKey(data, "other-model", GenerateOptions{Mode: ModePipeline}),
+		"mode":   cacheKey(data, "model", GenerateOptions{Mode: ModeTemplate}),
+		"length": cacheKey(data, "model", GenerateOptions{Mode: ModePipeline, Length: "short"}),
+	} {
+		if other == key {
+			t.Errorf("changing the %s kept the cache key", name)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"opengptmservice/internal/auth"
+	"opengptmservice/internal/models"
+	"opengptmservice/internal/retry"
+)
+
+// GiteaService collects a developer's activity from a Gitea or Forgejo
+// instance such as Codeberg
+type GiteaService struct {
+	host   *auth.Host
+	policy retry.Policy
+}
+
+// NewGiteaService creates a new Gitea service instance for host
+func NewGiteaService(host *auth.Host) *GiteaService {
+	return &GiteaService{
+		host:   host,
+		policy: newAPIPolicy("Gitea API (" + host.Name + ")"),
+	}
+}
+
+// GetUserData fetches the user's profile, repositories, organizations and
+// pull requests from Gitea, aborting when ctx is done
+func (s *GiteaService) GetUserData(ctx context.Context, accessToken string) (*models.DeveloperData, error) {
+	profile, err := s.getUserProfile(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	orgs, err := s.getOrganizations(ctx, accessToken)
+	if err != nil {
+		log.Printf("Warning: Failed to get organizations: %v", err)
+	}
+
+	prs, err := s.getPullRequests(ctx, accessToken)
+	if err != nil {
+		log.Printf("Warning: Failed to get pull requests: %v", err)
+	}
+
+	repos, err := s.getRepositories(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	profile.PublicRepos = len(repos)
+
+	return &models.DeveloperData{
+		Profile:       profile,
+		Repositories:  repos,
+		Organizations: orgs,
+		PullRequests:  prs,
+	}, nil
+}
+
+// getJSON fetches a Gitea API URL and decodes the JSON response into v
+func (s *GiteaService) getJSON(ctx context.Context, accessToken, url string, v interface{}) error {
+	return getBearerJSON(ctx, s.host, s.policy, accessToken, url, v)
+}
+
+func (s *GiteaService) getUserProfile(ctx context.Context, accessToken string) (*models.UserProfile, error) {
+	var user struct {
+		Login       string `json:"login"`
+		FullName    string `json:"full_name"`
+		Description string `json:"description"`
+		Location    string `json:"location"`
+		Website     string `json:"website"`
+		Created     string `json:"created"`
+		Followers   int    `json:"followers_count"`
+		Following   int    `json:"following_count"`
+	}
+	if err := s.getJSON(ctx, accessToken, s.host.APIURL+"/user", &user); err != nil {
+		return nil, fmt.Errorf("failed to get user profile: %w", err)
+	}
+
+	return &models.UserProfile{
+		Login:     user.Login,
+		Name:      user.FullName,
+		Bio:       user.Description,
+		Location:  user.Location,
+		Blog:      user.Website,
+		CreatedAt: user.Created,
+		Followers: user.Followers,
+		Following: user.Following,
+		HTMLURL:   s.host.WebURL + "/" + user.Login,
+		Provider:  "Gitea",
+	}, nil
+}
+
+func (s *GiteaService) getOrganizations(ctx context.Context, accessToken string) ([]models.Organization, error) {
+	var orgs []struct {
+		Username    string `json:"username"`
+		Description string `json:"description"`
+		AvatarURL   string `json:"avatar_url"`
+	}
+	if err := s.getJSON(ctx, accessToken, s.host.APIURL+"/user/orgs?limit=50", &orgs); err != nil {
+		return nil, fmt.Errorf("failed to get organizations: %w", err)
+	}
+
+	result := make([]models.Organization, len(orgs))
+	for i, org := range orgs {
+		result[i] = models.Organization{
+			Login:       org.Username,
+			Description: org.Description,
+			AvatarURL:   org.AvatarURL,
+			Type:        "Organization",
+			HTMLURL:     s.host.WebURL + "/" + org.Username,
+		}
+	}
+
+	return result, nil
+}
+
+func (s *GiteaService) getPullRequests(ctx context.Context, accessToken string) ([]models.PullRequest, error) {
+	var issues []struct {
+		Number     int       `json:"number"`
+		Title      string    `json:"title"`
+		State      string    `json:"state"`
+		CreatedAt  time.Time `json:"created_at"`
+		UpdatedAt  time.Time `json:"updated_at"`
+		HTMLURL    string    `json:"html_url"`
+		Repository struct {
+			FullName string `json:"full_name"`
+		} `json:"repository"`
+	}
+	url := s.host.APIURL + "/repos/issues/search?type=pulls&created=true&state=all&limit=50"
+	if err := s.getJSON(ctx, accessToken, url, &issues); err != nil {
+		return nil, fmt.Errorf("failed to get pull requests: %w", err)
+	}
+
+	prs := make([]models.PullRequest, len(issues))
+	for i, issue := range issues {
+		prs[i] = models.PullRequest{
+			Title:     issue.Title,
+			State:     issue.State,
+			CreatedAt: issue.CreatedAt,
+			UpdatedAt: issue.UpdatedAt,
+			Repo:      s.host.WebURL + "/" + issue.Repository.FullName,
+			Number:    issue.Number,
+			HTMLURL:   issue.HTMLURL,
+		}
+	}
+
+	return prs, nil
+}
+
+func (s *GiteaService) getRepositories(ctx context.Context, accessToken string) ([]models.Repository, error) {
+	var repos []struct {
+		models.Repository
+		Stars       int    `json:"stars_count"`
+		Mirror      bool   `json:"mirror"`
+		OriginalURL string `json:"original_url"`
+	}
+	if err := s.getJSON(ctx, accessToken, s.host.APIURL+"/user/repos?limit=50", &repos); err != nil {
+		return nil, fmt.Errorf("failed to get repositories: %w", err)
+	}
+
+	result := make([]models.Repository, len(repos))
+	for i, repo := range repos {
+		result[i] = repo.Repository
+		result[i].Stars = repo.Stars
+		if repo.Mirror {
+			result[i].MirrorURL = repo.OriginalURL
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Stars > result[j].Stars
+	})
+
+	return result, nil
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"opengptmservice/internal/auth"
+)
+
+// giteaResponses are canned Gitea API v1 responses keyed by request URI
+var giteaResponses = map[string]string{
+	"/api/v1/user": `{"login": "jdoe", "full_name": "Jane Doe", "description": "Free software enthusiast",
+		"website": "https://jdoe.dev", "created": "2020-06-01T08:00:00Z", "followers_count": 4}`,
+	"/api/v1/user/orgs?limit=50": `[{"username": "forgejo-contrib", "description": "Forgejo contributors"}]`,
+	"/api/v1/repos/issues/search?type=pulls&created=true&state=all&limit=50": `[{"number": 12, "title": "Improve docs",
+		"state": "closed", "html_url": "https://codeberg.example/forgejo/forgejo/pulls/12",
+		"created_at": "2024-01-01T00:00:00Z", "updated_at": "2024-01-02T00:00:00Z",
+		"repository": {"full_name": "forgejo/forgejo"}}]`,
+	"/api/v1/user/repos?limit=50": `[
+		{"name": "deployer", "description": "Deployment tool", "language": "Go", "stars_count": 2,
+		 "mirror": true, "original_url": "https://github.com/jdoe/deployer.git",
+		 "html_url": "https://codeberg.example/jdoe/deployer", "owner": {"login": "jdoe"}},
+		{"name": "notes", "language": "Markdown", "stars_count": 9,
+		 "html_url": "https://codeberg.example/jdoe/notes", "owner": {"login": "jdoe"}}]`,
+}
+
+func TestGiteaGetUserData(t *testing.T) {
+	server := newCannedServer(t, giteaResponses)
+	host, err := auth.NewHost(auth.HostConfig{Type: auth.TypeGitea, WebURL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := NewCollector(host).GetUserData(context.Background(), "test-token")
+	if err != nil {
+		t.Fatalf("GetUserData: %v", err)
+	}
+
+	p := data.Profile
+	if p.Login != "jdoe" || p.Name != "Jane Doe" || p.HTMLURL != server.URL+"/jdoe" || p.Provider != "Gitea" {
+		t.Errorf("unexpected profile %+v", p)
+	}
+	if len(data.Repositories) != 2 || data.Repositories[0].Name != "notes" || data.Repositories[0].Stars != 9 {
+		t.Fatalf("unexpected repositories %+v", data.Repositories)
+	}
+	if mirror := data.Repositories[1].MirrorURL; mirror != "https://github.com/jdoe/deployer.git" {
+		t.Errorf("got mirror URL %q", mirror)
+	}
+	if len(data.Organizations) != 1 || data.Organizations[0].HTMLURL != server.URL+"/forgejo-contrib" {
+		t.Errorf("unexpected organizations %+v", data.Organizations)
+	}
+	if len(data.PullRequests) != 1 || data.PullRequests[0].Repo != server.URL+"/forgejo/forgejo" {
+		t.Errorf("unexpected pull requests %+v", data.PullRequests)
+	}
+}
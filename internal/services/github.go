@@ -1,6 +1,9 @@
 package services
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -8,169 +11,282 @@ import (
 	"net/http"
 	"sort"
 
+	"opengptmservice/internal/auth"
 	"opengptmservice/internal/models"
+	"opengptmservice/internal/retry"
 )
 
-// GitHubService handles all GitHub-related operations
+// GitHubService handles all GitHub-related operations against one GitHub
+// or GitHub Enterprise Server host
 type GitHubService struct {
-	client *http.Client
+	host   *auth.Host
+	policy retry.Policy
 }
 
-// NewGitHubService creates a new GitHub service instance
-func NewGitHubService() *GitHubService {
+// NewGitHubService creates a new GitHub service instance for host
+func NewGitHubService(host *auth.Host) *GitHubService {
 	return &GitHubService{
-		client: &http.Client{},
+		host:   host,
+		policy: newAPIPolicy("GitHub API (" + host.Name + ")"),
 	}
 }
 
-// GetUserData fetches all user data from GitHub
-func (s *GitHubService) GetUserData(accessToken string) (*models.GitHubData, error) {
-	profile, err := s.getUserProfile(accessToken)
+// Host returns the host the service talks to
+func (s *GitHubService) Host() *auth.Host {
+	return s.host
+}
+
+// GetUserData fetches all user data from GitHub, aborting when ctx is done
+func (s *GitHubService) GetUserData(ctx context.Context, accessToken string) (*models.DeveloperData, error) {
+	profile, err := s.getUserProfile(ctx, accessToken)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user profile: %v", err)
+		return nil, err
 	}
 
-	orgs, err := s.getUserOrganizations(accessToken)
+	orgs, err := s.getUserOrganizations(ctx, accessToken)
 	if err != nil {
 		log.Printf("Warning: Failed to get organizations: %v", err)
 	}
 
-	prs, err := s.getUserPullRequests(accessToken)
+	prs, err := s.getUserPullRequests(ctx, accessToken)
 	if err != nil {
 		log.Printf("Warning: Failed to get pull requests: %v", err)
 	}
 
-	repos, err := s.getRepositories(accessToken)
+	contributions, err := s.getContributions(ctx, accessToken)
+	if err != nil {
+		log.Printf("Warning: Failed to get contributions: %v", err)
+	}
+
+	repos, err := s.getRepositories(ctx, accessToken)
 	if err != nil {
 		return nil, err
 	}
 
-	return &models.GitHubData{
+	return &models.DeveloperData{
 		Profile:       profile,
 		Repositories:  repos,
 		Organizations: orgs,
 		PullRequests:  prs,
+		Contributions: contributions,
 	}, nil
 }
 
-func (s *GitHubService) getUserProfile(accessToken string) (*models.UserProfile, error) {
-	req, err := http.NewRequest("GET", "https://api.github.com/user", nil)
-	if err != nil {
-		return nil, err
+// getJSON fetches a GitHub API URL and decodes the JSON response into v,
+// retrying according to the service's retry policy
+func (s *GitHubService) getJSON(ctx context.Context, accessToken, url string, v interface{}) error {
+	return s.doJSON(ctx, accessToken, "GET", url, nil, v)
+}
+
+// doJSON sends a request with an optional JSON body to the GitHub API and
+// decodes the JSON response into v
+func (s *GitHubService) doJSON(ctx context.Context, accessToken, method, url string, body interface{}, v interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
 	}
 
-	req.Header.Set("Authorization", "token "+accessToken)
-	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	return s.policy.Do(ctx, func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(payload))
+		if err != nil {
+			return retry.Permanent(err)
+		}
 
-	resp, err := s.client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
+		req.Header.Set("Authorization", "token "+accessToken)
+		req.Header.Set("Accept", "application/vnd.github.v3+json")
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to get user profile: %s", resp.Status)
-	}
+		resp, err := s.host.Client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
 
-	var profile models.UserProfile
-	if err := json.NewDecoder(resp.Body).Decode(&profile); err != nil {
-		return nil, err
-	}
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			return retry.NewHTTPError(resp, body)
+		}
 
-	return &profile, nil
+		return json.NewDecoder(resp.Body).Decode(v)
+	})
 }
 
-func (s *GitHubService) getUserOrganizations(accessToken string) ([]models.Organization, error) {
-	req, err := http.NewRequest("GET", "https://api.github.com/user/orgs", nil)
-	if err != nil {
-		return nil, err
+func (s *GitHubService) getUserProfile(ctx context.Context, accessToken string) (*models.UserProfile, error) {
+	var profile models.UserProfile
+	if err := s.getJSON(ctx, accessToken, s.host.APIURL+"/user", &profile); err != nil {
+		return nil, fmt.Errorf("failed to get user profile: %w", err)
 	}
-
-	req.Header.Set("Authorization", "token "+accessToken)
-	req.Header.Set("Accept", "application/vnd.github.v3+json")
-
-	resp, err := s.client.Do(req)
-	if err != nil {
-		return nil, err
+	if profile.HTMLURL == "" {
+		profile.HTMLURL = s.host.WebURL + "/" + profile.Login
 	}
-	defer resp.Body.Close()
+	profile.Provider = "GitHub"
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to get organizations: %s", resp.Status)
-	}
+	return &profile, nil
+}
 
+func (s *GitHubService) getUserOrganizations(ctx context.Context, accessToken string) ([]models.Organization, error) {
 	var orgs []models.Organization
-	if err := json.NewDecoder(resp.Body).Decode(&orgs); err != nil {
-		return nil, err
+	if err := s.getJSON(ctx, accessToken, s.host.APIURL+"/user/orgs", &orgs); err != nil {
+		return nil, fmt.Errorf("failed to get organizations: %w", err)
+	}
+
+	// The organizations endpoint only returns API URLs
+	for i := range orgs {
+		if orgs[i].HTMLURL == "" {
+			orgs[i].HTMLURL = s.host.WebURL + "/" + orgs[i].Login
+		}
 	}
 
 	return orgs, nil
 }
 
-func (s *GitHubService) getUserPullRequests(accessToken string) ([]models.PullRequest, error) {
-	req, err := http.NewRequest("GET", "https://api.github.com/user/issues?filter=all&state=all", nil)
-	if err != nil {
-		return nil, err
+// contributionsQuery fetches the viewer's contribution totals for the last year
+const contributionsQuery = `query {
+  viewer {
+    contributionsCollection {
+      totalCommitContributions
+      totalPullRequestContributions
+      totalPullRequestReviewContributions
+      totalIssueContributions
+      contributionCalendar {
+        totalContributions
+      }
+    }
+  }
+}`
+
+func (s *GitHubService) getContributions(ctx context.Context, accessToken string) (*models.ContributionStats, error) {
+	var resp struct {
+		Data struct {
+			Viewer struct {
+				ContributionsCollection struct {
+					TotalCommitContributions            int
+					TotalPullRequestContributions       int
+					TotalPullRequestReviewContributions int
+					TotalIssueContributions             int
+					ContributionCalendar                struct {
+						TotalContributions int
+					}
+				}
+			}
+		}
+		Errors []struct {
+			Message string
+		}
 	}
-
-	req.Header.Set("Authorization", "token "+accessToken)
-	req.Header.Set("Accept", "application/vnd.github.v3+json")
-
-	resp, err := s.client.Do(req)
-	if err != nil {
-		return nil, err
+	query := map[string]string{"query": contributionsQuery}
+	if err := s.doJSON(ctx, accessToken, "POST", s.host.GraphQLURL, query, &resp); err != nil {
+		return nil, fmt.Errorf("failed to get contributions: %w", err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to get pull requests: %s", resp.Status)
+	if len(resp.Errors) > 0 {
+		return nil, fmt.Errorf("failed to get contributions: %s", resp.Errors[0].Message)
 	}
 
-	var issues []models.PullRequest
-	if err := json.NewDecoder(resp.Body).Decode(&issues); err != nil {
-		return nil, err
+	c := resp.Data.Viewer.ContributionsCollection
+	return &models.ContributionStats{
+		TotalContributions: c.ContributionCalendar.TotalContributions,
+		Commits:            c.TotalCommitContributions,
+		PullRequests:       c.TotalPullRequestContributions,
+		Reviews:            c.TotalPullRequestReviewContributions,
+		Issues:             c.TotalIssueContributions,
+	}, nil
+}
+
+func (s *GitHubService) getUserPullRequests(ctx context.Context, accessToken string) ([]models.PullRequest, error) {
+	var issues []struct {
+		models.PullRequest
+		Repository *struct {
+			Private bool `json:"private"`
+		} `json:"repository"`
+	}
+	if err := s.getJSON(ctx, accessToken, s.host.APIURL+"/user/issues?filter=all&state=all", &issues); err != nil {
+		return nil, fmt.Errorf("failed to get pull requests: %w", err)
 	}
 
 	// Filter only pull requests
 	var prs []models.PullRequest
 	for _, issue := range issues {
 		if issue.Repo != "" { // This indicates it's a PR
-			prs = append(prs, issue)
+			issue.PullRequest.Public = issue.Repository != nil && !issue.Repository.Private
+			prs = append(prs, issue.PullRequest)
 		}
 	}
 
 	return prs, nil
 }
 
-func (s *GitHubService) getRepositories(accessToken string) ([]models.Repository, error) {
-	req, err := http.NewRequest("GET", "https://api.github.com/user/repos?sort=updated&per_page=100", nil)
+func (s *GitHubService) getRepositories(ctx context.Context, accessToken string) ([]models.Repository, error) {
+	var repos []models.Repository
+	if err := s.getJSON(ctx, accessToken, s.host.APIURL+"/user/repos?sort=updated&per_page=100", &repos); err != nil {
+		return nil, fmt.Errorf("failed to get repositories: %w", err)
+	}
+
+	// Sort by stars
+	sort.Slice(repos, func(i, j int) bool {
+		return repos[i].Stars > repos[j].Stars
+	})
+
+	return repos, nil
+}
+
+// GetReadme returns the README markdown of repo
+func (s *GitHubService) GetReadme(ctx context.Context, accessToken string, repo models.Repository) (string, error) {
+	var readme struct {
+		Content  string `json:"content"`
+		Encoding string `json:"encoding"`
+	}
+	url := fmt.Sprintf("%s/repos/%s/%s/readme", s.host.APIURL, repo.Owner.Login, repo.Name)
+	if err := s.getJSON(ctx, accessToken, url, &readme); err != nil {
+		return "", fmt.Errorf("failed to get README of %s: %w", repo.Name, err)
+	}
+	if readme.Encoding != "base64" {
+		return readme.Content, nil
+	}
+	content, err := base64.StdEncoding.DecodeString(readme.Content)
 	if err != nil {
-		return nil, err
+		return "", fmt.Errorf("failed to decode README of %s: %v", repo.Name, err)
 	}
+	return string(content), nil
+}
 
-	req.Header.Set("Authorization", "token "+accessToken)
-	req.Header.Set("Accept", "application/vnd.github.v3+json")
+// AddInstallationRepositories adds the repositories the user granted the
+// host's GitHub App installation id to data, such as private repositories the
+// user-to-server token cannot list, reading them with an installation token
+func (s *GitHubService) AddInstallationRepositories(ctx context.Context, data *models.DeveloperData, id int64) error {
+	if s.host.App == nil {
+		return fmt.Errorf("no GitHub App configured for %s", s.host.Name)
+	}
 
-	resp, err := s.client.Do(req)
+	token, err := s.host.App.InstallationToken(ctx, id)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("failed to get repositories: %s, body: %s", resp.Status, string(body))
+	var page struct {
+		Repositories []models.Repository `json:"repositories"`
+	}
+	if err := s.getJSON(ctx, token, s.host.APIURL+"/installation/repositories?per_page=100", &page); err != nil {
+		return fmt.Errorf("failed to get installation repositories: %w", err)
 	}
 
-	var repos []models.Repository
-	if err := json.NewDecoder(resp.Body).Decode(&repos); err != nil {
-		return nil, err
+	known := make(map[string]bool)
+	for _, repo := range data.Repositories {
+		known[repo.HTMLURL] = true
+	}
+	for _, repo := range page.Repositories {
+		if !known[repo.HTMLURL] {
+			data.Repositories = append(data.Repositories, repo)
+		}
 	}
 
-	// Sort by stars
-	sort.Slice(repos, func(i, j int) bool {
-		return repos[i].Stars > repos[j].Stars
+	sort.SliceStable(data.Repositories, func(i, j int) bool {
+		return data.Repositories[i].Stars > data.Repositories[j].Stars
 	})
 
-	return repos, nil
+	return nil
 }
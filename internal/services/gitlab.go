@@ -0,0 +1,240 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"opengptmservice/internal/auth"
+	"opengptmservice/internal/models"
+	"opengptmservice/internal/retry"
+)
+
+// gitlabLanguageProjects is the number of most starred projects whose
+// languages are looked up, as GitLab needs one request per project
+const gitlabLanguageProjects = 30
+
+// GitLabService collects a developer's activity from GitLab.com or a
+// self-managed GitLab instance
+type GitLabService struct {
+	host   *auth.Host
+	policy retry.Policy
+}
+
+// NewGitLabService creates a new GitLab service instance for host
+func NewGitLabService(host *auth.Host) *GitLabService {
+	return &GitLabService{
+		host:   host,
+		policy: newAPIPolicy("GitLab API (" + host.Name + ")"),
+	}
+}
+
+// GetUserData fetches the user's profile, projects, groups and merge requests
+// from GitLab, aborting when ctx is done
+func (s *GitLabService) GetUserData(ctx context.Context, accessToken string) (*models.DeveloperData, error) {
+	profile, err := s.getUserProfile(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := s.getGroups(ctx, accessToken)
+	if err != nil {
+		log.Printf("Warning: Failed to get groups: %v", err)
+	}
+
+	mrs, err := s.getMergeRequests(ctx, accessToken)
+	if err != nil {
+		log.Printf("Warning: Failed to get merge requests: %v", err)
+	}
+
+	projects, err := s.getProjects(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	profile.PublicRepos = len(projects)
+
+	return &models.DeveloperData{
+		Profile:       profile,
+		Repositories:  projects,
+		Organizations: groups,
+		PullRequests:  mrs,
+	}, nil
+}
+
+// getJSON fetches a GitLab API URL and decodes the JSON response into v
+func (s *GitLabService) getJSON(ctx context.Context, accessToken, url string, v interface{}) error {
+	return getBearerJSON(ctx, s.host, s.policy, accessToken, url, v)
+}
+
+func (s *GitLabService) getUserProfile(ctx context.Context, accessToken string) (*models.UserProfile, error) {
+	var user struct {
+		Username     string `json:"username"`
+		Name         string `json:"name"`
+		Bio          string `json:"bio"`
+		Location     string `json:"location"`
+		Organization string `json:"organization"`
+		WebsiteURL   string `json:"website_url"`
+		Twitter      string `json:"twitter"`
+		WebURL       string `json:"web_url"`
+		CreatedAt    string `json:"created_at"`
+		Followers    int    `json:"followers"`
+		Following    int    `json:"following"`
+	}
+	if err := s.getJSON(ctx, accessToken, s.host.APIURL+"/user", &user); err != nil {
+		return nil, fmt.Errorf("failed to get user profile: %w", err)
+	}
+
+	return &models.UserProfile{
+		Login:           user.Username,
+		Name:            user.Name,
+		Bio:             user.Bio,
+		Location:        user.Location,
+		Company:         user.Organization,
+		Blog:            user.WebsiteURL,
+		TwitterUsername: user.Twitter,
+		HTMLURL:         user.WebURL,
+		CreatedAt:       user.CreatedAt,
+		Followers:       user.Followers,
+		Following:       user.Following,
+		Provider:        "GitLab",
+	}, nil
+}
+
+func (s *GitLabService) getGroups(ctx context.Context, accessToken string) ([]models.Organization, error) {
+	var groups []struct {
+		FullPath    string `json:"full_path"`
+		Description string `json:"description"`
+		AvatarURL   string `json:"avatar_url"`
+		WebURL      string `json:"web_url"`
+	}
+	if err := s.getJSON(ctx, accessToken, s.host.APIURL+"/groups?min_access_level=10&per_page=100", &groups); err != nil {
+		return nil, fmt.Errorf("failed to get groups: %w", err)
+	}
+
+	orgs := make([]models.Organization, len(groups))
+	for i, g := range groups {
+		orgs[i] = models.Organization{
+			Login:       g.FullPath,
+			Description: g.Description,
+			AvatarURL:   g.AvatarURL,
+			Type:        "Group",
+			HTMLURL:     g.WebURL,
+		}
+	}
+
+	return orgs, nil
+}
+
+func (s *GitLabService) getMergeRequests(ctx context.Context, accessToken string) ([]models.PullRequest, error) {
+	var mrs []struct {
+		IID       int       `json:"iid"`
+		Title     string    `json:"title"`
+		State     string    `json:"state"`
+		CreatedAt time.Time `json:"created_at"`
+		UpdatedAt time.Time `json:"updated_at"`
+		WebURL    string    `json:"web_url"`
+	}
+	if err := s.getJSON(ctx, accessToken, s.host.APIURL+"/merge_requests?scope=created_by_me&state=all&per_page=100", &mrs); err != nil {
+		return nil, fmt.Errorf("failed to get merge requests: %w", err)
+	}
+
+	prs := make([]models.PullRequest, len(mrs))
+	for i, mr := range mrs {
+		// GitLab merge requests are opened, merged, closed or locked
+		state := "closed"
+		if mr.State == "opened" {
+			state = "open"
+		}
+		repo := mr.WebURL
+		if i := strings.Index(repo, "/-/merge_requests/"); i >= 0 {
+			repo = repo[:i]
+		}
+		prs[i] = models.PullRequest{
+			Title:     mr.Title,
+			State:     state,
+			CreatedAt: mr.CreatedAt,
+			UpdatedAt: mr.UpdatedAt,
+			Repo:      repo,
+			Number:    mr.IID,
+			HTMLURL:   mr.WebURL,
+		}
+	}
+
+	return prs, nil
+}
+
+func (s *GitLabService) getProjects(ctx context.Context, accessToken string) ([]models.Repository, error) {
+	var projects []struct {
+		ID             int       `json:"id"`
+		Name           string    `json:"name"`
+		Description    string    `json:"description"`
+		StarCount      int       `json:"star_count"`
+		ForksCount     int       `json:"forks_count"`
+		CreatedAt      time.Time `json:"created_at"`
+		LastActivityAt time.Time `json:"last_activity_at"`
+		Topics         []string  `json:"topics"`
+		WebURL         string    `json:"web_url"`
+		Visibility     string    `json:"visibility"`
+		Namespace      struct {
+			Path string `json:"path"`
+			Kind string `json:"kind"`
+		} `json:"namespace"`
+	}
+	if err := s.getJSON(ctx, accessToken, s.host.APIURL+"/projects?membership=true&order_by=last_activity_at&per_page=100", &projects); err != nil {
+		return nil, fmt.Errorf("failed to get projects: %w", err)
+	}
+
+	repos := make([]models.Repository, len(projects))
+	ids := make(map[string]int, len(projects))
+	for i, p := range projects {
+		ids[p.WebURL] = p.ID
+		repos[i] = models.Repository{
+			Name:        p.Name,
+			Description: p.Description,
+			Stars:       p.StarCount,
+			Forks:       p.ForksCount,
+			CreatedAt:   p.CreatedAt,
+			UpdatedAt:   p.LastActivityAt,
+			Topics:      p.Topics,
+			HTMLURL:     p.WebURL,
+			Private:     p.Visibility == "private" || p.Visibility == "internal",
+		}
+		repos[i].Owner.Login = p.Namespace.Path
+		repos[i].Owner.Type = "User"
+		if p.Namespace.Kind == "group" {
+			repos[i].Owner.Type = "Organization"
+		}
+	}
+
+	sort.SliceStable(repos, func(i, j int) bool {
+		return repos[i].Stars > repos[j].Stars
+	})
+
+	// Use the language making up most of each project
+	for i := range repos {
+		if i == gitlabLanguageProjects {
+			break
+		}
+		var languages map[string]float64
+		url := fmt.Sprintf("%s/projects/%d/languages", s.host.APIURL, ids[repos[i].HTMLURL])
+		if err := s.getJSON(ctx, accessToken, url, &languages); err != nil {
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("failed to get projects: %w", ctx.Err())
+			}
+			log.Printf("Warning: Failed to get languages of %s: %v", repos[i].Name, err)
+			continue
+		}
+		var share float64
+		for language, percent := range languages {
+			if percent > share || (percent == share && language < repos[i].Language) {
+				repos[i].Language = language
+				share = percent
+			}
+		}
+	}
+
+	return repos, nil
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"opengptmservice/internal/auth"
+)
+
+// gitlabResponses are canned GitLab API v4 responses keyed by request URI
+var gitlabResponses = map[string]string{
+	"/api/v4/user": `{"username": "jdoe", "name": "Jane Doe", "bio": "Backend engineer",
+		"organization": "Example Corp", "website_url": "https://jdoe.dev",
+		"web_url": "https://gitlab.example.com/jdoe", "created_at": "2015-03-01T10:00:00Z", "followers": 12}`,
+	"/api/v4/groups?min_access_level=10&per_page=100": `[{"full_path": "platform/infra",
+		"description": "Infrastructure team", "web_url": "https://gitlab.example.com/groups/platform/infra"}]`,
+	"/api/v4/merge_requests?scope=created_by_me&state=all&per_page=100": `[
+		{"iid": 7, "title": "Add metrics", "state": "merged", "created_at": "2024-01-02T00:00:00Z",
+		 "updated_at": "2024-01-03T00:00:00Z", "web_url": "https://gitlab.example.com/platform/infra/deployer/-/merge_requests/7"},
+		{"iid": 8, "title": "Fix flaky test", "state": "opened", "created_at": "2024-02-02T00:00:00Z",
+		 "updated_at": "2024-02-03T00:00:00Z", "web_url": "https://gitlab.example.com/platform/infra/deployer/-/merge_requests/8"}]`,
+	"/api/v4/projects?membership=true&order_by=last_activity_at&per_page=100": `[
+		{"id": 1, "name": "dotfiles", "star_count": 1, "created_at": "2016-01-01T00:00:00Z",
+		 "last_activity_at": "2024-03-01T00:00:00Z", "web_url": "https://gitlab.example.com/jdoe/dotfiles",
+		 "namespace": {"path": "jdoe", "kind": "user"}},
+		{"id": 2, "name": "deployer", "description": "Deployment tool", "star_count": 40, "forks_count": 5,
+		 "topics": ["kubernetes"], "created_at": "2018-01-01T00:00:00Z", "last_activity_at": "2024-02-01T00:00:00Z",
+		 "web_url": "https://gitlab.example.com/platform/infra/deployer", "namespace": {"path": "infra", "kind": "group"}}]`,
+	"/api/v4/projects/1/languages": `{"Shell": 70.5, "Vim Script": 29.5}`,
+	"/api/v4/projects/2/languages": `{"Go": 91.2, "Makefile": 8.8}`,
+}
+
+// newCannedServer starts a fake API server answering requests authorized
+// with the bearer token test-token from responses
+func newCannedServer(t *testing.T, responses map[string]string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, ok := responses[r.URL.RequestURI()]
+		if !ok {
+			t.Errorf("unexpected request %s", r.URL.RequestURI())
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestGitLabGetUserData(t *testing.T) {
+	server := newCannedServer(t, gitlabResponses)
+
+	host, err := auth.NewHost(auth.HostConfig{Type: auth.TypeGitLab, WebURL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host.APIURL != server.URL+"/api/v4" {
+		t.Errorf("got API URL %s, want %s/api/v4", host.APIURL, server.URL)
+	}
+
+	data, err := NewCollector(host).GetUserData(context.Background(), "test-token")
+	if err != nil {
+		t.Fatalf("GetUserData: %v", err)
+	}
+
+	p := data.Profile
+	if p.Login != "jdoe" || p.Name != "Jane Doe" || p.Company != "Example Corp" || p.Provider != "GitLab" || p.PublicRepos != 2 {
+		t.Errorf("unexpected profile %+v", p)
+	}
+
+	if len(data.Repositories) != 2 {
+		t.Fatalf("got %d repositories, want 2", len(data.Repositories))
+	}
+	top := data.Repositories[0]
+	if top.Name != "deployer" || top.Language != "Go" || top.Stars != 40 || top.Owner.Type != "Organization" {
+		t.Errorf("unexpected top repository %+v", top)
+	}
+	if lang := data.Repositories[1].Language; lang != "Shell" {
+		t.Errorf("got language %q for dotfiles, want Shell", lang)
+	}
+
+	if len(data.Organizations) != 1 || data.Organizations[0].Login != "platform/infra" {
+		t.Errorf("unexpected groups %+v", data.Organizations)
+	}
+
+	if len(data.PullRequests) != 2 {
+		t.Fatalf("got %d merge requests, want 2", len(data.PullRequests))
+	}
+	for i, want := range []string{"closed", "open"} {
+		pr := data.PullRequests[i]
+		if pr.State != want {
+			t.Errorf("merge request %d: got state %s, want %s", pr.Number, pr.State, want)
+		}
+		if pr.Repo != "https://gitlab.example.com/platform/infra/deployer" {
+			t.Errorf("merge request %d: got repo %s", pr.Number, pr.Repo)
+		}
+	}
+}
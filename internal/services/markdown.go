@@ -0,0 +1,23 @@
+package services
+
+import (
+	"bytes"
+	"html/template"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// markdownRenderer renders markdown with the GitHub tables, strikethrough and
+// task lists. Bare URLs are kept as text, as written. Raw HTML in the markdown
+// is left out, so rendering untrusted text such as READMEs is safe.
+var markdownRenderer = goldmark.New(goldmark.WithExtensions(extension.Table, extension.Strikethrough, extension.TaskList))
+
+// RenderMarkdown converts markdown to HTML
+func RenderMarkdown(markdown string) template.HTML {
+	var buf bytes.Buffer
+	if err := markdownRenderer.Convert([]byte(markdown), &buf); err != nil {
+		return template.HTML(template.HTMLEscapeString(markdown))
+	}
+	return template.HTML(buf.String())
+}
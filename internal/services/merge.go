@@ -0,0 +1,185 @@
+package services
+
+import (
+	"sort"
+	"strings"
+
+	"opengptmservice/internal/models"
+)
+
+// MergeDeveloperData combines the data collected from several hosts into one.
+// The first profile is the primary one: its fields win and only empty fields
+// are filled from the other profiles, while counts and contributions are summed.
+// Organizations and pull requests seen on several hosts are kept once, and
+// so are repositories hosted in several places (see dedupeRepositories).
+func MergeDeveloperData(data ...*models.DeveloperData) *models.DeveloperData {
+	if len(data) == 1 {
+		return data[0]
+	}
+
+	merged := &models.DeveloperData{}
+	orgs := make(map[string]bool)
+	prs := make(map[string]bool)
+	for _, d := range data {
+		if d == nil {
+			continue
+		}
+
+		merged.Profile = mergeProfiles(merged.Profile, d.Profile)
+		merged.Repositories = append(merged.Repositories, d.Repositories...)
+		for _, org := range d.Organizations {
+			if key := org.HTMLURL + "|" + org.Login; !orgs[key] {
+				orgs[key] = true
+				merged.Organizations = append(merged.Organizations, org)
+			}
+		}
+		for _, pr := range d.PullRequests {
+			if key := pr.HTMLURL; key == "" || !prs[key] {
+				prs[key] = true
+				merged.PullRequests = append(merged.PullRequests, pr)
+			}
+		}
+		if d.Contributions != nil {
+			if merged.Contributions == nil {
+				merged.Contributions = &models.ContributionStats{}
+			}
+			merged.Contributions.TotalContributions += d.Contributions.TotalContributions
+			merged.Contributions.Commits += d.Contributions.Commits
+			merged.Contributions.PullRequests += d.Contributions.PullRequests
+			merged.Contributions.Reviews += d.Contributions.Reviews
+			merged.Contributions.Issues += d.Contributions.Issues
+		}
+	}
+
+	sort.SliceStable(merged.Repositories, func(i, j int) bool {
+		return merged.Repositories[i].Stars > merged.Repositories[j].Stars
+	})
+	merged.Repositories = dedupeRepositories(merged.Repositories)
+
+	return merged
+}
+
+// dedupeRepositories drops mirrors of repositories in repos, and keeps only
+// the first of repositories with the same name and either the same owner or
+// the same description, e.g. a project pushed to both GitHub and Codeberg.
+// Empty fields of the kept repository are filled from its duplicates, see
+// fillRepository.
+func dedupeRepositories(repos []models.Repository) []models.Repository {
+	urls := make(map[string]bool, len(repos))
+	for _, repo := range repos {
+		urls[normalizeRepoURL(repo.HTMLURL)] = true
+	}
+
+	var result []models.Repository
+	kept := make(map[string]int)
+	for _, repo := range repos {
+		if repo.MirrorURL != "" && urls[normalizeRepoURL(repo.MirrorURL)] {
+			continue
+		}
+
+		name := strings.ToLower(repo.Name)
+		keys := []string{"owner|" + name + "|" + strings.ToLower(repo.Owner.Login)}
+		if repo.Description != "" {
+			keys = append(keys, "description|"+name+"|"+repo.Description)
+		}
+
+		duplicate := -1
+		for _, key := range keys {
+			if i, ok := kept[key]; ok {
+				duplicate = i
+				break
+			}
+		}
+		if duplicate < 0 {
+			duplicate = len(result)
+			result = append(result, repo)
+		} else {
+			fillRepository(&result[duplicate], repo)
+		}
+		for _, key := range keys {
+			if _, ok := kept[key]; !ok {
+				kept[key] = duplicate
+			}
+		}
+	}
+
+	return result
+}
+
+// fillRepository fills the empty fields of repo from its duplicate. Nothing
+// of a private duplicate makes it into a public repository, and a public
+// duplicate of a private repository takes its place, so the project is not
+// left out with the private copy.
+func fillRepository(repo *models.Repository, duplicate models.Repository) {
+	if repo.Private != duplicate.Private {
+		if repo.Private {
+			*repo = duplicate
+		}
+		return
+	}
+	if repo.Description == "" {
+		repo.Description = duplicate.Description
+	}
+	if repo.Language == "" {
+		repo.Language = duplicate.Language
+	}
+	if len(repo.Topics) == 0 {
+		repo.Topics = duplicate.Topics
+	}
+	if duplicate.CreatedAt.Before(repo.CreatedAt) && !duplicate.CreatedAt.IsZero() {
+		repo.CreatedAt = duplicate.CreatedAt
+	}
+	if duplicate.UpdatedAt.After(repo.UpdatedAt) {
+		repo.UpdatedAt = duplicate.UpdatedAt
+	}
+}
+
+// normalizeRepoURL returns url without scheme, trailing slash and .git
+// suffix, in lower case
+func normalizeRepoURL(url string) string {
+	url = strings.ToLower(url)
+	url = strings.TrimPrefix(url, "https://")
+	url = strings.TrimPrefix(url, "http://")
+	url = strings.TrimSuffix(url, "/")
+	return strings.TrimSuffix(url, ".git")
+}
+
+// mergeProfiles fills the empty fields of primary from other and sums the counts
+func mergeProfiles(primary, other *models.UserProfile) *models.UserProfile {
+	if other == nil {
+		return primary
+	}
+	if primary == nil {
+		p := *other
+		return &p
+	}
+
+	fill := func(dst *string, src string) {
+		if *dst == "" {
+			*dst = src
+		}
+	}
+	fill(&primary.Name, other.Name)
+	fill(&primary.Bio, other.Bio)
+	fill(&primary.Location, other.Location)
+	fill(&primary.Company, other.Company)
+	fill(&primary.Blog, other.Blog)
+	fill(&primary.Email, other.Email)
+	fill(&primary.TwitterUsername, other.TwitterUsername)
+	if primary.HTMLURL == "" {
+		primary.HTMLURL = other.HTMLURL
+		primary.Provider = other.Provider
+	}
+
+	// Timestamps are RFC 3339 and compare lexically
+	if other.CreatedAt != "" && (primary.CreatedAt == "" || other.CreatedAt < primary.CreatedAt) {
+		primary.CreatedAt = other.CreatedAt
+	}
+
+	primary.PublicRepos += other.PublicRepos
+	primary.PublicGists += other.PublicGists
+	primary.Followers += other.Followers
+	primary.Following += other.Following
+
+	return primary
+}
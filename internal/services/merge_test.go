@@ -0,0 +1,84 @@
+package services
+
+import (
+	"testing"
+
+	"opengptmservice/internal/models"
+)
+
+func repository(name, owner, url string, stars int) models.Repository {
+	repo := models.Repository{Name: name, HTMLURL: url, Stars: stars}
+	repo.Owner.Login = owner
+	return repo
+}
+
+func TestMergeDeveloperDataDedupesRepositories(t *testing.T) {
+	github := &models.DeveloperData{
+		Profile: &models.UserProfile{Login: "jdoe", Name: "Jane Doe", Followers: 10, CreatedAt: "2014-01-01T00:00:00Z"},
+		Repositories: []models.Repository{
+			repository("deployer", "jdoe", "https://github.com/jdoe/deployer", 40),
+			repository("website", "jdoe", "https://github.com/jdoe/website", 1),
+		},
+		PullRequests: []models.PullRequest{{Title: "Fix", HTMLURL: "https://github.com/x/y/pull/1"}},
+	}
+
+	mirror := repository("deployer", "jdoe-mirrors", "https://codeberg.org/jdoe-mirrors/deployer", 2)
+	mirror.MirrorURL = "https://GitHub.com/jdoe/deployer.git"
+	samePath := repository("Website", "jdoe", "https://codeberg.org/jdoe/website", 3)
+	samePath.Language = "HTML"
+	sameDescription := repository("notes", "other", "https://bitbucket.org/other/notes", 0)
+	sameDescription.Description = "Personal notes"
+	notes := repository("notes", "jdoe", "https://codeberg.org/jdoe/notes", 5)
+	notes.Description = "Personal notes"
+	codeberg := &models.DeveloperData{
+		Profile:      &models.UserProfile{Login: "jdoe", Bio: "Free software", Followers: 2, CreatedAt: "2012-01-01T00:00:00Z"},
+		Repositories: []models.Repository{mirror, samePath, notes, sameDescription},
+		PullRequests: []models.PullRequest{{Title: "Fix", HTMLURL: "https://github.com/x/y/pull/1"}},
+	}
+
+	merged := MergeDeveloperData(github, codeberg)
+
+	var names []string
+	for _, repo := range merged.Repositories {
+		names = append(names, repo.Owner.Login+"/"+repo.Name)
+	}
+	want := []string{"jdoe/deployer", "jdoe/notes", "jdoe/Website"}
+	if len(names) != len(want) {
+		t.Fatalf("got repositories %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("got repositories %v, want %v", names, want)
+		}
+	}
+	if lang := merged.Repositories[2].Language; lang != "HTML" {
+		t.Errorf("duplicate did not fill language, got %q", lang)
+	}
+
+	if p := merged.Profile; p.Name != "Jane Doe" || p.Bio != "Free software" || p.Followers != 12 || p.CreatedAt != "2012-01-01T00:00:00Z" {
+		t.Errorf("unexpected merged profile %+v", p)
+	}
+	if len(merged.PullRequests) != 1 {
+		t.Errorf("got %d pull requests, want 1", len(merged.PullRequests))
+	}
+}
+
+func TestMergeDeveloperDataKeepsPrivateDuplicatesPrivate(t *testing.T) {
+	public := repository("deployer", "jdoe", "https://github.com/jdoe/deployer", 40)
+	private := repository("deployer", "jdoe", "https://gitlab.example.com/jdoe/deployer", 0)
+	private.Private = true
+	private.Description = "Deploys Acme payroll"
+	private.Language = "Go"
+	private.Topics = []string{"acme"}
+
+	for _, order := range [][]models.Repository{{public, private}, {private, public}} {
+		merged := MergeDeveloperData(&models.DeveloperData{Repositories: order[:1]}, &models.DeveloperData{Repositories: order[1:]})
+		if len(merged.Repositories) != 1 {
+			t.Fatalf("got repositories %+v, want one", merged.Repositories)
+		}
+		repo := merged.Repositories[0]
+		if repo.Private || repo.HTMLURL != public.HTMLURL || repo.Description != "" || repo.Language != "" || len(repo.Topics) != 0 {
+			t.Errorf("public repository filled from its private duplicate: %+v", repo)
+		}
+	}
+}
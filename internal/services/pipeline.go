@@ -0,0 +1,248 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"opengptmservice/internal/models"
+	"opengptmservice/internal/retry"
+)
+
+// Section names produced by the pipeline generator
+const (
+	SectionHeader        = "header"
+	SectionSummary       = "summary"
+	SectionSkills        = "skills"
+	SectionExperience    = "experience"
+	SectionProjects      = "projects"
+	SectionContributions = "contributions"
+)
+
+// sectionAttempts is the number of times a section is generated before
+// falling back to its deterministic content
+const sectionAttempts = 2
+
+// sectionSpec describes how a single CV section is generated
+type sectionSpec struct {
+	name   string
+	title  string
+	prompt func(s *CVService, data *models.DeveloperData) string
+}
+
+// pipelineSections lists the generated sections in the order they appear in the CV
+var pipelineSections = []sectionSpec{
+	{
+		name:  SectionSummary,
+		title: "Professional Summary",
+		prompt: func(s *CVService, data *models.DeveloperData) string {
+			return fmt.Sprintf(`Write a professional summary of 3-4 sentences for a software developer's CV.
+
+Name: %s
+Bio: %s
+Company: %s
+Location: %s
+Public Repositories: %d
+Followers: %d
+Member since: %s
+Contributions in the last year: %s
+Main languages: %s`,
+				data.Profile.Name,
+				data.Profile.Bio,
+				data.Profile.Company,
+				data.Profile.Location,
+				data.Profile.PublicRepos,
+				data.Profile.Followers,
+				data.Profile.CreatedAt,
+				s.formatContributions(data.Contributions),
+				strings.Join(newCVView(data).TopLanguages(5), ", "))
+		},
+	},
+	{
+		name:  SectionSkills,
+		title: "Technical Skills",
+		prompt: func(s *CVService, data *models.DeveloperData) string {
+			return fmt.Sprintf(`Write the Technical Skills section of a software developer's CV as a grouped markdown bullet list, based only on the languages and topics of their repositories.
+
+Repositories:
+%s`, s.formatRepositories(data.Repositories)+s.formatPrivateLanguages(data.PrivateLanguages))
+		},
+	},
+	{
+		name:  SectionExperience,
+		title: "Professional Experience",
+		prompt: func(s *CVService, data *models.DeveloperData) string {
+			return fmt.Sprintf(`Write the Professional Experience section of a software developer's CV as a markdown list, based on their company and the organizations they belong to. Do not invent job titles or dates.
+
+Company: %s
+
+Organizations:
+%s`, data.Profile.Company, s.formatOrganizations(data.Organizations))
+		},
+	},
+	{
+		name:  SectionProjects,
+		title: "Notable Projects",
+		prompt: func(s *CVService, data *models.DeveloperData) string {
+			return fmt.Sprintf(`Write the Notable Projects section of a software developer's CV, describing their top repositories as a markdown list with one or two sentences each. Link each project to its URL.
+
+Repositories:
+%s`, s.formatRepositories(topRepositories(data.Repositories, 5)))
+		},
+	},
+	{
+		name:  SectionContributions,
+		title: "Open Source Contributions",
+		prompt: func(s *CVService, data *models.DeveloperData) string {
+			return fmt.Sprintf(`Write the Open Source Contributions section of a software developer's CV, summarizing their pull requests as a short paragraph followed by a markdown list of highlights.
+
+Contributions in the last year: %s
+
+Pull Requests:
+%s`, s.formatContributions(data.Contributions), s.formatPullRequests(data.PullRequests))
+		},
+	},
+}
+
+// sectionInstructions is appended to every section prompt so the output can be
+// assembled into a single document
+const sectionInstructions = `
+
+Respond with the markdown content of the section only. Do not include the section heading or any commentary.`
+
+// GenerateCVPipeline generates each CV section with its own prompt concurrently
+// and assembles the result. Sections that fail are replaced by deterministic content.
+func (s *CVService) GenerateCVPipeline(ctx context.Context, data *models.DeveloperData, opts GenerateOptions) (*models.CV, error) {
+	header, err := s.templates.Section(data, SectionHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	cv := &models.CV{
+		Sections: make([]models.CVSection, len(pipelineSections)+1),
+	}
+	cv.Sections[0] = models.CVSection{
+		Name:    SectionHeader,
+		Content: header,
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(pipelineSections))
+	for i, spec := range pipelineSections {
+		wg.Add(1)
+		go func(i int, spec sectionSpec) {
+			defer wg.Done()
+			cv.Sections[i+1], errs[i] = s.generateSection(ctx, data, spec, opts)
+		}(i, spec)
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return cv, nil
+}
+
+// RegenerateSection generates a single pipeline section again
+func (s *CVService) RegenerateSection(ctx context.Context, data *models.DeveloperData, name string, opts GenerateOptions) (*models.CVSection, error) {
+	for _, spec := range pipelineSections {
+		if spec.name == name {
+			section, err := s.generateSection(ctx, data, spec, opts)
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if err != nil {
+				return nil, err
+			}
+			return &section, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown section %q", name)
+}
+
+// generateSection generates the section of spec with the LLM, using the
+// template content when the LLM fails. It only returns an error when the
+// budget is spent or too many calls are waiting.
+func (s *CVService) generateSection(ctx context.Context, data *models.DeveloperData, spec sectionSpec, opts GenerateOptions) (models.CVSection, error) {
+	if !s.llmAvailable() {
+		return s.templateSection(data, spec), nil
+	}
+
+	redactor := s.redactor(data, opts)
+	prompt := redactor.Redact(s.sectionPrompt(data, spec, opts))
+
+	var lastErr error
+	for attempt := 1; attempt <= sectionAttempts; attempt++ {
+		log.Printf("Generating section %s (attempt %d/%d)", spec.name, attempt, sectionAttempts)
+		completion, err := s.llm.Generate(ctx, prompt, spec.name, opts.Length)
+		if err != nil {
+			if unavailable(err) {
+				return models.CVSection{}, err
+			}
+			lastErr = err
+			// No point in retrying when cancelled or the breaker rejects calls
+			if ctx.Err() != nil || errors.Is(err, retry.ErrCircuitOpen) {
+				break
+			}
+			continue
+		}
+
+		content := cleanSectionContent(redactor.Restore(completion.Text))
+		if content == "" {
+			lastErr = fmt.Errorf("empty response")
+			continue
+		}
+
+		return models.CVSection{
+			Name:    spec.name,
+			Title:   spec.title,
+			Content: content,
+			Model:   completion.Model,
+		}, nil
+	}
+
+	log.Printf("Warning: Using template content for section %s: %v", spec.name, lastErr)
+	return s.templateSection(data, spec), nil
+}
+
+// sectionPrompt returns the prompt generating the section of spec
+func (s *CVService) sectionPrompt(data *models.DeveloperData, spec sectionSpec, opts GenerateOptions) string {
+	return spec.prompt(s, data) + lengthInstructions[opts.Length] + sectionInstructions
+}
+
+// templateSection renders the deterministic content of a section
+func (s *CVService) templateSection(data *models.DeveloperData, spec sectionSpec) models.CVSection {
+	content, err := s.templates.Section(data, spec.name)
+	if err != nil {
+		log.Printf("Error rendering template for section %s: %v", spec.name, err)
+	}
+	return models.CVSection{
+		Name:     spec.name,
+		Title:    spec.title,
+		Content:  content,
+		Fallback: true,
+	}
+}
+
+// cleanSectionContent trims the response and drops a leading heading that
+// models tend to add despite the instructions
+func cleanSectionContent(text string) string {
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "#") {
+		if i := strings.Index(text, "\n"); i >= 0 {
+			text = strings.TrimSpace(text[i+1:])
+		} else {
+			text = ""
+		}
+	}
+	return text
+}
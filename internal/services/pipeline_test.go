@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"opengptmservice/internal/fakellm"
+	"opengptmservice/internal/models"
+	"opengptmservice/internal/usage"
+)
+
+// newTestCVService returns a CV service generating with a single model of a
+// fake LLM server, without retries inside the client so every section
+// attempt is one request
+func newTestCVService(t *testing.T, tracker *usage.Tracker) (*CVService, *fakellm.Server) {
+	t.Helper()
+	client, fake := newTestClient(t)
+	client.policy.MaxAttempts = 1
+	if tracker == nil {
+		tracker = usage.NewTracker(nil, 0, 0)
+	}
+	s := &CVService{
+		llm:       &ModelRouter{chain: []*AtomaClient{client}, usage: tracker},
+		templates: NewTemplateGenerator(),
+	}
+	return s, fake
+}
+
+func TestGenerateCVPipeline(t *testing.T) {
+	s, fake := newTestCVService(t, nil)
+	fake.SetDefault(fakellm.Respond("## Heading\n\nGenerated content."))
+
+	cv, err := s.GenerateCVPipeline(context.Background(), privacyTestData(), GenerateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cv.Sections) != len(pipelineSections)+1 || cv.Sections[0].Name != SectionHeader {
+		t.Fatalf("got sections %+v", cv.Sections)
+	}
+	for i, spec := range pipelineSections {
+		section := cv.Sections[i+1]
+		if section.Name != spec.name || section.Title != spec.title {
+			t.Errorf("section %d is %s, want %s", i+1, section.Name, spec.name)
+		}
+		// The heading models add despite the instructions is dropped
+		if section.Content != "Generated content." || section.Fallback || section.Model != "fake/fake-model" {
+			t.Errorf("section %s: %+v", spec.name, section)
+		}
+	}
+	if got := len(fake.Requests()); got != len(pipelineSections) {
+		t.Errorf("got %d requests, want one per section", got)
+	}
+}
+
+func TestGenerateCVPipelineRetriesFailedSection(t *testing.T) {
+	s, fake := newTestCVService(t, nil)
+	fake.SetDefault(fakellm.Respond("Generated content."))
+	fake.Enqueue(fakellm.Fail(http.StatusBadRequest))
+
+	cv, err := s.GenerateCVPipeline(context.Background(), privacyTestData(), GenerateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, section := range cv.Sections[1:] {
+		if section.Fallback || section.Content != "Generated content." {
+			t.Errorf("section %s not generated: %+v", section.Name, section)
+		}
+	}
+	if got := len(fake.Requests()); got != len(pipelineSections)+1 {
+		t.Errorf("got %d requests, want one per section and one retry", got)
+	}
+}
+
+func TestGenerateCVPipelineTemplateFallback(t *testing.T) {
+	s, fake := newTestCVService(t, nil)
+	fake.SetDefault(fakellm.Fail(http.StatusBadRequest))
+	data := privacyTestData()
+
+	cv, err := s.GenerateCVPipeline(context.Background(), data, GenerateOptions{})
+	if err != nil {
+		t.Fatalf("failing sections returned %v, want template content", err)
+	}
+	for _, section := range cv.Sections[1:] {
+		want, err := s.templates.Section(data, section.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !section.Fallback || section.Content != want || section.Model != "" {
+			t.Errorf("section %s: %+v, want the template content", section.Name, section)
+		}
+	}
+	if got := len(fake.Requests()); got != len(pipelineSections)*sectionAttempts {
+		t.Errorf("got %d requests, want %d attempts per section", got, sectionAttempts)
+	}
+}
+
+func TestGenerateCVPipelineBudgetSpent(t *testing.T) {
+	tracker := usage.NewTracker([]usage.Price{{Model: "fake/fake-model", PromptPerMillion: 1e6}}, 1, 0)
+	tracker.Record(usage.WithScope(context.Background(), usage.Scope{User: "jdoe"}), "fake/fake-model", 1, 0)
+	s, fake := newTestCVService(t, tracker)
+
+	ctx := usage.WithScope(context.Background(), usage.Scope{User: "jdoe"})
+	_, err := s.GenerateCVPipeline(ctx, privacyTestData(), GenerateOptions{})
+	if !errors.Is(err, usage.ErrBudgetExceeded) {
+		t.Errorf("got %v, want the budget error instead of template content", err)
+	}
+	if got := len(fake.Requests()); got != 0 {
+		t.Errorf("got %d requests over budget", got)
+	}
+}
+
+func TestRegenerateSection(t *testing.T) {
+	tests := []struct {
+		name       string
+		behaviours []fakellm.Behaviour
+		requests   int
+		fallback   bool
+	}{
+		{"first attempt", []fakellm.Behaviour{fakellm.Respond("Generated content.")}, 1, false},
+		{"failure retried", []fakellm.Behaviour{fakellm.Fail(http.StatusBadRequest), fakellm.Respond("Generated content.")}, 2, false},
+		{"empty response retried", []fakellm.Behaviour{fakellm.Respond("## Summary"), fakellm.Respond("Generated content.")}, 2, false},
+		{"template fallback", []fakellm.Behaviour{fakellm.Fail(http.StatusBadRequest), fakellm.Malformed()}, 2, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, fake := newTestCVService(t, nil)
+			fake.Enqueue(tt.behaviours...)
+			data := privacyTestData()
+
+			section, err := s.RegenerateSection(context.Background(), data, SectionSummary, GenerateOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := models.CVSection{Name: SectionSummary, Title: "Professional Summary", Content: "Generated content.", Model: "fake/fake-model"}
+			if tt.fallback {
+				content, _ := s.templates.Section(data, SectionSummary)
+				want = models.CVSection{Name: SectionSummary, Title: "Professional Summary", Content: content, Fallback: true}
+			}
+			if *section != want {
+				t.Errorf("got %+v, want %+v", *section, want)
+			}
+			if got := len(fake.Requests()); got != tt.requests {
+				t.Errorf("got %d requests, want %d", got, tt.requests)
+			}
+		})
+	}
+
+	s, _ := newTestCVService(t, nil)
+	if _, err := s.RegenerateSection(context.Background(), privacyTestData(), "hobbies", GenerateOptions{}); err == nil {
+		t.Error("unknown section regenerated")
+	}
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"strings"
+
+	"opengptmservice/internal/models"
+)
+
+// Private repository settings of PrivacyPolicy
+const (
+	// PrivateNone leaves out all private repositories
+	PrivateNone = "public"
+	// PrivateSelected includes the private repositories the user selected
+	PrivateSelected = "selected"
+	// PrivateAnonymized includes private repositories only in the language
+	// statistics
+	PrivateAnonymized = "anonymized"
+)
+
+// PrivacyPolicy decides which private repositories a CV is generated from.
+// The collected data is filtered with Apply before it is used in a prompt.
+type PrivacyPolicy struct {
+	Private string `json:"private"`
+	// Selected lists the URLs of the private repositories included with
+	// PrivateSelected
+	Selected []string `json:"selected"`
+}
+
+// ParsePrivate returns the private repository setting named value, PrivateNone
+// if it is unknown
+func ParsePrivate(value string) string {
+	switch value {
+	case PrivateSelected, PrivateAnonymized:
+		return value
+	}
+	return PrivateNone
+}
+
+// Apply returns a copy of data following the policy. Private repositories
+// left out are removed along with the pull requests made to them. Anonymized
+// repositories are removed as well and only counted per language in
+// PrivateLanguages, so neither their names nor their dates are kept.
+// Pull requests are kept only when made to a repository kept under its name
+// or to one the provider reported public, so those made to private
+// repositories missing from the collected ones are removed too.
+func (p PrivacyPolicy) Apply(data *models.DeveloperData) *models.DeveloperData {
+	if data == nil {
+		return nil
+	}
+
+	selected := make(map[string]bool, len(p.Selected))
+	for _, url := range p.Selected {
+		selected[normalizeRepoURL(url)] = true
+	}
+
+	result := *data
+	result.Repositories = nil
+	allowed := make(map[string]bool)
+	hidden := make(map[string]bool)
+	result.PrivateLanguages = nil
+	for _, repo := range data.Repositories {
+		switch {
+		case !repo.Private:
+			result.Repositories = append(result.Repositories, repo)
+			allowed[repoKey(repo.HTMLURL)] = true
+		case p.Private == PrivateSelected && selected[normalizeRepoURL(repo.HTMLURL)]:
+			result.Repositories = append(result.Repositories, repo)
+			allowed[repoKey(repo.HTMLURL)] = true
+		case p.Private == PrivateAnonymized:
+			if repo.Language != "" {
+				if result.PrivateLanguages == nil {
+					result.PrivateLanguages = make(map[string]int)
+				}
+				result.PrivateLanguages[repo.Language]++
+			}
+			hidden[repoKey(repo.HTMLURL)] = true
+		default:
+			hidden[repoKey(repo.HTMLURL)] = true
+		}
+	}
+
+	result.PullRequests = nil
+	for _, pr := range data.PullRequests {
+		key := repoKey(pr.Repo)
+		if allowed[key] || pr.Public && !hidden[key] {
+			result.PullRequests = append(result.PullRequests, pr)
+		}
+	}
+
+	return &result
+}
+
+// PrivateRepositories returns the private repositories in data
+func PrivateRepositories(data *models.DeveloperData) []models.Repository {
+	var repos []models.Repository
+	if data == nil {
+		return repos
+	}
+	for _, repo := range data.Repositories {
+		if repo.Private {
+			repos = append(repos, repo)
+		}
+	}
+	return repos
+}
+
+// repoKey returns the owner and name in a repository URL, matching both the
+// web URL of a repository and the API URL pull requests refer to it by,
+// e.g. octocat/hello-world for https://api.github.com/repos/octocat/Hello-World
+func repoKey(url string) string {
+	parts := strings.Split(normalizeRepoURL(url), "/")
+	if len(parts) < 2 {
+		return normalizeRepoURL(url)
+	}
+	return parts[len(parts)-2] + "/" + parts[len(parts)-1]
+}
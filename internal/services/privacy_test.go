@@ -0,0 +1,119 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"opengptmservice/internal/models"
+)
+
+func privacyTestData() *models.DeveloperData {
+	public := repository("website", "jdoe", "https://github.com/jdoe/website", 10)
+	public.Description = "Personal website"
+	secret := repository("payroll", "acme", "https://github.com/acme/payroll", 2)
+	secret.Private = true
+	secret.Description = "Acme payroll service"
+	secret.Language = "Go"
+	secret.Topics = []string{"payments"}
+	other := repository("billing", "acme", "https://github.com/acme/billing", 1)
+	other.Private = true
+	other.Language = "Python"
+
+	return &models.DeveloperData{
+		Profile:      &models.UserProfile{Login: "jdoe"},
+		Repositories: []models.Repository{public, secret, other},
+		PullRequests: []models.PullRequest{
+			{Title: "Fix typo", Repo: "https://api.github.com/repos/jdoe/website"},
+			{Title: "Add Acme payroll export", Repo: "https://api.github.com/repos/acme/Payroll"},
+			{Title: "Bill in EUR", Repo: "https://api.github.com/repos/acme/billing"},
+		},
+	}
+}
+
+func repositoryNames(repos []models.Repository) string {
+	var names []string
+	for _, repo := range repos {
+		names = append(names, repo.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestPrivacyPolicyApply(t *testing.T) {
+	tests := []struct {
+		policy PrivacyPolicy
+		repos  string
+		prs    int
+	}{
+		{PrivacyPolicy{Private: PrivateNone}, "website", 1},
+		{PrivacyPolicy{Private: PrivateSelected, Selected: []string{"https://github.com/ACME/billing/"}}, "website,billing", 2},
+		{PrivacyPolicy{Private: PrivateAnonymized}, "website", 1},
+	}
+
+	for _, tt := range tests {
+		data := privacyTestData()
+		result := tt.policy.Apply(data)
+
+		if got := repositoryNames(result.Repositories); got != tt.repos {
+			t.Errorf("%s: got repositories %s, want %s", tt.policy.Private, got, tt.repos)
+		}
+		if len(result.PullRequests) != tt.prs {
+			t.Errorf("%s: got %d pull requests, want %d", tt.policy.Private, len(result.PullRequests), tt.prs)
+		}
+		if len(data.Repositories) != 3 || len(data.PullRequests) != 3 {
+			t.Errorf("%s: Apply modified the collected data", tt.policy.Private)
+		}
+	}
+}
+
+func TestPrivacyPolicyUnknownRepositories(t *testing.T) {
+	data := privacyTestData()
+	data.PullRequests = append(data.PullRequests,
+		models.PullRequest{Title: "Internal tooling", Repo: "https://api.github.com/repos/acme/unknown"},
+		models.PullRequest{Title: "Fix docs", Repo: "https://api.github.com/repos/golang/go", Public: true},
+		models.PullRequest{Title: "Public copy", Repo: "https://api.github.com/repos/acme/payroll", Public: true},
+	)
+
+	for _, policy := range []PrivacyPolicy{{Private: PrivateNone}, {Private: PrivateAnonymized}} {
+		var titles []string
+		for _, pr := range policy.Apply(data).PullRequests {
+			titles = append(titles, pr.Title)
+		}
+		if got := strings.Join(titles, ","); got != "Fix typo,Fix docs" {
+			t.Errorf("%s: got pull requests %s, want Fix typo,Fix docs", policy.Private, got)
+		}
+	}
+}
+
+func TestPrivacyPolicyAnonymizes(t *testing.T) {
+	data := privacyTestData()
+	data.Repositories = append(data.Repositories, data.Repositories[1])
+	data.Repositories[3].Name = "payroll-v2"
+	result := PrivacyPolicy{Private: PrivateAnonymized}.Apply(data)
+
+	if got := repositoryNames(result.Repositories); got != "website" {
+		t.Errorf("got repositories %s, want only the public one", got)
+	}
+	if len(result.PrivateLanguages) != 2 || result.PrivateLanguages["Go"] != 2 || result.PrivateLanguages["Python"] != 1 {
+		t.Errorf("got private languages %v, want Go 2 and Python 1", result.PrivateLanguages)
+	}
+	if data.PrivateLanguages != nil {
+		t.Error("Apply modified the collected data")
+	}
+	if got := newCVView(result).TopLanguages(2); strings.Join(got, ",") != "Go,Python" {
+		t.Errorf("got top languages %v, want the private ones counted", got)
+	}
+
+	s := &CVService{}
+	prompt := s.cvPrompt(result, GenerateOptions{})
+	for _, spec := range pipelineSections {
+		prompt += spec.prompt(s, result)
+	}
+	if !strings.Contains(prompt, "- Private repositories by language: Go (2), Python (1)\n") {
+		t.Error("prompt does not include the private language statistics")
+	}
+	for _, secret := range []string{"payroll", "Payroll", "acme", "billing", "payments", "Private project"} {
+		if strings.Contains(prompt, secret) {
+			t.Errorf("anonymized data contains %q", secret)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+
+	"opengptmservice/internal/models"
+)
+
+// Personal fields of the profile that can be redacted from prompts
+const (
+	FieldName     = "name"
+	FieldLogin    = "login"
+	FieldEmail    = "email"
+	FieldLocation = "location"
+	FieldTwitter  = "twitter"
+	FieldBlog     = "blog"
+)
+
+// RedactableFields lists the fields that can be redacted, the default of
+// redaction.fields
+var RedactableFields = []string{FieldName, FieldLogin, FieldEmail, FieldLocation, FieldTwitter, FieldBlog}
+
+// RedactionConfig controls which personal identifiers are kept from the LLM
+type RedactionConfig struct {
+	// Always redacts the prompts of every user, not only of those who ask
+	Always bool
+	// Fields lists the redacted fields
+	Fields []string
+}
+
+// NewRedactionConfig reads the redaction configuration from viper
+func NewRedactionConfig() RedactionConfig {
+	config := RedactionConfig{
+		Always: viper.GetBool("redaction.always"),
+		Fields: viper.GetStringSlice("redaction.fields"),
+	}
+	if !viper.IsSet("redaction.fields") {
+		config.Fields = RedactableFields
+	}
+	return config
+}
+
+// emailPattern matches email addresses in free text such as the bio
+var emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+
+// placeholder stands in for a personal identifier in prompts
+type placeholder struct {
+	token   string
+	value   string
+	pattern *regexp.Regexp
+}
+
+// Redactor replaces the personal identifiers of a profile with placeholders
+// such as [NAME] in prompts, and the placeholders with the identifiers in the
+// generated text. A nil Redactor leaves text unchanged.
+type Redactor struct {
+	placeholders []placeholder
+}
+
+// NewRedactor creates a redactor for the given fields of profile. Login
+// redaction covers the login inside URLs such as
+// https://github.com/octocat/hello-world, and email redaction the profile
+// email and addresses found in the bio, company and blog. Redaction hides
+// identifiers, it does not anonymize: repository, organization and pull
+// request names and descriptions are sent as they are.
+func NewRedactor(profile *models.UserProfile, fields []string) *Redactor {
+	r := &Redactor{}
+	if profile == nil {
+		return r
+	}
+
+	for _, field := range fields {
+		switch field {
+		case FieldName:
+			r.add("[NAME]", profile.Name, false)
+		case FieldLogin:
+			r.add("[LOGIN]", profile.Login, true)
+		case FieldLocation:
+			r.add("[LOCATION]", profile.Location, false)
+		case FieldTwitter:
+			r.add("[TWITTER]", profile.TwitterUsername, false)
+		case FieldBlog:
+			r.add("[BLOG]", profile.Blog, false)
+		case FieldEmail:
+			emails := []string{profile.Email}
+			for _, text := range []string{profile.Bio, profile.Company, profile.Blog} {
+				emails = append(emails, emailPattern.FindAllString(text, -1)...)
+			}
+			n := 0
+			for _, email := range emails {
+				if email == "" || r.has(email) {
+					continue
+				}
+				n++
+				token := "[EMAIL]"
+				if n > 1 {
+					token = fmt.Sprintf("[EMAIL_%d]", n)
+				}
+				r.add(token, email, true)
+			}
+		}
+	}
+
+	// Longer values first, so a blog URL containing the name is replaced whole
+	sort.SliceStable(r.placeholders, func(i, j int) bool {
+		return len(r.placeholders[i].value) > len(r.placeholders[j].value)
+	})
+	return r
+}
+
+// add redacts value with token. Values are matched as whole words, and
+// case-insensitively with fold, like emails and logins; values shorter than
+// two characters are kept.
+func (r *Redactor) add(token, value string, fold bool) {
+	value = strings.TrimSpace(value)
+	if len(value) < 2 {
+		return
+	}
+
+	expr := regexp.QuoteMeta(value)
+	if isWordChar(value[0]) {
+		expr = `\b` + expr
+	}
+	if isWordChar(value[len(value)-1]) {
+		expr += `\b`
+	}
+	if fold {
+		expr = "(?i)" + expr
+	}
+	r.placeholders = append(r.placeholders, placeholder{
+		token:   token,
+		value:   value,
+		pattern: regexp.MustCompile(expr),
+	})
+}
+
+// has reports whether value is already redacted
+func (r *Redactor) has(value string) bool {
+	for _, p := range r.placeholders {
+		if strings.EqualFold(p.value, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Redact replaces the personal identifiers in text with their placeholders
+func (r *Redactor) Redact(text string) string {
+	if r == nil {
+		return text
+	}
+	for _, p := range r.placeholders {
+		text = p.pattern.ReplaceAllLiteralString(text, p.token)
+	}
+	return text
+}
+
+// Restore replaces the placeholders in text with the personal identifiers
+func (r *Redactor) Restore(text string) string {
+	if r == nil {
+		return text
+	}
+	for _, p := range r.placeholders {
+		text = strings.ReplaceAll(text, p.token, p.value)
+	}
+	return text
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"opengptmservice/internal/models"
+)
+
+func TestRedactorRoundTrip(t *testing.T) {
+	profile := &models.UserProfile{
+		Name:            "Jane Doe",
+		Email:           "jane@example.com",
+		Bio:             "Write to JANE@example.com or jd@work.example.org",
+		Location:        "Lyon",
+		TwitterUsername: "janedoe",
+		Blog:            "https://janedoe.dev",
+	}
+	prompt := "Name: Jane Doe\nBio: Write to JANE@example.com or jd@work.example.org\n" +
+		"Location: Lyon\nTwitter: janedoe\nBlog: https://janedoe.dev\nRepositories: Lyonnaise-cookbook"
+
+	r := NewRedactor(profile, RedactableFields)
+	redacted := r.Redact(prompt)
+	for _, secret := range []string{"Jane Doe", "jane@example.com", "JANE@example.com", "jd@work.example.org", "Lyon\n", "janedoe"} {
+		if strings.Contains(redacted, secret) {
+			t.Errorf("redacted prompt contains %q:\n%s", secret, redacted)
+		}
+	}
+	for _, want := range []string{"Name: [NAME]", "[EMAIL] or [EMAIL_2]", "Location: [LOCATION]", "Twitter: [TWITTER]", "Blog: [BLOG]", "Lyonnaise-cookbook"} {
+		if !strings.Contains(redacted, want) {
+			t.Errorf("redacted prompt does not contain %q:\n%s", want, redacted)
+		}
+	}
+
+	restored := r.Restore("[NAME] lives in [LOCATION] and blogs at [BLOG]; contact [EMAIL_2].")
+	if want := "Jane Doe lives in Lyon and blogs at https://janedoe.dev; contact jd@work.example.org."; restored != want {
+		t.Errorf("got %q, want %q", restored, want)
+	}
+}
+
+func TestRedactorLogin(t *testing.T) {
+	profile := &models.UserProfile{Login: "jdoe", Name: "Jane Doe"}
+	prompt := "Login: jdoe\n- website (https://github.com/JDoe/website)\n- jdoe-tools by jdoebot"
+
+	r := NewRedactor(profile, RedactableFields)
+	redacted := r.Redact(prompt)
+	if want := "Login: [LOGIN]\n- website (https://github.com/[LOGIN]/website)\n- [LOGIN]-tools by jdoebot"; redacted != want {
+		t.Errorf("got %q, want %q", redacted, want)
+	}
+	if restored := r.Restore("See https://github.com/[LOGIN]/website"); restored != "See https://github.com/jdoe/website" {
+		t.Errorf("got %q", restored)
+	}
+}
+
+func TestRedactorFields(t *testing.T) {
+	profile := &models.UserProfile{Name: "Jane Doe", Location: "Lyon"}
+
+	redacted := NewRedactor(profile, []string{FieldLocation}).Redact("Jane Doe from Lyon")
+	if redacted != "Jane Doe from [LOCATION]" {
+		t.Errorf("got %q, want only the location redacted", redacted)
+	}
+
+	var r *Redactor
+	if got := r.Restore(r.Redact("Jane Doe")); got != "Jane Doe" {
+		t.Errorf("nil redactor changed the text to %q", got)
+	}
+}
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"opengptmservice/internal/models"
+)
+
+// RouteRevision is the llm.routes key of CV revisions
+const RouteRevision = "revision"
+
+// revisionPrompt asks for the whole CV again, changed as its owner asked
+const revisionPrompt = `Revise the following software developer CV according to the feedback of its owner.
+
+Keep every "## " section heading unless the feedback asks to change it. Keep the facts of the CV and do not invent experience, employers, dates or skills. Respond with the complete revised CV in markdown and nothing else.
+
+Feedback:
+%s
+
+CV:
+%s`
+
+// Revise generates cv again following the feedback of its owner, sending the
+// previous CV and the feedback to the LLM in a single revision prompt
+func (s *CVService) Revise(ctx context.Context, data *models.DeveloperData, cv *models.CV, feedback string, opts GenerateOptions) (*models.CV, error) {
+	if !s.llmAvailable() {
+		return nil, errors.New("revising a CV requires an LLM")
+	}
+	redactor := s.redactor(data, opts)
+	prompt := fmt.Sprintf(revisionPrompt, strings.TrimSpace(feedback), cv.Markdown()) + lengthInstructions[opts.Length]
+
+	log.Printf("Revising CV with feedback")
+	completion, err := s.llm.Generate(ctx, redactor.Redact(prompt), RouteRevision, opts.Length)
+	if err != nil {
+		return nil, err
+	}
+	markdown := cleanRevision(redactor.Restore(completion.Text))
+	if markdown == "" {
+		return nil, fmt.Errorf("%s: empty response", completion.Model)
+	}
+	return cv.Revise(markdown, completion.Model), nil
+}
+
+// cleanRevision trims the response and unwraps the code block that models
+// tend to put markdown in
+func cleanRevision(text string) string {
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "```") && strings.HasSuffix(text, "```") {
+		if i := strings.Index(text, "\n"); i >= 0 {
+			text = strings.TrimSpace(strings.TrimSuffix(text[i+1:], "```"))
+		}
+	}
+	return text
+}
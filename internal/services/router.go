@@ -0,0 +1,259 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+
+	"opengptmservice/internal/limiter"
+	"opengptmservice/internal/retry"
+	"opengptmservice/internal/usage"
+)
+
+// ProviderConfig describes an OpenAI-compatible chat completions provider
+type ProviderConfig struct {
+	BaseURL string `mapstructure:"base_url"`
+	APIKey  string `mapstructure:"api_key"`
+}
+
+// ModelConfig describes one entry of the model fallback chain
+type ModelConfig struct {
+	Provider string `mapstructure:"provider"`
+	Model    string `mapstructure:"model"`
+}
+
+// Completion is the text generated by a model
+type Completion struct {
+	Text             string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// ModelRouter sends prompts to an ordered chain of models, falling back to
+// the next model when one is unavailable
+type ModelRouter struct {
+	chain  []*AtomaClient
+	routes map[string][]*AtomaClient
+	usage  *usage.Tracker
+}
+
+// NewModelRouter creates a router from the llm section of the configuration.
+// Without llm.models the chain consists of the model configured under atoma.
+// Token usage of every call is recorded in tracker and concurrent calls are
+// bounded by limits.
+func NewModelRouter(tracker *usage.Tracker, limits *limiter.Group) *ModelRouter {
+	providers := map[string]ProviderConfig{}
+	if err := viper.UnmarshalKey("llm.providers", &providers); err != nil {
+		log.Printf("Warning: Invalid llm.providers configuration: %v", err)
+	}
+	if _, ok := providers["atoma"]; !ok {
+		base := NewAtomaConfig()
+		providers["atoma"] = ProviderConfig{BaseURL: base.BaseURL, APIKey: base.APIKey}
+	}
+
+	var chain []ModelConfig
+	if err := viper.UnmarshalKey("llm.models", &chain); err != nil {
+		log.Printf("Warning: Invalid llm.models configuration: %v", err)
+	}
+	if len(chain) == 0 {
+		chain = []ModelConfig{{Provider: "atoma", Model: viper.GetString("atoma.model")}}
+	}
+
+	r := &ModelRouter{
+		routes: make(map[string][]*AtomaClient),
+		usage:  tracker,
+	}
+	clients := make(map[string]*AtomaClient)
+	client := func(m ModelConfig) *AtomaClient {
+		if c, ok := clients[m.Provider+"/"+m.Model]; ok {
+			return c
+		}
+		provider, ok := providers[m.Provider]
+		if !ok {
+			log.Printf("Warning: Unknown LLM provider %q for model %s", m.Provider, m.Model)
+			return nil
+		}
+
+		config := NewAtomaConfig()
+		config.Provider = m.Provider
+		config.Model = m.Model
+		config.BaseURL = provider.BaseURL
+		config.APIKey = provider.APIKey
+		c := NewAtomaClient(config)
+		c.limiter = limits
+		clients[m.Provider+"/"+m.Model] = c
+		return c
+	}
+
+	for _, m := range chain {
+		if c := client(m); c != nil {
+			r.chain = append(r.chain, c)
+		}
+	}
+	for key, refs := range viper.GetStringMapStringSlice("llm.routes") {
+		for _, ref := range refs {
+			if c := client(parseModelRef(ref, providers)); c != nil {
+				r.routes[key] = append(r.routes[key], c)
+			}
+		}
+	}
+
+	// Calls to models without a price cost nothing, so budgets don't limit them
+	if tracker != nil && tracker.Budgeted() {
+		names := make([]string, 0, len(clients))
+		for name := range clients {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if !tracker.Priced(name) {
+				log.Printf("Warning: No llm.pricing for model %s, its calls do not count towards the daily budgets", name)
+			}
+		}
+	}
+
+	return r
+}
+
+// parseModelRef parses "provider/model". Model names may contain slashes
+// themselves, so refs without a configured provider prefix default to atoma.
+func parseModelRef(ref string, providers map[string]ProviderConfig) ModelConfig {
+	if i := strings.Index(ref, "/"); i > 0 {
+		if _, ok := providers[ref[:i]]; ok {
+			return ModelConfig{Provider: ref[:i], Model: ref[i+1:]}
+		}
+	}
+	return ModelConfig{Provider: "atoma", Model: ref}
+}
+
+// Available reports whether any model can be called
+func (r *ModelRouter) Available() bool {
+	for _, c := range r.chain {
+		if c.config.APIKey != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Signature describes the configured chain and routes, so results can be
+// tied to the models that may have produced them
+func (r *ModelRouter) Signature() string {
+	var parts []string
+	for _, c := range r.chain {
+		parts = append(parts, c.Name())
+	}
+	keys := make([]string, 0, len(r.routes))
+	for key := range r.routes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		var names []string
+		for _, c := range r.routes[key] {
+			names = append(names, c.Name())
+		}
+		parts = append(parts, key+"="+strings.Join(names, ","))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Chain returns the models to try for the first route key that has a route
+// configured, followed by the default chain
+func (r *ModelRouter) Chain(keys ...string) []*AtomaClient {
+	var routed []*AtomaClient
+	for _, key := range keys {
+		if clients, ok := r.routes[key]; ok {
+			routed = clients
+			break
+		}
+	}
+
+	seen := make(map[*AtomaClient]bool)
+	var chain []*AtomaClient
+	for _, c := range append(append([]*AtomaClient{}, routed...), r.chain...) {
+		if !seen[c] && c.config.APIKey != "" {
+			seen[c] = true
+			chain = append(chain, c)
+		}
+	}
+	return chain
+}
+
+// Generate sends the prompt to the models routed for keys as a single user
+// message, like Chat
+func (r *ModelRouter) Generate(ctx context.Context, prompt string, keys ...string) (*Completion, error) {
+	return r.Chat(ctx, []Message{{Role: RoleUser, Content: prompt}}, keys...)
+}
+
+// Chat sends the conversation to the models routed for keys in order until
+// one of them succeeds. It only falls back on errors another model may not
+// have. Calls are refused once the daily budget of the user in ctx is spent;
+// calls already under way are recorded when they return, which may overshoot
+// the budget.
+func (r *ModelRouter) Chat(ctx context.Context, messages []Message, keys ...string) (*Completion, error) {
+	chain := r.Chain(keys...)
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("no LLM model configured")
+	}
+
+	var lastErr error
+	for i, c := range chain {
+		if err := r.usage.Check(usage.ScopeFrom(ctx).User); err != nil {
+			return nil, err
+		}
+
+		completion, err := c.Chat(ctx, messages)
+		if err == nil {
+			r.usage.Record(ctx, completion.Model, completion.PromptTokens, completion.CompletionTokens)
+			return completion, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		lastErr = fmt.Errorf("%s: %w", c.Name(), err)
+		if !shouldFallback(err) {
+			return nil, lastErr
+		}
+		if i+1 < len(chain) {
+			log.Printf("Warning: Model %s failed, falling back to %s: %v", c.Name(), chain[i+1].Name(), err)
+		}
+	}
+
+	return nil, lastErr
+}
+
+// shouldFallback reports whether a failed request may succeed with another
+// model: retries were exhausted, the model timed out or is rejected by its
+// circuit breaker, or the prompt exceeded the model's context length
+func shouldFallback(err error) bool {
+	if errors.Is(err, retry.ErrExhausted) ||
+		errors.Is(err, retry.ErrCircuitOpen) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	return isContextLengthError(err)
+}
+
+// isContextLengthError reports whether err is a provider rejecting a prompt
+// that is too long for the model
+func isContextLengthError(err error) bool {
+	var httpErr *retry.HTTPError
+	if !errors.As(err, &httpErr) {
+		return false
+	}
+	body := strings.ToLower(httpErr.Body)
+	for _, marker := range []string{"context_length_exceeded", "context length", "maximum context", "too many tokens"} {
+		if strings.Contains(body, marker) {
+			return true
+		}
+	}
+	return httpErr.StatusCode == 413
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"opengptmservice/internal/fakellm"
+	"opengptmservice/internal/retry"
+	"opengptmservice/internal/usage"
+)
+
+// newTestModel returns a client for model on its own fake LLM server, with a
+// single attempt per call unless retries are needed to exhaust it
+func newTestModel(t *testing.T, model string) (*AtomaClient, *fakellm.Server) {
+	t.Helper()
+	fake := fakellm.New()
+	fake.APIKey = "test-key"
+	ts := httptest.NewServer(fake)
+	t.Cleanup(ts.Close)
+
+	client := NewAtomaClient(&AtomaConfig{
+		Provider:         "fake",
+		APIKey:           "test-key",
+		Model:            model,
+		BaseURL:          ts.URL + "/v1/chat/completions",
+		MaxTokens:        100,
+		Timeout:          time.Second,
+		RetryDelay:       time.Millisecond,
+		MaxRetryDelay:    time.Millisecond,
+		MaxElapsed:       5 * time.Second,
+		BreakerThreshold: 10,
+		BreakerCooldown:  time.Minute,
+	})
+	return client, fake
+}
+
+func TestModelRouterFallback(t *testing.T) {
+	tests := []struct {
+		name      string
+		primary   fakellm.Behaviour
+		setup     func(c *AtomaClient)
+		fallback  bool
+		wantError string
+	}{
+		{name: "retries exhausted", primary: fakellm.Fail(http.StatusInternalServerError), fallback: true},
+		{
+			name:    "circuit open",
+			primary: fakellm.Respond("unused"),
+			setup: func(c *AtomaClient) {
+				c.policy.Breaker = retry.NewBreaker(c.Name(), 1, time.Minute)
+				c.policy.Breaker.Failure()
+			},
+			fallback: true,
+		},
+		{
+			name:     "deadline exceeded",
+			primary:  fakellm.Slow(200*time.Millisecond, fakellm.Respond("late")),
+			setup:    func(c *AtomaClient) { c.config.Timeout = 50 * time.Millisecond },
+			fallback: true,
+		},
+		{name: "payload too large", primary: fakellm.Fail(http.StatusRequestEntityTooLarge), fallback: true},
+		{
+			name:     "context length exceeded",
+			primary:  fakellm.Behaviour{Kind: fakellm.KindError, Status: http.StatusBadRequest, Body: `{"error": {"code": "context_length_exceeded"}}`},
+			fallback: true,
+		},
+		{name: "bad request", primary: fakellm.Fail(http.StatusBadRequest), wantError: "primary-model: "},
+		{name: "unauthorized", primary: fakellm.Fail(http.StatusUnauthorized), wantError: "primary-model: "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary, primaryFake := newTestModel(t, "primary-model")
+			secondary, secondaryFake := newTestModel(t, "secondary-model")
+			primaryFake.SetDefault(tt.primary)
+			secondaryFake.SetDefault(fakellm.Respond("from secondary"))
+			if tt.setup != nil {
+				tt.setup(primary)
+			}
+			r := &ModelRouter{chain: []*AtomaClient{primary, secondary}, usage: usage.NewTracker(nil, 0, 0)}
+
+			completion, err := r.Generate(context.Background(), "prompt")
+			if !tt.fallback {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Errorf("got %v, want an error of the primary model", err)
+				}
+				if got := len(secondaryFake.Requests()); got != 0 {
+					t.Errorf("fell back to the secondary model with %d requests", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got %v, want a fallback", err)
+			}
+			if completion.Text != "from secondary" || completion.Model != "fake/secondary-model" {
+				t.Errorf("got completion %+v, want the secondary model's", completion)
+			}
+		})
+	}
+}
+
+func TestModelRouterAllModelsFail(t *testing.T) {
+	primary, primaryFake := newTestModel(t, "primary-model")
+	secondary, secondaryFake := newTestModel(t, "secondary-model")
+	primaryFake.SetDefault(fakellm.Fail(http.StatusInternalServerError))
+	secondaryFake.SetDefault(fakellm.Fail(http.StatusInternalServerError))
+	r := &ModelRouter{chain: []*AtomaClient{primary, secondary}, usage: usage.NewTracker(nil, 0, 0)}
+
+	_, err := r.Generate(context.Background(), "prompt")
+	if !errors.Is(err, retry.ErrExhausted) || !strings.HasPrefix(err.Error(), "fake/secondary-model: ") {
+		t.Errorf("got %v, want the exhausted error of the last model", err)
+	}
+}
+
+func TestModelRouterChain(t *testing.T) {
+	a, _ := newTestModel(t, "a")
+	b, _ := newTestModel(t, "b")
+	c, _ := newTestModel(t, "c")
+	noKey, _ := newTestModel(t, "no-key")
+	noKey.config.APIKey = ""
+
+	r := &ModelRouter{
+		chain: []*AtomaClient{a, noKey, b},
+		routes: map[string][]*AtomaClient{
+			"summary": {c, a},
+			"short":   {noKey, b},
+		},
+	}
+
+	tests := []struct {
+		keys []string
+		want string
+	}{
+		{nil, "a,b"},
+		{[]string{"unrouted"}, "a,b"},
+		// Routed models come first, without repeating them from the chain
+		{[]string{"summary"}, "c,a,b"},
+		// The first key with a route wins
+		{[]string{"unrouted", "short", "summary"}, "b,a"},
+		{[]string{"summary", "short"}, "c,a,b"},
+	}
+	for _, tt := range tests {
+		var names []string
+		for _, client := range r.Chain(tt.keys...) {
+			names = append(names, client.config.Model)
+		}
+		if got := strings.Join(names, ","); got != tt.want {
+			t.Errorf("Chain(%v) = %s, want %s", tt.keys, got, tt.want)
+		}
+	}
+}
+
+func TestModelRouterSkipsModelsWithoutKey(t *testing.T) {
+	noKey, noKeyFake := newTestModel(t, "no-key")
+	noKey.config.APIKey = ""
+	r := &ModelRouter{chain: []*AtomaClient{noKey}, usage: usage.NewTracker(nil, 0, 0)}
+	if r.Available() {
+		t.Error("router without keys reported available")
+	}
+	if _, err := r.Generate(context.Background(), "prompt"); err == nil {
+		t.Error("router without keys generated")
+	}
+
+	keyed, _ := newTestModel(t, "keyed")
+	r.chain = append(r.chain, keyed)
+	completion, err := r.Generate(context.Background(), "prompt")
+	if err != nil || completion.Model != "fake/keyed" {
+		t.Errorf("got %+v, %v, want the model with a key", completion, err)
+	}
+	if got := len(noKeyFake.Requests()); got != 0 {
+		t.Errorf("model without key got %d requests", got)
+	}
+}
+
+func TestShouldFallback(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{fmt.Errorf("call: %w", retry.ErrExhausted), true},
+		{&retry.CircuitOpenError{Name: "fake"}, true},
+		{fmt.Errorf("call: %w", context.DeadlineExceeded), true},
+		{&retry.HTTPError{StatusCode: http.StatusRequestEntityTooLarge}, true},
+		{&retry.HTTPError{StatusCode: http.StatusBadRequest, Body: "This model's maximum context length is 8192 tokens"}, true},
+		{&retry.HTTPError{StatusCode: http.StatusBadRequest, Body: "invalid temperature"}, false},
+		{&retry.HTTPError{StatusCode: http.StatusNotFound}, false},
+		{context.Canceled, false},
+	}
+	for _, tt := range tests {
+		if got := shouldFallback(tt.err); got != tt.want {
+			t.Errorf("shouldFallback(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
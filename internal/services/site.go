@@ -0,0 +1,281 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"opengptmservice/internal/models"
+)
+
+//go:embed templates/site
+var siteFS embed.FS
+
+// Themes of the portfolio site
+const (
+	SiteThemeLight = "light"
+	SiteThemeDark  = "dark"
+)
+
+// SiteThemes lists the themes of the portfolio site, the default first
+var SiteThemes = []string{SiteThemeLight, SiteThemeDark}
+
+// maxSiteProjects is the number of projects with a page on the site
+const maxSiteProjects = 12
+
+// maxTimelineEvents bounds the events on the timeline page
+const maxTimelineEvents = 200
+
+// SiteInput is what a portfolio site is built from
+type SiteInput struct {
+	Data *models.DeveloperData
+	CV   *models.CV
+	// Readmes holds the README markdown of projects by repository URL
+	Readmes map[string]string
+}
+
+// SiteGenerator builds a static portfolio website from the developer data
+// and the generated CV: an index of projects, a page per project from its
+// README, a skills page and a contribution timeline
+type SiteGenerator struct {
+	pages map[string]*template.Template
+}
+
+// NewSiteGenerator creates a portfolio site generator
+func NewSiteGenerator() *SiteGenerator {
+	layout := template.Must(template.ParseFS(siteFS, "templates/site/layout.html"))
+	g := &SiteGenerator{pages: make(map[string]*template.Template)}
+	for _, page := range []string{"index", "project", "skills", "timeline"} {
+		g.pages[page] = template.Must(template.Must(layout.Clone()).ParseFS(siteFS, "templates/site/"+page+".html"))
+	}
+	return g
+}
+
+// SiteProjects returns the repositories that get a project page: the most
+// starred public repositories. Private repositories are left out even when
+// the CV includes them, as their READMEs would be published.
+func SiteProjects(data *models.DeveloperData) []models.Repository {
+	var public []models.Repository
+	for _, repo := range data.Repositories {
+		if !repo.Private && repo.HTMLURL != "" {
+			public = append(public, repo)
+		}
+	}
+	return topRepositories(public, maxSiteProjects)
+}
+
+// siteLink is a link in the footer of the site
+type siteLink struct {
+	Label string
+	URL   string
+}
+
+// siteProject is a project with a page on the site
+type siteProject struct {
+	models.Repository
+	Slug   string
+	Readme template.HTML
+}
+
+// timelineEvent is an entry of the timeline page
+type timelineEvent struct {
+	Date  time.Time
+	Kind  string
+	Title string
+	URL   string
+}
+
+// timelineYear groups the timeline by year
+type timelineYear struct {
+	Year   int
+	Events []timelineEvent
+}
+
+// sitePage is the data passed to the site templates
+type sitePage struct {
+	Title       string
+	Description string
+	// Root is the relative path to the root of the site
+	Root      string
+	Name      string
+	Profile   *models.UserProfile
+	Links     []siteLink
+	Summary   template.HTML
+	Skills    template.HTML
+	Projects  []siteProject
+	Project   *siteProject
+	Languages []LanguageStat
+	Topics    []string
+	Timeline  []timelineYear
+}
+
+// Build writes the site with theme as a zip archive to w. All links are
+// relative and the archive contains a .nojekyll file, so it can be deployed
+// to GitHub Pages as is.
+func (g *SiteGenerator) Build(w io.Writer, in SiteInput, theme string) error {
+	if in.Data == nil || in.Data.Profile == nil {
+		return fmt.Errorf("no developer data to build the site from")
+	}
+	css, err := siteFS.ReadFile("templates/site/themes/" + theme + ".css")
+	if err != nil {
+		return fmt.Errorf("unknown site theme %q", theme)
+	}
+
+	view := newCVView(in.Data)
+	base := sitePage{
+		Name:        view.Name,
+		Description: in.Data.Profile.Bio,
+		Profile:     in.Data.Profile,
+		Languages:   view.Languages,
+		Topics:      view.Topics,
+	}
+	if p := in.Data.Profile; p.HTMLURL != "" {
+		provider := p.Provider
+		if provider == "" {
+			provider = "GitHub"
+		}
+		base.Links = append(base.Links, siteLink{provider, p.HTMLURL})
+	}
+	if blog := in.Data.Profile.Blog; blog != "" {
+		base.Links = append(base.Links, siteLink{"Blog", blog})
+	}
+	if twitter := in.Data.Profile.TwitterUsername; twitter != "" {
+		base.Links = append(base.Links, siteLink{"Twitter", "https://twitter.com/" + twitter})
+	}
+	if in.CV != nil {
+		if section := in.CV.Section(SectionSummary); section != nil {
+			base.Summary = RenderMarkdown(section.Content)
+		}
+		if section := in.CV.Section(SectionSkills); section != nil {
+			base.Skills = RenderMarkdown(section.Content)
+		}
+	}
+
+	slugs := make(map[string]bool)
+	for _, repo := range SiteProjects(in.Data) {
+		project := siteProject{Repository: repo, Slug: siteSlug(repo.Name, slugs)}
+		if readme := in.Readmes[repo.HTMLURL]; readme != "" {
+			project.Readme = RenderMarkdown(readme)
+		}
+		base.Projects = append(base.Projects, project)
+	}
+
+	zw := zip.NewWriter(w)
+	files := map[string][]byte{
+		".nojekyll": nil,
+		"style.css": css,
+	}
+	render := func(name, page string, data sitePage) error {
+		var buf bytes.Buffer
+		if err := g.pages[page].ExecuteTemplate(&buf, "layout", data); err != nil {
+			return fmt.Errorf("failed to render %s: %v", name, err)
+		}
+		files[name] = buf.Bytes()
+		return nil
+	}
+
+	index := base
+	index.Title = base.Name
+	if err := render("index.html", "index", index); err != nil {
+		return err
+	}
+	skills := base
+	skills.Title = "Skills - " + base.Name
+	if err := render("skills.html", "skills", skills); err != nil {
+		return err
+	}
+	timeline := base
+	timeline.Title = "Timeline - " + base.Name
+	timeline.Timeline = siteTimeline(in.Data)
+	if err := render("timeline.html", "timeline", timeline); err != nil {
+		return err
+	}
+	for i := range base.Projects {
+		project := base
+		project.Root = "../"
+		project.Project = &base.Projects[i]
+		project.Title = project.Project.Name + " - " + base.Name
+		project.Description = project.Project.Description
+		if err := render("projects/"+project.Project.Slug+".html", "project", project); err != nil {
+			return err
+		}
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(files[name]); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// siteTimeline returns the repositories created and pull requests opened
+// in data, newest first and grouped by year
+func siteTimeline(data *models.DeveloperData) []timelineYear {
+	var events []timelineEvent
+	for _, repo := range data.Repositories {
+		if repo.Private || repo.CreatedAt.IsZero() {
+			continue
+		}
+		events = append(events, timelineEvent{Date: repo.CreatedAt, Kind: "Created", Title: repo.Name, URL: repo.HTMLURL})
+	}
+	for _, pr := range data.PullRequests {
+		if pr.CreatedAt.IsZero() {
+			continue
+		}
+		title := pr.Title
+		if key := repoKey(pr.Repo); key != "" {
+			title += " (" + key + ")"
+		}
+		events = append(events, timelineEvent{Date: pr.CreatedAt, Kind: "Pull request", Title: title, URL: pr.HTMLURL})
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Date.After(events[j].Date)
+	})
+	if len(events) > maxTimelineEvents {
+		events = events[:maxTimelineEvents]
+	}
+
+	var years []timelineYear
+	for _, event := range events {
+		if len(years) == 0 || years[len(years)-1].Year != event.Date.Year() {
+			years = append(years, timelineYear{Year: event.Date.Year()})
+		}
+		years[len(years)-1].Events = append(years[len(years)-1].Events, event)
+	}
+	return years
+}
+
+// siteSlug returns a file name for the page of name, unique among taken
+func siteSlug(name string, taken map[string]bool) string {
+	slug := strings.Trim(strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.' {
+			return r
+		}
+		return '-'
+	}, strings.ToLower(name)), "-.")
+	if slug == "" {
+		slug = "project"
+	}
+	unique := slug
+	for i := 2; taken[unique]; i++ {
+		unique = fmt.Sprintf("%s-%d", slug, i)
+	}
+	taken[unique] = true
+	return unique
+}
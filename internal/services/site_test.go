@@ -0,0 +1,80 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"opengptmservice/internal/models"
+)
+
+func TestSiteGeneratorBuild(t *testing.T) {
+	data := privacyTestData()
+	data.Profile.Name = "Jane Doe"
+	data.Profile.Bio = "Builds websites"
+	data.Repositories[0].CreatedAt = time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	data.Repositories[0].Language = "Go"
+	data.PullRequests[0].CreatedAt = time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)
+	cv := &models.CV{Sections: []models.CVSection{
+		{Name: SectionSummary, Title: "Professional Summary", Content: "Web **developer**"},
+	}}
+	readmes := map[string]string{"https://github.com/jdoe/website": "# Website\n\nMy site <script>alert(1)</script>"}
+
+	var buf bytes.Buffer
+	if err := NewSiteGenerator().Build(&buf, SiteInput{Data: data, CV: cv, Readmes: readmes}, SiteThemeDark); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(content)
+	}
+
+	for name, want := range map[string]string{
+		".nojekyll":             "",
+		"style.css":             "#0d1117",
+		"index.html":            `href="projects/website.html"`,
+		"skills.html":           "Go",
+		"timeline.html":         "2023",
+		"projects/website.html": "<h1>Website</h1>",
+	} {
+		content, ok := files[name]
+		if !ok {
+			t.Errorf("site has no %s", name)
+			continue
+		}
+		if !strings.Contains(content, want) {
+			t.Errorf("%s does not contain %q", name, want)
+		}
+	}
+	if !strings.Contains(files["index.html"], "Web <strong>developer</strong>") {
+		t.Error("index does not render the CV summary")
+	}
+	if !strings.Contains(files["projects/website.html"], `href="../style.css"`) {
+		t.Error("project page does not link the stylesheet relatively")
+	}
+	if strings.Contains(files["projects/website.html"], "<script>") {
+		t.Error("project page contains raw HTML from the README")
+	}
+	for name := range files {
+		if strings.Contains(name, "payroll") || strings.Contains(name, "billing") {
+			t.Errorf("site publishes private repository %s", name)
+		}
+	}
+
+	if err := NewSiteGenerator().Build(io.Discard, SiteInput{Data: data}, "neon"); err == nil {
+		t.Error("unknown theme accepted")
+	}
+}
@@ -0,0 +1,236 @@
+package services
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"opengptmservice/internal/models"
+)
+
+//go:embed templates/cv.md.tmpl
+var cvTemplateFS embed.FS
+
+// TemplateGenerator builds a CV from GitHub data using Go templates, without an LLM
+type TemplateGenerator struct {
+	tmpl *template.Template
+}
+
+// NewTemplateGenerator creates a template-based CV generator
+func NewTemplateGenerator() *TemplateGenerator {
+	tmpl := template.Must(template.New("cv").Funcs(template.FuncMap{
+		"join": strings.Join,
+	}).ParseFS(cvTemplateFS, "templates/cv.md.tmpl"))
+
+	return &TemplateGenerator{tmpl: tmpl}
+}
+
+// Generate builds a complete CV with all pipeline sections
+func (g *TemplateGenerator) Generate(data *models.DeveloperData) (*models.CV, error) {
+	cv := &models.CV{}
+
+	header, err := g.Section(data, SectionHeader)
+	if err != nil {
+		return nil, err
+	}
+	cv.Sections = append(cv.Sections, models.CVSection{Name: SectionHeader, Content: header})
+
+	for _, spec := range pipelineSections {
+		content, err := g.Section(data, spec.name)
+		if err != nil {
+			return nil, err
+		}
+		cv.Sections = append(cv.Sections, models.CVSection{
+			Name:    spec.name,
+			Title:   spec.title,
+			Content: content,
+		})
+	}
+
+	return cv, nil
+}
+
+// Section renders the content of a single section. data must have a profile.
+func (g *TemplateGenerator) Section(data *models.DeveloperData, name string) (string, error) {
+	if data == nil || data.Profile == nil {
+		return "", fmt.Errorf("failed to render section %s: no profile", name)
+	}
+	var buf bytes.Buffer
+	if err := g.tmpl.ExecuteTemplate(&buf, name, newCVView(data)); err != nil {
+		return "", fmt.Errorf("failed to render section %s: %v", name, err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// LanguageStat counts the repositories using a language
+type LanguageStat struct {
+	Name  string
+	Repos int
+}
+
+// PullRequestSummary aggregates a user's pull requests
+type PullRequestSummary struct {
+	Total  int
+	Open   int
+	Closed int
+	Repos  []string
+	Recent []models.PullRequest
+}
+
+// cvView is the data passed to the CV templates
+type cvView struct {
+	Profile         *models.UserProfile
+	Name            string
+	Links           []string
+	Languages       []LanguageStat
+	Topics          []string
+	Stars           int
+	Organizations   []models.Organization
+	TopRepositories []models.Repository
+	PullRequests    *PullRequestSummary
+	Contributions   *models.ContributionStats
+}
+
+func newCVView(data *models.DeveloperData) *cvView {
+	p := data.Profile
+	v := &cvView{
+		Profile:         p,
+		Name:            p.Name,
+		Languages:       languageStats(data.Repositories, data.PrivateLanguages),
+		Organizations:   data.Organizations,
+		TopRepositories: topRepositories(data.Repositories, 5),
+		PullRequests:    summarizePullRequests(data.PullRequests),
+		Contributions:   data.Contributions,
+	}
+	if v.Name == "" {
+		v.Name = p.Login
+	}
+
+	if p.HTMLURL != "" {
+		provider := p.Provider
+		if provider == "" {
+			provider = "GitHub"
+		}
+		v.Links = append(v.Links, fmt.Sprintf("[%s](%s)", provider, p.HTMLURL))
+	}
+	if p.Blog != "" {
+		v.Links = append(v.Links, fmt.Sprintf("[Blog](%s)", p.Blog))
+	}
+	if p.TwitterUsername != "" {
+		v.Links = append(v.Links, fmt.Sprintf("[Twitter](https://twitter.com/%s)", p.TwitterUsername))
+	}
+	if p.Location != "" {
+		v.Links = append(v.Links, p.Location)
+	}
+
+	seen := make(map[string]bool)
+	for _, repo := range data.Repositories {
+		v.Stars += repo.Stars
+		for _, topic := range repo.Topics {
+			if !seen[topic] {
+				seen[topic] = true
+				v.Topics = append(v.Topics, topic)
+			}
+		}
+	}
+	sort.Strings(v.Topics)
+
+	return v
+}
+
+// TopLanguages returns the names of the n most used languages
+func (v *cvView) TopLanguages(n int) []string {
+	var names []string
+	for i, l := range v.Languages {
+		if i == n {
+			break
+		}
+		names = append(names, l.Name)
+	}
+	return names
+}
+
+// MemberSince returns the year the GitHub account was created
+func (v *cvView) MemberSince() string {
+	created, err := time.Parse(time.RFC3339, v.Profile.CreatedAt)
+	if err != nil {
+		return v.Profile.CreatedAt
+	}
+	return created.Format("2006")
+}
+
+// languageStats returns the languages used across repositories and the
+// private repositories counted in private, ordered by the number of
+// repositories using them
+func languageStats(repos []models.Repository, private map[string]int) []LanguageStat {
+	counts := make(map[string]int)
+	for name, count := range private {
+		counts[name] += count
+	}
+	for _, repo := range repos {
+		if repo.Language != "" {
+			counts[repo.Language]++
+		}
+	}
+
+	stats := make([]LanguageStat, 0, len(counts))
+	for name, count := range counts {
+		stats = append(stats, LanguageStat{Name: name, Repos: count})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Repos != stats[j].Repos {
+			return stats[i].Repos > stats[j].Repos
+		}
+		return stats[i].Name < stats[j].Name
+	})
+	return stats
+}
+
+// topRepositories returns up to n repositories ordered by stars
+func topRepositories(repos []models.Repository, n int) []models.Repository {
+	sorted := make([]models.Repository, len(repos))
+	copy(sorted, repos)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Stars > sorted[j].Stars
+	})
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
+
+func summarizePullRequests(prs []models.PullRequest) *PullRequestSummary {
+	if len(prs) == 0 {
+		return nil
+	}
+
+	summary := &PullRequestSummary{Total: len(prs)}
+	seen := make(map[string]bool)
+	for _, pr := range prs {
+		switch pr.State {
+		case "open":
+			summary.Open++
+		case "closed":
+			summary.Closed++
+		}
+		if pr.Repo != "" && !seen[pr.Repo] {
+			seen[pr.Repo] = true
+			summary.Repos = append(summary.Repos, pr.Repo)
+		}
+	}
+
+	summary.Recent = make([]models.PullRequest, len(prs))
+	copy(summary.Recent, prs)
+	sort.SliceStable(summary.Recent, func(i, j int) bool {
+		return summary.Recent[i].CreatedAt.After(summary.Recent[j].CreatedAt)
+	})
+	if len(summary.Recent) > 5 {
+		summary.Recent = summary.Recent[:5]
+	}
+
+	return summary
+}
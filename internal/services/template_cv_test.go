@@ -0,0 +1,94 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"opengptmservice/internal/models"
+)
+
+func TestTemplateGenerator(t *testing.T) {
+	tests := []struct {
+		name string
+		data *models.DeveloperData
+		// want maps section names to text the section contains
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:    "no data",
+			data:    nil,
+			wantErr: true,
+		},
+		{
+			name:    "missing profile",
+			data:    &models.DeveloperData{Repositories: privacyTestData().Repositories},
+			wantErr: true,
+		},
+		{
+			name: "empty data",
+			data: &models.DeveloperData{Profile: &models.UserProfile{Login: "jdoe"}},
+			want: map[string]string{
+				SectionHeader:        "# jdoe",
+				SectionSummary:       "Software developer with 0 public repositories and 0 followers on GitHub.",
+				SectionSkills:        "No language information available.",
+				SectionExperience:    "Independent open source developer.",
+				SectionProjects:      "No public projects yet.",
+				SectionContributions: "No pull requests found.",
+			},
+		},
+		{
+			name: "sections",
+			data: func() *models.DeveloperData {
+				data := privacyTestData()
+				data.Profile = &models.UserProfile{
+					Login: "jdoe", Name: "Jane Doe", Bio: "Gopher", Company: "Acme",
+					PublicRepos: 3, Followers: 7, HTMLURL: "https://github.com/jdoe", Location: "Lyon",
+				}
+				data.Repositories = data.Repositories[:1]
+				data.Repositories[0].Language = "Go"
+				data.Organizations = []models.Organization{{Login: "golang", HTMLURL: "https://github.com/golang"}}
+				data.PullRequests[0].State = "closed"
+				data.PullRequests[0].HTMLURL = "https://github.com/jdoe/website/pull/1"
+				data.Contributions = &models.ContributionStats{TotalContributions: 42, Commits: 30}
+				return data
+			}(),
+			want: map[string]string{
+				SectionHeader:        "# Jane Doe\n\n[GitHub](https://github.com/jdoe) · Lyon",
+				SectionSummary:       "Gopher\n\nSoftware developer with 3 public repositories and 7 followers on GitHub, working primarily with Go. Their projects have earned 10 stars in total. They made 42 contributions on GitHub in the last year.",
+				SectionSkills:        "- **Languages:** Go (1 repository)",
+				SectionExperience:    "- **Acme**\n- Member of [golang](https://github.com/golang)",
+				SectionProjects:      "- **[website](https://github.com/jdoe/website)** — Personal website (Go, ★ 10)",
+				SectionContributions: "- [Fix typo](https://github.com/jdoe/website/pull/1) (closed)",
+			},
+		},
+	}
+
+	g := NewTemplateGenerator()
+	for _, tt := range tests {
+		cv, err := g.Generate(tt.data)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: got a CV, want an error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		if len(cv.Sections) != len(pipelineSections)+1 {
+			t.Fatalf("%s: got %d sections, want %d", tt.name, len(cv.Sections), len(pipelineSections)+1)
+		}
+		for name, want := range tt.want {
+			section := cv.Section(name)
+			if section == nil {
+				t.Errorf("%s: no %s section", tt.name, name)
+				continue
+			}
+			if !strings.Contains(section.Content, want) {
+				t.Errorf("%s: %s section is\n%s\nwant it to contain\n%s", tt.name, name, section.Content, want)
+			}
+		}
+	}
+}
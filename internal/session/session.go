@@ -0,0 +1,242 @@
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"opengptmservice/internal/auth"
+	"opengptmservice/internal/models"
+	"opengptmservice/internal/services"
+)
+
+// CookieName is the name of the cookie holding the session ID
+const CookieName = "cv_session"
+
+// Account is an account the user connected on one host
+type Account struct {
+	Host  string
+	Login string
+	auth.Token
+	// InstallationID is the user's installation of the host's GitHub App,
+	// set when the user opted in to include private repositories
+	InstallationID int64
+}
+
+// Session holds the state of a logged-in user between requests
+type Session struct {
+	sync.Mutex
+
+	ID      string
+	Options services.GenerateOptions
+	JobID   string
+	// PendingHost is the host of the OAuth flow in progress, State the
+	// state parameter its callback must return and Connect whether it adds
+	// an account rather than starting over
+	PendingHost string
+	State       string
+	Connect     bool
+	// Private is set when the user opted in to include private repositories
+	// and Review when the user reviews the data sent before generation.
+	// Privacy decides which private repositories are sent.
+	Private bool
+	Review  bool
+	Privacy services.PrivacyPolicy
+	// Accounts are the connected accounts, the first being the primary one
+	Accounts []Account
+	User     map[string]interface{}
+	// Warnings are shown with the CV, e.g. about missing token scopes
+	Warnings []string
+	// Collected is the data collected from the accounts and Data the part
+	// of it the CV was generated from, following Privacy
+	Collected *models.DeveloperData
+	Data      *models.DeveloperData
+	CV        *models.CV
+	// VersionID is the stored version of CV, if storage is enabled
+	VersionID string
+	// Theme is the name of the theme the CV is shown and exported with
+	Theme string
+	// Chat is the conversation refining CV, started over with every
+	// generated CV
+	Chat services.Chat
+
+	// lastSeen is the time of the last request of the session, guarded by
+	// the store
+	lastSeen time.Time
+}
+
+// Owner identifies the user as host/login of the primary account, the owner
+// of the stored CV versions. It is empty before the user signed in.
+func (s *Session) Owner() string {
+	if len(s.Accounts) == 0 {
+		return ""
+	}
+	return s.Accounts[0].Host + "/" + s.Accounts[0].Login
+}
+
+// AddAccount connects account, replacing the account previously connected on the same host
+func (s *Session) AddAccount(account Account) {
+	for i, a := range s.Accounts {
+		if a.Host == account.Host {
+			s.Accounts[i] = account
+			return
+		}
+	}
+	s.Accounts = append(s.Accounts, account)
+}
+
+// UpdateAccount replaces the account connected on the same host as account,
+// if it is still connected, e.g. with a refreshed token
+func (s *Session) UpdateAccount(account Account) {
+	for i, a := range s.Accounts {
+		if a.Host == account.Host {
+			s.Accounts[i] = account
+			return
+		}
+	}
+}
+
+// HasAccount reports whether an account is connected on host
+func (s *Session) HasAccount(host string) bool {
+	for _, a := range s.Accounts {
+		if a.Host == host {
+			return true
+		}
+	}
+	return false
+}
+
+// Store keeps sessions in memory. Sessions without requests for the idle
+// timeout are removed.
+type Store struct {
+	idleTimeout time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+// NewStore creates a new in-memory session store removing sessions idle for
+// idleTimeout until ctx is done. An idleTimeout of 0 keeps sessions forever.
+func NewStore(ctx context.Context, idleTimeout time.Duration) *Store {
+	s := &Store{
+		idleTimeout: idleTimeout,
+		sessions:    make(map[string]*Session),
+	}
+	if idleTimeout > 0 {
+		go s.sweep(ctx)
+	}
+	return s
+}
+
+// Get returns the session referenced by the request cookie, if any
+func (s *Store) Get(c *gin.Context) (*Session, bool) {
+	id, err := c.Cookie(CookieName)
+	if err != nil {
+		return nil, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[id]
+	if !ok {
+		return nil, false
+	}
+	now := time.Now()
+	if s.idle(sess, now) {
+		delete(s.sessions, id)
+		return nil, false
+	}
+	sess.lastSeen = now
+	return sess, true
+}
+
+// Ensure returns the current session, creating it and setting the cookie if needed
+func (s *Store) Ensure(c *gin.Context) *Session {
+	if sess, ok := s.Get(c); ok {
+		return sess
+	}
+
+	sess := &Session{ID: newID(), lastSeen: time.Now()}
+	s.mu.Lock()
+	s.sessions[sess.ID] = sess
+	s.mu.Unlock()
+
+	setCookie(c, sess.ID)
+	return sess
+}
+
+// Renew gives sess a new ID and sets the cookie to it, so that an ID known
+// before signing in, e.g. one planted by an attacker, no longer refers to the
+// session. The session must be locked.
+func (s *Store) Renew(c *gin.Context, sess *Session) {
+	s.mu.Lock()
+	delete(s.sessions, sess.ID)
+	sess.ID = newID()
+	s.sessions[sess.ID] = sess
+	s.mu.Unlock()
+
+	setCookie(c, sess.ID)
+}
+
+// Delete removes the current session
+func (s *Store) Delete(c *gin.Context) {
+	id, err := c.Cookie(CookieName)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	delete(s.sessions, id)
+	s.mu.Unlock()
+	c.SetCookie(CookieName, "", -1, "/", "", false, true)
+}
+
+// idle reports whether sess had no request for the idle timeout. Callers
+// hold s.mu.
+func (s *Store) idle(sess *Session, now time.Time) bool {
+	return s.idleTimeout > 0 && now.Sub(sess.lastSeen) > s.idleTimeout
+}
+
+// sweep removes idle sessions until ctx is done
+func (s *Store) sweep(ctx context.Context) {
+	ticker := time.NewTicker(s.idleTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.mu.Lock()
+			for id, sess := range s.sessions {
+				if s.idle(sess, now) {
+					delete(s.sessions, id)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+func setCookie(c *gin.Context, id string) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(CookieName, id, 0, "/", "", false, true)
+}
+
+// NewState returns a random state parameter for an OAuth flow
+func NewState() string {
+	return newID()
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
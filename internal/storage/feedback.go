@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"sort"
+	"time"
+)
+
+// Feedback is a comment of a user on one of their CV versions. It records
+// how the version was generated so operators can tell which prompts and
+// models the comments are about, even once the version is deleted.
+type Feedback struct {
+	ID        string `json:"id"`
+	User      string `json:"user"`
+	VersionID string `json:"version_id"`
+	Comment   string `json:"comment"`
+	// Revision is set when the user had the CV regenerated with the comment
+	Revision      bool      `json:"revision"`
+	PromptVersion int       `json:"prompt_version"`
+	Models        []string  `json:"models"`
+	Mode          string    `json:"mode"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// FeedbackFor returns the feedback of the user of v on v, carrying its
+// generation details
+func FeedbackFor(v *Version, comment string, revision bool) *Feedback {
+	return &Feedback{
+		User:          v.User,
+		VersionID:     v.ID,
+		Comment:       comment,
+		Revision:      revision,
+		PromptVersion: v.PromptVersion,
+		Models:        v.Models,
+		Mode:          v.Mode,
+	}
+}
+
+// FeedbackSummary aggregates the feedback of all users for operators
+type FeedbackSummary struct {
+	Total int `json:"total"`
+	// Revisions counts the comments the CV was regenerated with
+	Revisions       int            `json:"revisions"`
+	ByPromptVersion map[int]int    `json:"by_prompt_version"`
+	ByModel         map[string]int `json:"by_model"`
+	ByMode          map[string]int `json:"by_mode"`
+	// Recent are the newest comments
+	Recent []*Feedback `json:"recent"`
+}
+
+// SummarizeFeedback aggregates feedback, newest first, keeping up to recent
+// comments
+func SummarizeFeedback(feedback []*Feedback, recent int) *FeedbackSummary {
+	summary := &FeedbackSummary{
+		Total:           len(feedback),
+		ByPromptVersion: make(map[int]int),
+		ByModel:         make(map[string]int),
+		ByMode:          make(map[string]int),
+		Recent:          []*Feedback{},
+	}
+	for _, f := range feedback {
+		if f.Revision {
+			summary.Revisions++
+		}
+		summary.ByPromptVersion[f.PromptVersion]++
+		for _, model := range f.Models {
+			summary.ByModel[model]++
+		}
+		summary.ByMode[f.Mode]++
+	}
+	if len(feedback) > recent {
+		feedback = feedback[:recent]
+	}
+	summary.Recent = append(summary.Recent, feedback...)
+	return summary
+}
+
+// sortFeedback orders feedback newest first
+func sortFeedback(feedback []*Feedback) {
+	sort.SliceStable(feedback, func(i, j int) bool {
+		return feedback[i].CreatedAt.After(feedback[j].CreatedAt)
+	})
+}
@@ -0,0 +1,336 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Filesystem stores every version as a JSON file in a directory per user, the
+// publications of all users in publications.json and every feedback comment
+// as a JSON file in a directory per user and version under feedback
+type Filesystem struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewFilesystem creates a store in dir, creating the directory if needed
+func NewFilesystem(dir string) (*Filesystem, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %v", err)
+	}
+	return &Filesystem{dir: dir}, nil
+}
+
+// Save implements Store
+func (f *Filesystem) Save(v *Version) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	versions, err := f.list(v.User)
+	if err != nil {
+		return err
+	}
+	v.ID = newID()
+	v.Number = 1
+	if len(versions) > 0 {
+		v.Number = versions[0].Number + 1
+	}
+	v.CreatedAt = time.Now().UTC()
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	dir := f.userDir(v.User)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(dir, v.ID+".json"), data)
+}
+
+// writeFile writes data to a temporary file first and renames it to path, so
+// readers never see partial files
+func writeFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// List implements Store
+func (f *Filesystem) List(user string) ([]*Version, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.list(user)
+}
+
+func (f *Filesystem) list(user string) ([]*Version, error) {
+	files, err := filepath.Glob(filepath.Join(f.userDir(user), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]*Version, 0, len(files))
+	for _, file := range files {
+		v, err := f.read(file)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Number > versions[j].Number
+	})
+	return versions, nil
+}
+
+// Get implements Store
+func (f *Filesystem) Get(user, id string) (*Version, error) {
+	path, err := f.path(user, id)
+	if err != nil {
+		return nil, err
+	}
+	v, err := f.read(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return v, err
+}
+
+// Delete implements Store
+func (f *Filesystem) Delete(user, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path, err := f.path(user, id)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (f *Filesystem) read(path string) (*Version, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var v Version
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, fmt.Errorf("corrupt CV version %s: %v", path, err)
+	}
+	return &v, nil
+}
+
+// userDir returns the directory of user, whose name is escaped to stay
+// inside the store
+func (f *Filesystem) userDir(user string) string {
+	return filepath.Join(f.dir, url.PathEscape(user))
+}
+
+// path returns the file of version id, rejecting IDs that are not plain
+// file names
+func (f *Filesystem) path(user, id string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\.`) {
+		return "", ErrNotFound
+	}
+	return filepath.Join(f.userDir(user), id+".json"), nil
+}
+
+// Publish implements Store
+func (f *Filesystem) Publish(p *Publication) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	publications, err := f.publications()
+	if err != nil {
+		return err
+	}
+	for _, existing := range publications {
+		if existing.Slug == p.Slug && existing.User != p.User {
+			return ErrSlugTaken
+		}
+	}
+	if p.CreatedAt.IsZero() {
+		p.CreatedAt = time.Now().UTC()
+	}
+	publication := *p
+	publications[p.User] = &publication
+	return f.writePublications(publications)
+}
+
+// Publication implements Store
+func (f *Filesystem) Publication(slug string) (*Publication, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	publications, err := f.publications()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range publications {
+		if p.Slug == slug {
+			return p, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// UserPublication implements Store
+func (f *Filesystem) UserPublication(user string) (*Publication, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	publications, err := f.publications()
+	if err != nil {
+		return nil, err
+	}
+	if p, ok := publications[user]; ok {
+		return p, nil
+	}
+	return nil, ErrNotFound
+}
+
+// Unpublish implements Store
+func (f *Filesystem) Unpublish(user string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	publications, err := f.publications()
+	if err != nil {
+		return err
+	}
+	if _, ok := publications[user]; !ok {
+		return nil
+	}
+	delete(publications, user)
+	return f.writePublications(publications)
+}
+
+// CountView implements Store
+func (f *Filesystem) CountView(slug string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	publications, err := f.publications()
+	if err != nil {
+		return err
+	}
+	for _, p := range publications {
+		if p.Slug == slug {
+			p.Views++
+			return f.writePublications(publications)
+		}
+	}
+	return nil
+}
+
+// publications reads the publications of all users by user
+func (f *Filesystem) publications() (map[string]*Publication, error) {
+	publications := make(map[string]*Publication)
+	data, err := os.ReadFile(filepath.Join(f.dir, "publications.json"))
+	if os.IsNotExist(err) {
+		return publications, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &publications); err != nil {
+		return nil, fmt.Errorf("corrupt publications: %v", err)
+	}
+	return publications, nil
+}
+
+func (f *Filesystem) writePublications(publications map[string]*Publication) error {
+	data, err := json.Marshal(publications)
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(f.dir, "publications.json"), data)
+}
+
+// AddFeedback implements Store
+func (f *Filesystem) AddFeedback(feedback *Feedback) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stored := *feedback
+	stored.ID = newID()
+	stored.CreatedAt = time.Now().UTC()
+	data, err := json.Marshal(&stored)
+	if err != nil {
+		return err
+	}
+	dir := f.feedbackDir(stored.User, stored.VersionID)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	if err := writeFile(filepath.Join(dir, stored.ID+".json"), data); err != nil {
+		return err
+	}
+	feedback.ID, feedback.CreatedAt = stored.ID, stored.CreatedAt
+	return nil
+}
+
+// Feedback implements Store
+func (f *Filesystem) Feedback(user, id string) ([]*Feedback, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.feedback(filepath.Join(f.feedbackDir(user, id), "*.json"))
+}
+
+// AllFeedback implements Store
+func (f *Filesystem) AllFeedback() ([]*Feedback, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.feedback(filepath.Join(f.dir, "feedback", "*", "*", "*.json"))
+}
+
+// feedback reads the feedback files matching pattern, newest first
+func (f *Filesystem) feedback(pattern string) ([]*Feedback, error) {
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	feedback := make([]*Feedback, 0, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var fb Feedback
+		if err := json.Unmarshal(data, &fb); err != nil {
+			return nil, fmt.Errorf("corrupt feedback %s: %v", file, err)
+		}
+		feedback = append(feedback, &fb)
+	}
+	sortFeedback(feedback)
+	return feedback, nil
+}
+
+// feedbackDir returns the directory of the feedback of user on version id.
+// Both are escaped to stay inside the store, and the version is prefixed so
+// that empty and dot IDs are plain directory names too.
+func (f *Filesystem) feedbackDir(user, id string) string {
+	return filepath.Join(f.dir, "feedback", url.PathEscape(user), "v-"+url.PathEscape(id))
+}
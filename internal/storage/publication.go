@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrSlugTaken is returned when another user published under the same slug
+var ErrSlugTaken = errors.New("this address is already taken")
+
+// Visibilities of a publication
+const (
+	// VisibilityPublic lets anyone with the address see the CV
+	VisibilityPublic = "public"
+	// VisibilityUnlisted requires the random token of the publication in
+	// the address
+	VisibilityUnlisted = "unlisted"
+	// VisibilityPassword requires the password of the publication
+	VisibilityPassword = "password"
+)
+
+// slugPattern matches valid slugs: lowercase letters, digits and dashes
+var slugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// ValidSlug reports whether slug can be used as the address of a publication
+func ValidSlug(slug string) bool {
+	return slugPattern.MatchString(slug)
+}
+
+// Publication makes a CV version of a user available at /u/<slug>. Each user
+// has at most one publication.
+type Publication struct {
+	User      string `json:"user"`
+	Slug      string `json:"slug"`
+	VersionID string `json:"version_id"`
+	// Theme is the name of the theme the CV is shown with
+	Theme      string `json:"theme"`
+	Visibility string `json:"visibility"`
+	// Token is the secret of unlisted publications
+	Token        string `json:"token,omitempty"`
+	PasswordHash string `json:"password_hash,omitempty"`
+	// ExpiresAt is when the publication stops being visible, if set
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Views     int        `json:"views"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Expired reports whether the publication is no longer visible at now
+func (p *Publication) Expired(now time.Time) bool {
+	return p.ExpiresAt != nil && !now.Before(*p.ExpiresAt)
+}
+
+// SetPassword stores the hash of password
+func (p *Publication) SetPassword(password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	p.PasswordHash = string(hash)
+	return nil
+}
+
+// CheckPassword reports whether password is the password of the publication
+func (p *Publication) CheckPassword(password string) bool {
+	return p.PasswordHash != "" && bcrypt.CompareHashAndPassword([]byte(p.PasswordHash), []byte(password)) == nil
+}
+
+// NewToken returns a random token for unlisted publications
+func NewToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,397 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	// Pure Go SQLite driver, registered as "sqlite"
+	_ "modernc.org/sqlite"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS cv_versions (
+	id TEXT PRIMARY KEY,
+	user TEXT NOT NULL,
+	number INTEGER NOT NULL,
+	created_at TEXT NOT NULL,
+	source TEXT NOT NULL,
+	prompt_version INTEGER NOT NULL,
+	models TEXT NOT NULL,
+	mode TEXT NOT NULL,
+	length TEXT NOT NULL,
+	cv TEXT NOT NULL,
+	data TEXT NOT NULL,
+	UNIQUE (user, number)
+);
+CREATE INDEX IF NOT EXISTS cv_versions_user ON cv_versions (user, number DESC);
+CREATE TABLE IF NOT EXISTS publications (
+	user TEXT PRIMARY KEY,
+	slug TEXT NOT NULL UNIQUE,
+	version_id TEXT NOT NULL,
+	visibility TEXT NOT NULL,
+	token TEXT NOT NULL,
+	password_hash TEXT NOT NULL,
+	expires_at TEXT NOT NULL,
+	views INTEGER NOT NULL,
+	created_at TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS feedback (
+	id TEXT PRIMARY KEY,
+	user TEXT NOT NULL,
+	version_id TEXT NOT NULL,
+	comment TEXT NOT NULL,
+	revision INTEGER NOT NULL,
+	prompt_version INTEGER NOT NULL,
+	models TEXT NOT NULL,
+	mode TEXT NOT NULL,
+	created_at TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS feedback_version ON feedback (user, version_id);
+`
+
+// sqliteMigrations add the columns introduced after the tables were created,
+// by table and column
+var sqliteMigrations = []struct {
+	table, column, definition string
+}{
+	{"publications", "theme", "TEXT NOT NULL DEFAULT ''"},
+}
+
+// sqliteTimeLayout is RFC 3339 with a fixed number of fractional digits, so
+// stored times sort in order as text. Times are stored in UTC, which keeps
+// the zone a fixed "Z" and parses with time.RFC3339Nano like older rows.
+const sqliteTimeLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+// sqliteTime formats t for storage
+func sqliteTime(t time.Time) string {
+	return t.UTC().Format(sqliteTimeLayout)
+}
+
+// SQLite stores the versions, publications and feedback in a SQLite database
+type SQLite struct {
+	db *sql.DB
+}
+
+// NewSQLite opens or creates the database at path
+func NewSQLite(path string) (*SQLite, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, fmt.Errorf("failed to create storage directory: %v", err)
+		}
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CV database: %v", err)
+	}
+	// SQLite allows a single writer; one connection avoids busy errors
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create CV database schema: %v", err)
+	}
+	if err := migrateSQLite(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate CV database: %v", err)
+	}
+	return &SQLite{db: db}, nil
+}
+
+// migrateSQLite adds the columns of sqliteMigrations missing from the database
+func migrateSQLite(db *sql.DB) error {
+	for _, m := range sqliteMigrations {
+		var n int
+		err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, m.table, m.column).Scan(&n)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			if _, err := db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, m.table, m.column, m.definition)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Close closes the database
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
+
+// Save implements Store
+func (s *SQLite) Save(v *Version) error {
+	modelsJSON, err := json.Marshal(v.Models)
+	if err != nil {
+		return err
+	}
+	cv, err := json.Marshal(v.CV)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(v.Data)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var number int
+	if err := tx.QueryRow(`SELECT COALESCE(MAX(number), 0) + 1 FROM cv_versions WHERE user = ?`, v.User).Scan(&number); err != nil {
+		return err
+	}
+	id := newID()
+	createdAt := time.Now().UTC()
+	_, err = tx.Exec(`INSERT INTO cv_versions
+		(id, user, number, created_at, source, prompt_version, models, mode, length, cv, data)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		id, v.User, number, sqliteTime(createdAt), v.Source, v.PromptVersion,
+		string(modelsJSON), v.Mode, v.Length, string(cv), string(data))
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	v.ID, v.Number, v.CreatedAt = id, number, createdAt
+	return nil
+}
+
+// List implements Store. The listed versions have no CV or data.
+func (s *SQLite) List(user string) ([]*Version, error) {
+	rows, err := s.db.Query(`SELECT id, user, number, created_at, source, prompt_version, models, mode, length
+		FROM cv_versions WHERE user = ? ORDER BY number DESC`, user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []*Version
+	for rows.Next() {
+		var v Version
+		var createdAt, modelsJSON string
+		if err := rows.Scan(&v.ID, &v.User, &v.Number, &createdAt, &v.Source, &v.PromptVersion,
+			&modelsJSON, &v.Mode, &v.Length); err != nil {
+			return nil, err
+		}
+		if err := decodeVersion(&v, createdAt, modelsJSON, "", ""); err != nil {
+			return nil, err
+		}
+		versions = append(versions, &v)
+	}
+	return versions, rows.Err()
+}
+
+// Get implements Store
+func (s *SQLite) Get(user, id string) (*Version, error) {
+	var v Version
+	var createdAt, modelsJSON, cv, data string
+	err := s.db.QueryRow(`SELECT id, user, number, created_at, source, prompt_version, models, mode, length, cv, data
+		FROM cv_versions WHERE user = ? AND id = ?`, user, id).
+		Scan(&v.ID, &v.User, &v.Number, &createdAt, &v.Source, &v.PromptVersion,
+			&modelsJSON, &v.Mode, &v.Length, &cv, &data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := decodeVersion(&v, createdAt, modelsJSON, cv, data); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// Delete implements Store
+func (s *SQLite) Delete(user, id string) error {
+	result, err := s.db.Exec(`DELETE FROM cv_versions WHERE user = ? AND id = ?`, user, id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Publish implements Store
+func (s *SQLite) Publish(p *Publication) error {
+	if p.CreatedAt.IsZero() {
+		p.CreatedAt = time.Now().UTC()
+	}
+	expiresAt := ""
+	if p.ExpiresAt != nil {
+		expiresAt = sqliteTime(*p.ExpiresAt)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var owner string
+	err = tx.QueryRow(`SELECT user FROM publications WHERE slug = ?`, p.Slug).Scan(&owner)
+	if err == nil && owner != p.User {
+		return ErrSlugTaken
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO publications
+		(user, slug, version_id, theme, visibility, token, password_hash, expires_at, views, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (user) DO UPDATE SET
+			slug = excluded.slug, version_id = excluded.version_id, theme = excluded.theme, visibility = excluded.visibility,
+			token = excluded.token, password_hash = excluded.password_hash, expires_at = excluded.expires_at,
+			views = excluded.views, created_at = excluded.created_at`,
+		p.User, p.Slug, p.VersionID, p.Theme, p.Visibility, p.Token, p.PasswordHash, expiresAt,
+		p.Views, sqliteTime(p.CreatedAt))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Publication implements Store
+func (s *SQLite) Publication(slug string) (*Publication, error) {
+	return s.publication(`slug = ?`, slug)
+}
+
+// UserPublication implements Store
+func (s *SQLite) UserPublication(user string) (*Publication, error) {
+	return s.publication(`user = ?`, user)
+}
+
+func (s *SQLite) publication(where string, arg string) (*Publication, error) {
+	var p Publication
+	var expiresAt, createdAt string
+	err := s.db.QueryRow(`SELECT user, slug, version_id, theme, visibility, token, password_hash, expires_at, views, created_at
+		FROM publications WHERE `+where, arg).
+		Scan(&p.User, &p.Slug, &p.VersionID, &p.Theme, &p.Visibility, &p.Token, &p.PasswordHash, &expiresAt, &p.Views, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if p.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+		return nil, fmt.Errorf("corrupt publication %s: %v", p.Slug, err)
+	}
+	if expiresAt != "" {
+		t, err := time.Parse(time.RFC3339Nano, expiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("corrupt publication %s: %v", p.Slug, err)
+		}
+		p.ExpiresAt = &t
+	}
+	return &p, nil
+}
+
+// Unpublish implements Store
+func (s *SQLite) Unpublish(user string) error {
+	_, err := s.db.Exec(`DELETE FROM publications WHERE user = ?`, user)
+	return err
+}
+
+// CountView implements Store
+func (s *SQLite) CountView(slug string) error {
+	_, err := s.db.Exec(`UPDATE publications SET views = views + 1 WHERE slug = ?`, slug)
+	return err
+}
+
+// AddFeedback implements Store
+func (s *SQLite) AddFeedback(f *Feedback) error {
+	modelsJSON, err := json.Marshal(f.Models)
+	if err != nil {
+		return err
+	}
+	id := newID()
+	createdAt := time.Now().UTC()
+	_, err = s.db.Exec(`INSERT INTO feedback
+		(id, user, version_id, comment, revision, prompt_version, models, mode, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		id, f.User, f.VersionID, f.Comment, f.Revision, f.PromptVersion, string(modelsJSON), f.Mode,
+		sqliteTime(createdAt))
+	if err != nil {
+		return err
+	}
+	f.ID, f.CreatedAt = id, createdAt
+	return nil
+}
+
+// Feedback implements Store
+func (s *SQLite) Feedback(user, id string) ([]*Feedback, error) {
+	return s.feedback(`WHERE user = ? AND version_id = ?`, user, id)
+}
+
+// AllFeedback implements Store
+func (s *SQLite) AllFeedback() ([]*Feedback, error) {
+	return s.feedback(``)
+}
+
+func (s *SQLite) feedback(where string, args ...interface{}) ([]*Feedback, error) {
+	rows, err := s.db.Query(`SELECT id, user, version_id, comment, revision, prompt_version, models, mode, created_at
+		FROM feedback `+where+` ORDER BY created_at DESC, rowid DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var feedback []*Feedback
+	for rows.Next() {
+		var f Feedback
+		var modelsJSON, createdAt string
+		if err := rows.Scan(&f.ID, &f.User, &f.VersionID, &f.Comment, &f.Revision, &f.PromptVersion,
+			&modelsJSON, &f.Mode, &createdAt); err != nil {
+			return nil, err
+		}
+		if f.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+			return nil, fmt.Errorf("corrupt feedback %s: %v", f.ID, err)
+		}
+		if err := json.Unmarshal([]byte(modelsJSON), &f.Models); err != nil {
+			return nil, fmt.Errorf("corrupt feedback %s: %v", f.ID, err)
+		}
+		feedback = append(feedback, &f)
+	}
+	return feedback, rows.Err()
+}
+
+// decodeVersion fills in the columns of v stored as text, leaving the CV and
+// data out when they are empty
+func decodeVersion(v *Version, createdAt, modelsJSON, cv, data string) error {
+	var err error
+	if v.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+		return fmt.Errorf("corrupt CV version %s: %v", v.ID, err)
+	}
+	if err := json.Unmarshal([]byte(modelsJSON), &v.Models); err != nil {
+		return fmt.Errorf("corrupt CV version %s: %v", v.ID, err)
+	}
+	if cv != "" {
+		if err := json.Unmarshal([]byte(cv), &v.CV); err != nil {
+			return fmt.Errorf("corrupt CV version %s: %v", v.ID, err)
+		}
+	}
+	if data != "" {
+		if err := json.Unmarshal([]byte(data), &v.Data); err != nil {
+			return fmt.Errorf("corrupt CV version %s: %v", v.ID, err)
+		}
+	}
+	return nil
+}
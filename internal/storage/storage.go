@@ -0,0 +1,122 @@
+// Package storage keeps the generated CVs of every user as a version history,
+// the publications of their CVs and their feedback on them.
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"opengptmservice/internal/models"
+)
+
+// ErrNotFound is returned for versions that do not exist or belong to
+// another user
+var ErrNotFound = errors.New("CV version not found")
+
+// Sources of a version
+const (
+	SourceGenerated = "generated"
+	SourceSection   = "section"
+	SourceEdited    = "edited"
+	SourceRevised   = "revised"
+	SourceChat      = "chat"
+)
+
+// Version is a stored CV along with everything it was generated from
+type Version struct {
+	ID string `json:"id"`
+	// User identifies the owner as host/login of their primary account
+	User string `json:"user"`
+	// Number counts the versions of the user from 1
+	Number    int       `json:"number"`
+	CreatedAt time.Time `json:"created_at"`
+	// Source tells how the version was made, e.g. SourceGenerated
+	Source string `json:"source"`
+	// PromptVersion, Models, Mode and Length describe the generation
+	PromptVersion int        `json:"prompt_version"`
+	Models        []string   `json:"models"`
+	Mode          string     `json:"mode"`
+	Length        string     `json:"length"`
+	CV            *models.CV `json:"cv"`
+	// Data is the snapshot of the developer data the CV was generated from
+	Data *models.DeveloperData `json:"data"`
+}
+
+// Summary returns a copy of v without the CV and data, for listings
+func (v *Version) Summary() *Version {
+	summary := *v
+	summary.CV = nil
+	summary.Data = nil
+	return &summary
+}
+
+// Store keeps the CV versions of every user
+type Store interface {
+	// Save stores v as the newest version of v.User, setting its ID, Number
+	// and CreatedAt
+	Save(v *Version) error
+	// List returns the versions of user, newest first
+	List(user string) ([]*Version, error)
+	// Get returns the version id of user, or ErrNotFound
+	Get(user, id string) (*Version, error)
+	// Delete removes the version id of user, or returns ErrNotFound
+	Delete(user, id string) error
+
+	// Publish stores p as the publication of p.User, replacing the previous
+	// one, or returns ErrSlugTaken
+	Publish(p *Publication) error
+	// Publication returns the publication at slug, or ErrNotFound
+	Publication(slug string) (*Publication, error)
+	// UserPublication returns the publication of user, or ErrNotFound
+	UserPublication(user string) (*Publication, error)
+	// Unpublish removes the publication of user
+	Unpublish(user string) error
+	// CountView adds a view to the publication at slug
+	CountView(slug string) error
+
+	// AddFeedback stores f, setting its ID and CreatedAt
+	AddFeedback(f *Feedback) error
+	// Feedback returns the feedback of user on the version id, newest first
+	Feedback(user, id string) ([]*Feedback, error)
+	// AllFeedback returns the feedback of all users, newest first
+	AllFeedback() ([]*Feedback, error)
+}
+
+// NewStoreFromConfig creates the store selected by storage.backend: "sqlite"
+// (the default) with the database in storage.path, "filesystem" with a
+// directory per user under storage.dir, or "none". It returns nil when
+// storage is disabled.
+func NewStoreFromConfig() (Store, error) {
+	switch backend := viper.GetString("storage.backend"); backend {
+	case "", "sqlite":
+		path := viper.GetString("storage.path")
+		if path == "" {
+			path = filepath.Join("data", "cvs.db")
+		}
+		return NewSQLite(path)
+	case "filesystem":
+		dir := viper.GetString("storage.dir")
+		if dir == "" {
+			dir = filepath.Join("data", "cvs")
+		}
+		return NewFilesystem(dir)
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", backend)
+	}
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
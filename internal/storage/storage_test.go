@@ -0,0 +1,227 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"opengptmservice/internal/models"
+)
+
+func testStores(t *testing.T) map[string]Store {
+	dir := t.TempDir()
+	db, err := NewSQLite(filepath.Join(dir, "db", "cvs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	fs, err := NewFilesystem(filepath.Join(dir, "cvs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]Store{"sqlite": db, "filesystem": fs}
+}
+
+func testVersion(user, summary string) *Version {
+	return &Version{
+		User:          user,
+		Source:        SourceGenerated,
+		PromptVersion: 3,
+		Models:        []string{"gpt-4o"},
+		Mode:          "sections",
+		Length:        "standard",
+		CV: &models.CV{Sections: []models.CVSection{
+			{Name: "summary", Title: "Summary", Content: summary, Model: "gpt-4o"},
+		}},
+		Data: &models.DeveloperData{Profile: &models.UserProfile{Login: "jdoe"}},
+	}
+}
+
+func TestStore(t *testing.T) {
+	for name, store := range testStores(t) {
+		first := testVersion("github/jdoe", "First")
+		if err := store.Save(first); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		second := testVersion("github/jdoe", "Second")
+		if err := store.Save(second); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if err := store.Save(testVersion("gitlab/jdoe", "Other")); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if first.ID == "" || first.Number != 1 || second.Number != 2 || first.CreatedAt.IsZero() {
+			t.Errorf("%s: versions not numbered: %+v, %+v", name, first, second)
+		}
+
+		versions, err := store.List("github/jdoe")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(versions) != 2 || versions[0].ID != second.ID || versions[1].ID != first.ID {
+			t.Fatalf("%s: got versions %+v, want newest first", name, versions)
+		}
+
+		got, err := store.Get("github/jdoe", first.ID)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(got.CV, first.CV) || got.Data.Profile.Login != "jdoe" ||
+			got.PromptVersion != 3 || got.Mode != "sections" || !reflect.DeepEqual(got.Models, first.Models) {
+			t.Errorf("%s: got %+v, want %+v", name, got, first)
+		}
+
+		if _, err := store.Get("gitlab/jdoe", first.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: got version of another user, err %v", name, err)
+		}
+		if err := store.Delete("gitlab/jdoe", first.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: deleted version of another user, err %v", name, err)
+		}
+		if _, err := store.Get("github/jdoe", "../../etc/passwd"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: got err %v for an invalid ID", name, err)
+		}
+
+		if err := store.Delete("github/jdoe", first.ID); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if _, err := store.Get("github/jdoe", first.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: deleted version still found, err %v", name, err)
+		}
+
+		third := testVersion("github/jdoe", "Third")
+		if err := store.Save(third); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if third.Number != 3 {
+			t.Errorf("%s: got number %d after a delete, want 3", name, third.Number)
+		}
+	}
+}
+
+func TestPublications(t *testing.T) {
+	for name, store := range testStores(t) {
+		p := &Publication{User: "github/jdoe", Slug: "jdoe", VersionID: "v1", Theme: "modern", Visibility: VisibilityPassword}
+		if err := p.SetPassword("secret"); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Publish(p); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		taken := &Publication{User: "gitlab/jdoe", Slug: "jdoe", VersionID: "v2", Visibility: VisibilityPublic}
+		if err := store.Publish(taken); !errors.Is(err, ErrSlugTaken) {
+			t.Errorf("%s: got err %v publishing under a taken slug", name, err)
+		}
+
+		for i := 0; i < 2; i++ {
+			if err := store.CountView("jdoe"); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+		}
+		got, err := store.Publication("jdoe")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got.User != "github/jdoe" || got.Views != 2 || got.Theme != "modern" || !got.CheckPassword("secret") || got.CheckPassword("wrong") {
+			t.Errorf("%s: got publication %+v", name, got)
+		}
+
+		// Publishing again replaces the slug of the user
+		expires := time.Now().Add(-time.Minute)
+		p.Slug, p.ExpiresAt = "john", &expires
+		if err := store.Publish(p); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if _, err := store.Publication("jdoe"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: old slug still published, err %v", name, err)
+		}
+		got, err = store.UserPublication("github/jdoe")
+		if err != nil || got.Slug != "john" || !got.Expired(time.Now()) {
+			t.Errorf("%s: got publication %+v, err %v", name, got, err)
+		}
+
+		if err := store.Unpublish("github/jdoe"); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if _, err := store.Publication("john"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: unpublished CV still found, err %v", name, err)
+		}
+	}
+}
+
+func TestFeedback(t *testing.T) {
+	for name, store := range testStores(t) {
+		v := testVersion("github/jdoe", "First")
+		v.ID = "v1"
+		if err := store.AddFeedback(FeedbackFor(v, "Too long", false)); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		revision := FeedbackFor(v, "Mention Go", true)
+		if err := store.AddFeedback(revision); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if err := store.AddFeedback(FeedbackFor(testVersion("gitlab/jdoe", "Other"), "Nice", false)); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if revision.ID == "" || revision.CreatedAt.IsZero() {
+			t.Errorf("%s: feedback not stored: %+v", name, revision)
+		}
+
+		feedback, err := store.Feedback("github/jdoe", "v1")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(feedback) != 2 || feedback[0].Comment != "Mention Go" || !feedback[0].Revision ||
+			feedback[0].PromptVersion != 3 || !reflect.DeepEqual(feedback[0].Models, []string{"gpt-4o"}) {
+			t.Errorf("%s: got feedback %+v, want newest first", name, feedback)
+		}
+		if other, err := store.Feedback("github/jdoe", "v2"); err != nil || len(other) != 0 {
+			t.Errorf("%s: got feedback %+v, %v on another version", name, other, err)
+		}
+		if other, err := store.Feedback("gitlab/jdoe", ""); err != nil || len(other) != 1 || other[0].Comment != "Nice" {
+			t.Errorf("%s: got feedback %+v, %v of another user", name, other, err)
+		}
+
+		all, err := store.AllFeedback()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		summary := SummarizeFeedback(all, 2)
+		if summary.Total != 3 || summary.Revisions != 1 || summary.ByModel["gpt-4o"] != 3 ||
+			summary.ByPromptVersion[3] != 3 || len(summary.Recent) != 2 || summary.Recent[0].Comment != "Nice" {
+			t.Errorf("%s: got summary %+v", name, summary)
+		}
+	}
+}
+
+func TestSQLiteTimeOrder(t *testing.T) {
+	// With trailing zeros trimmed, a whole second sorts before the
+	// fractions of the previous one
+	earlier := time.Date(2024, 5, 1, 12, 0, 4, 500000000, time.UTC)
+	later := earlier.Add(500 * time.Millisecond)
+	if sqliteTime(earlier) >= sqliteTime(later) {
+		t.Errorf("%s sorts after %s", sqliteTime(earlier), sqliteTime(later))
+	}
+	if parsed, err := time.Parse(time.RFC3339Nano, sqliteTime(later)); err != nil || !parsed.Equal(later) {
+		t.Errorf("got %v, %v, want %v", parsed, err, later)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	diff := Diff("a\nb\nc\n", "a\nc\nd\n")
+	want := []DiffLine{
+		{DiffEqual, "a"},
+		{DiffDelete, "b"},
+		{DiffEqual, "c"},
+		{DiffInsert, "d"},
+	}
+	if !reflect.DeepEqual(diff, want) {
+		t.Errorf("got %v, want %v", diff, want)
+	}
+
+	if diff := Diff("", "a"); !reflect.DeepEqual(diff, []DiffLine{{DiffInsert, "a"}}) {
+		t.Errorf("got %v for an insert into an empty text", diff)
+	}
+}
@@ -0,0 +1,116 @@
+package theme
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// remoteImage matches the image tags of rendered CVs along with their source
+// and alternative text
+var remoteImage = regexp.MustCompile(`(?is)<img\b[^>]*>`)
+
+var (
+	imageSource = regexp.MustCompile(`(?is)\bsrc\s*=\s*"([^"]*)"`)
+	imageAlt    = regexp.MustCompile(`(?is)\balt\s*=\s*"([^"]*)"`)
+)
+
+// PDFConverter turns the standalone HTML documents of themes into PDF by
+// running an external command such as wkhtmltopdf or a headless Chromium
+type PDFConverter struct {
+	// Command is the program and its arguments, in which {input} and
+	// {output} are replaced with the paths of the HTML and PDF files
+	Command []string
+	Timeout time.Duration
+
+	// slots bounds the number of conversions running at once, nil means
+	// no bound
+	slots chan struct{}
+}
+
+// NewPDFConverterFromConfig creates the converter configured in pdf.command,
+// or returns nil when no command is configured. At most pdf.concurrency
+// conversions run at once.
+func NewPDFConverterFromConfig() *PDFConverter {
+	command := viper.GetStringSlice("pdf.command")
+	if len(command) == 0 {
+		return nil
+	}
+	timeout := viper.GetDuration("pdf.timeout")
+	if timeout <= 0 {
+		timeout = time.Minute
+	}
+	concurrency := viper.GetInt("pdf.concurrency")
+	if concurrency <= 0 {
+		concurrency = 2
+	}
+	return &PDFConverter{Command: command, Timeout: timeout, slots: make(chan struct{}, concurrency)}
+}
+
+// Convert returns the PDF of the HTML document html. Images other than data
+// URIs are replaced with their alternative text first, so the command never
+// fetches URLs taken from the CV. Conversions wait for a free slot until
+// ctx is done.
+func (p *PDFConverter) Convert(ctx context.Context, html []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+	if p.slots != nil {
+		select {
+		case p.slots <- struct{}{}:
+			defer func() { <-p.slots }()
+		case <-ctx.Done():
+			return nil, fmt.Errorf("no PDF conversion slot available: %w", ctx.Err())
+		}
+	}
+
+	html = stripRemoteImages(html)
+	dir, err := os.MkdirTemp("", "cv-pdf-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	input := filepath.Join(dir, "cv.html")
+	output := filepath.Join(dir, "cv.pdf")
+	if err := os.WriteFile(input, html, 0o600); err != nil {
+		return nil, err
+	}
+
+	args := make([]string, len(p.Command))
+	for i, arg := range p.Command {
+		args[i] = strings.NewReplacer("{input}", input, "{output}", output).Replace(arg)
+	}
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("PDF command failed: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	pdf, err := os.ReadFile(output)
+	if err != nil {
+		return nil, fmt.Errorf("PDF command wrote no output: %v", err)
+	}
+	return pdf, nil
+}
+
+// stripRemoteImages replaces the images of html that are not data URIs with
+// their alternative text
+func stripRemoteImages(html []byte) []byte {
+	return remoteImage.ReplaceAllFunc(html, func(tag []byte) []byte {
+		if src := imageSource.FindSubmatch(tag); src != nil && bytes.HasPrefix(bytes.ToLower(bytes.TrimSpace(src[1])), []byte("data:")) {
+			return tag
+		}
+		if alt := imageAlt.FindSubmatch(tag); alt != nil {
+			return alt[1]
+		}
+		return nil
+	})
+}
@@ -0,0 +1,41 @@
+package theme
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStripRemoteImages(t *testing.T) {
+	html := `<p><img src="http://169.254.169.254/latest/meta-data" alt="logo"> <IMG SRC='file:///etc/passwd'> <img src="data:image/png;base64,AAAA" alt="inline"></p>`
+	want := `<p>logo  <img src="data:image/png;base64,AAAA" alt="inline"></p>`
+	if got := string(stripRemoteImages([]byte(html))); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestPDFConverterConvert(t *testing.T) {
+	if _, err := exec.LookPath("cp"); err != nil {
+		t.Skip("cp not available")
+	}
+	p := &PDFConverter{Command: []string{"cp", "{input}", "{output}"}, Timeout: time.Second, slots: make(chan struct{}, 1)}
+
+	out, err := p.Convert(context.Background(), []byte(`<img src="https://example.com/x.png" alt="x">`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(out), "example.com") {
+		t.Errorf("remote image passed to the command: %s", out)
+	}
+
+	// Conversions beyond the limit wait for a slot
+	p.slots <- struct{}{}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := p.Convert(ctx, []byte("<p>CV</p>")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v with all slots taken, want a deadline error", err)
+	}
+}
@@ -0,0 +1,249 @@
+// Package theme renders CVs with themes. A theme is a directory holding a
+// cv.html Go template and a style.css stylesheet, applied to the HTML view,
+// the print view and the PDF export alike.
+package theme
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/spf13/viper"
+
+	"opengptmservice/internal/models"
+	"opengptmservice/internal/services"
+)
+
+//go:embed themes
+var defaultThemes embed.FS
+
+//go:embed document.html
+var documentHTML string
+
+var documentTemplate = template.Must(template.New("document").Parse(documentHTML))
+
+// Default is the theme used when none is chosen
+const Default = "classic"
+
+// Section is a CV section with its content rendered to HTML
+type Section struct {
+	Name  string
+	Title string
+	HTML  template.HTML
+}
+
+// Document is a CV prepared for the theme templates
+type Document struct {
+	// Title is the title of the standalone document, e.g. the user's name
+	Title    string
+	Sections []Section
+}
+
+// NewDocument renders the markdown of the sections of cv
+func NewDocument(title string, cv *models.CV) Document {
+	doc := Document{Title: title}
+	for _, section := range cv.Sections {
+		doc.Sections = append(doc.Sections, Section{
+			Name:  section.Name,
+			Title: section.Title,
+			HTML:  services.RenderMarkdown(section.Content),
+		})
+	}
+	return doc
+}
+
+// Only returns the sections with the given names, in CV order
+func (d Document) Only(names ...string) []Section {
+	var sections []Section
+	for _, section := range d.Sections {
+		if containsName(names, section.Name) {
+			sections = append(sections, section)
+		}
+	}
+	return sections
+}
+
+// Except returns the sections without the given names, in CV order
+func (d Document) Except(names ...string) []Section {
+	var sections []Section
+	for _, section := range d.Sections {
+		if !containsName(names, section.Name) {
+			sections = append(sections, section)
+		}
+	}
+	return sections
+}
+
+// Theme renders CVs with a template and stylesheet
+type Theme struct {
+	Name string
+	// Title is the name shown in the theme picker, defined by the "title"
+	// template of the theme
+	Title string
+	CSS   template.CSS
+	tmpl  *template.Template
+}
+
+// Body renders the markup of doc wrapped in an element of class
+// "cv cv-<name>", for embedding in a page along with CSS
+func (t *Theme) Body(doc Document) (template.HTML, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<div class="cv cv-%s">`, template.HTMLEscapeString(t.Name))
+	if err := t.tmpl.ExecuteTemplate(&buf, "cv", doc); err != nil {
+		return "", fmt.Errorf("failed to render theme %s: %v", t.Name, err)
+	}
+	buf.WriteString("</div>")
+	return template.HTML(buf.String()), nil
+}
+
+// Write renders doc as a standalone HTML document. With print set, the
+// document opens the print dialog once loaded.
+func (t *Theme) Write(w io.Writer, doc Document, print bool) error {
+	body, err := t.Body(doc)
+	if err != nil {
+		return err
+	}
+	return documentTemplate.Execute(w, map[string]interface{}{
+		"Title": doc.Title,
+		"CSS":   t.CSS,
+		"Body":  body,
+		"Print": print,
+	})
+}
+
+// Registry holds the available themes
+type Registry struct {
+	themes map[string]*Theme
+}
+
+// NewRegistryFromConfig loads the embedded themes and those in the
+// directory themes.dir
+func NewRegistryFromConfig() (*Registry, error) {
+	return NewRegistry(viper.GetString("themes.dir"))
+}
+
+// NewRegistry loads the embedded themes classic, modern and minimal and, if
+// dir is set, the themes in its subdirectories. A theme in dir with the name
+// of an embedded theme overrides it; files missing from its directory are
+// taken from the embedded theme.
+func NewRegistry(dir string) (*Registry, error) {
+	r := &Registry{themes: make(map[string]*Theme)}
+
+	embedded, err := fs.Sub(defaultThemes, "themes")
+	if err != nil {
+		return nil, err
+	}
+	names, err := fs.ReadDir(embedded, ".")
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range names {
+		theme, err := loadTheme(entry.Name(), embedded, nil)
+		if err != nil {
+			return nil, err
+		}
+		r.themes[theme.Name] = theme
+	}
+
+	if dir == "" {
+		return r, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read themes directory: %v", err)
+	}
+	custom := os.DirFS(dir)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		theme, err := loadTheme(entry.Name(), custom, embedded)
+		if err != nil {
+			return nil, err
+		}
+		r.themes[theme.Name] = theme
+	}
+	return r, nil
+}
+
+// Get returns the theme name, or the default theme if it does not exist
+func (r *Registry) Get(name string) *Theme {
+	if theme, ok := r.themes[name]; ok {
+		return theme
+	}
+	return r.themes[Default]
+}
+
+// Has reports whether the theme name exists
+func (r *Registry) Has(name string) bool {
+	_, ok := r.themes[name]
+	return ok
+}
+
+// List returns the themes, the default first and the others by name
+func (r *Registry) List() []*Theme {
+	themes := make([]*Theme, 0, len(r.themes))
+	for _, theme := range r.themes {
+		themes = append(themes, theme)
+	}
+	sort.Slice(themes, func(i, j int) bool {
+		if (themes[i].Name == Default) != (themes[j].Name == Default) {
+			return themes[i].Name == Default
+		}
+		return themes[i].Name < themes[j].Name
+	})
+	return themes
+}
+
+// loadTheme reads the theme name from fsys, falling back to the files of
+// the theme with the same name in fallback
+func loadTheme(name string, fsys, fallback fs.FS) (*Theme, error) {
+	read := func(file string) ([]byte, error) {
+		data, err := fs.ReadFile(fsys, filepath.ToSlash(filepath.Join(name, file)))
+		if err != nil && fallback != nil {
+			data, err = fs.ReadFile(fallback, name+"/"+file)
+		}
+		return data, err
+	}
+
+	source, err := read("cv.html")
+	if err != nil {
+		return nil, fmt.Errorf("theme %s has no cv.html", name)
+	}
+	tmpl, err := template.New(name).Parse(string(source))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse theme %s: %v", name, err)
+	}
+	if tmpl.Lookup("cv") == nil {
+		return nil, fmt.Errorf("theme %s does not define a \"cv\" template", name)
+	}
+	css, err := read("style.css")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read the stylesheet of theme %s: %v", name, err)
+	}
+
+	theme := &Theme{Name: name, Title: name, CSS: template.CSS(css), tmpl: tmpl}
+	if tmpl.Lookup("title") != nil {
+		var title bytes.Buffer
+		if err := tmpl.ExecuteTemplate(&title, "title", nil); err == nil && title.Len() > 0 {
+			theme.Title = title.String()
+		}
+	}
+	return theme, nil
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package theme
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"opengptmservice/internal/models"
+)
+
+func testDocument() Document {
+	return NewDocument("Jane Doe", &models.CV{Sections: []models.CVSection{
+		{Name: "header", Content: "# Jane Doe"},
+		{Name: "summary", Title: "Summary", Content: "Web **developer** <script>alert(1)</script>"},
+		{Name: "skills", Title: "Skills", Content: "- Go"},
+	}})
+}
+
+func TestRegistry(t *testing.T) {
+	r, err := NewRegistry("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, theme := range r.List() {
+		names = append(names, theme.Name)
+	}
+	if strings.Join(names, ",") != "classic,minimal,modern" {
+		t.Errorf("got themes %v", names)
+	}
+	if title := r.Get("modern").Title; title != "Modern two-column" {
+		t.Errorf("got title %q", title)
+	}
+	if r.Has("neon") || r.Get("neon").Name != Default {
+		t.Error("unknown theme does not fall back to the default")
+	}
+
+	body, err := r.Get("modern").Body(testDocument())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`class="cv cv-modern"`, "<aside>", "<strong>developer</strong>"} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("body does not contain %q", want)
+		}
+	}
+	if strings.Contains(string(body), "<script>") {
+		t.Error("body contains raw HTML of the CV")
+	}
+
+	var buf bytes.Buffer
+	if err := r.Get("minimal").Write(&buf, testDocument(), true); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"<title>Jane Doe</title>", ".cv-minimal", "window.print()"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("document does not contain %q", want)
+		}
+	}
+}
+
+func TestRegistryOverrides(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("classic/style.css", ".cv-classic { color: teal; }")
+	write("plain/cv.html", `{{ define "cv" }}{{ range .Sections }}<p>{{ .HTML }}</p>{{ end }}{{ end }}`)
+
+	r, err := NewRegistry(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	classic := r.Get("classic")
+	if !strings.Contains(string(classic.CSS), "teal") || classic.Title != "Classic" {
+		t.Errorf("classic was not overridden with its embedded template kept: %q, %q", classic.CSS, classic.Title)
+	}
+	if !r.Has("plain") || r.Get("plain").Title != "plain" {
+		t.Error("custom theme was not loaded")
+	}
+
+	write("broken/cv.html", `<p>no cv template</p>`)
+	if _, err := NewRegistry(dir); err == nil {
+		t.Error("theme without a cv template was loaded")
+	}
+}
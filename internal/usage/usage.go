@@ -0,0 +1,265 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// ErrBudgetExceeded is matched by errors returned when a daily budget is spent
+var ErrBudgetExceeded = errors.New("daily LLM budget exceeded")
+
+// BudgetError is returned when a user or the whole service has spent its daily budget
+type BudgetError struct {
+	User   string
+	Budget float64
+}
+
+func (e *BudgetError) Error() string {
+	if e.User == "" {
+		return fmt.Sprintf("the service has reached its daily AI budget of $%.2f, please try again tomorrow or use the template generator", e.Budget)
+	}
+	return fmt.Sprintf("you have reached your daily AI budget of $%.2f, please try again tomorrow or use the template generator", e.Budget)
+}
+
+// Is makes errors.Is(err, ErrBudgetExceeded) match
+func (e *BudgetError) Is(target error) bool {
+	return target == ErrBudgetExceeded
+}
+
+// Price is the cost of a model in USD per million tokens
+type Price struct {
+	Model                string  `mapstructure:"model" json:"model"`
+	PromptPerMillion     float64 `mapstructure:"prompt_per_million" json:"prompt_per_million"`
+	CompletionPerMillion float64 `mapstructure:"completion_per_million" json:"completion_per_million"`
+}
+
+// Record is the usage of a single LLM call
+type Record struct {
+	Time             time.Time `json:"time"`
+	User             string    `json:"user"`
+	Job              string    `json:"job,omitempty"`
+	Model            string    `json:"model"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	CostUSD          float64   `json:"cost_usd"`
+}
+
+// Totals aggregates usage records
+type Totals struct {
+	Calls            int     `json:"calls"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+}
+
+func (t *Totals) add(r Record) {
+	t.Calls++
+	t.PromptTokens += r.PromptTokens
+	t.CompletionTokens += r.CompletionTokens
+	t.CostUSD += r.CostUSD
+}
+
+// Summary is a snapshot of the tracked usage
+type Summary struct {
+	Day    string            `json:"day"`
+	Today  Totals            `json:"today"`
+	Users  map[string]Totals `json:"users"`
+	Jobs   map[string]Totals `json:"jobs"`
+	Models map[string]Totals `json:"models"`
+	// AllTime aggregates usage per model since the server started
+	AllTime map[string]Totals `json:"all_time"`
+	Budget  struct {
+		UserDailyUSD   float64 `json:"user_daily_usd"`
+		GlobalDailyUSD float64 `json:"global_daily_usd"`
+	} `json:"budget"`
+}
+
+// Tracker records token usage and cost per user, job and model, and enforces
+// daily budgets. Daily totals reset at midnight UTC.
+type Tracker struct {
+	prices      map[string]Price
+	userDaily   float64
+	globalDaily float64
+	logger      *slog.Logger
+
+	mu      sync.Mutex
+	day     string
+	today   Totals
+	users   map[string]*Totals
+	jobs    map[string]*Totals
+	models  map[string]*Totals
+	allTime map[string]*Totals
+}
+
+// NewTracker creates a tracker. A budget of 0 disables it.
+func NewTracker(prices []Price, userDaily, globalDaily float64) *Tracker {
+	t := &Tracker{
+		prices:      make(map[string]Price),
+		userDaily:   userDaily,
+		globalDaily: globalDaily,
+		logger:      slog.New(slog.NewJSONHandler(os.Stderr, nil)),
+		allTime:     make(map[string]*Totals),
+	}
+	for _, p := range prices {
+		t.prices[p.Model] = p
+	}
+	t.reset(today())
+	return t
+}
+
+// NewTrackerFromConfig creates a tracker from llm.pricing and llm.budget
+func NewTrackerFromConfig() *Tracker {
+	var prices []Price
+	if err := viper.UnmarshalKey("llm.pricing", &prices); err != nil {
+		log.Printf("Warning: Invalid llm.pricing configuration: %v", err)
+	}
+	return NewTracker(prices,
+		viper.GetFloat64("llm.budget.user_daily_usd"),
+		viper.GetFloat64("llm.budget.global_daily_usd"))
+}
+
+// Budgeted reports whether a daily budget is enforced
+func (t *Tracker) Budgeted() bool {
+	return t.userDaily > 0 || t.globalDaily > 0
+}
+
+// Priced reports whether a price is configured for model
+func (t *Tracker) Priced(model string) bool {
+	_, ok := t.prices[model]
+	return ok
+}
+
+// Check returns a BudgetError if the user or the service has spent its daily
+// budget. Spending is only known once calls are recorded, so calls checked
+// concurrently all pass and may together overshoot the budget by their cost.
+func (t *Tracker) Check(user string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rollover()
+
+	if t.globalDaily > 0 && t.today.CostUSD >= t.globalDaily {
+		return &BudgetError{Budget: t.globalDaily}
+	}
+	if totals, ok := t.users[user]; ok && t.userDaily > 0 && totals.CostUSD >= t.userDaily {
+		return &BudgetError{User: user, Budget: t.userDaily}
+	}
+	return nil
+}
+
+// Record accounts for the tokens used by a call made on behalf of the scope in ctx
+func (t *Tracker) Record(ctx context.Context, model string, promptTokens, completionTokens int) Record {
+	scope := ScopeFrom(ctx)
+	price := t.prices[model]
+	r := Record{
+		Time:             time.Now(),
+		User:             scope.User,
+		Job:              scope.Job,
+		Model:            model,
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		CostUSD: (float64(promptTokens)*price.PromptPerMillion +
+			float64(completionTokens)*price.CompletionPerMillion) / 1e6,
+	}
+
+	t.mu.Lock()
+	t.rollover()
+	t.today.add(r)
+	totals(t.users, r.User).add(r)
+	if r.Job != "" {
+		totals(t.jobs, r.Job).add(r)
+	}
+	totals(t.models, r.Model).add(r)
+	totals(t.allTime, r.Model).add(r)
+	t.mu.Unlock()
+
+	t.logger.Info("llm_usage",
+		"user", r.User,
+		"job", r.Job,
+		"model", r.Model,
+		"prompt_tokens", r.PromptTokens,
+		"completion_tokens", r.CompletionTokens,
+		"cost_usd", r.CostUSD)
+	return r
+}
+
+// Summary returns a snapshot of today's usage and all-time usage per model
+func (t *Tracker) Summary() Summary {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rollover()
+
+	s := Summary{
+		Day:     t.day,
+		Today:   t.today,
+		Users:   snapshot(t.users),
+		Jobs:    snapshot(t.jobs),
+		Models:  snapshot(t.models),
+		AllTime: snapshot(t.allTime),
+	}
+	s.Budget.UserDailyUSD = t.userDaily
+	s.Budget.GlobalDailyUSD = t.globalDaily
+	return s
+}
+
+// rollover resets the daily totals when the day changed. Callers hold t.mu.
+func (t *Tracker) rollover() {
+	if day := today(); day != t.day {
+		t.reset(day)
+	}
+}
+
+func (t *Tracker) reset(day string) {
+	t.day = day
+	t.today = Totals{}
+	t.users = make(map[string]*Totals)
+	t.jobs = make(map[string]*Totals)
+	t.models = make(map[string]*Totals)
+}
+
+func today() string {
+	return time.Now().UTC().Format("2006-01-02")
+}
+
+func totals(m map[string]*Totals, key string) *Totals {
+	t, ok := m[key]
+	if !ok {
+		t = &Totals{}
+		m[key] = t
+	}
+	return t
+}
+
+func snapshot(m map[string]*Totals) map[string]Totals {
+	out := make(map[string]Totals, len(m))
+	for k, v := range m {
+		out[k] = *v
+	}
+	return out
+}
+
+type scopeKey struct{}
+
+// Scope identifies who an LLM call is made for
+type Scope struct {
+	User string
+	Job  string
+}
+
+// WithScope returns a context attributing LLM usage to the given scope
+func WithScope(ctx context.Context, scope Scope) context.Context {
+	return context.WithValue(ctx, scopeKey{}, scope)
+}
+
+// ScopeFrom returns the scope stored in ctx
+func ScopeFrom(ctx context.Context) Scope {
+	scope, _ := ctx.Value(scopeKey{}).(Scope)
+	return scope
+}
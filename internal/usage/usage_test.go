@@ -0,0 +1,132 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math"
+	"testing"
+)
+
+// newTestTracker returns a tracker pricing "priced" at $1 per million prompt
+// tokens and $2 per million completion tokens, without usage log lines
+func newTestTracker(userDaily, globalDaily float64) *Tracker {
+	t := NewTracker([]Price{{Model: "priced", PromptPerMillion: 1, CompletionPerMillion: 2}}, userDaily, globalDaily)
+	t.logger = slog.New(slog.NewJSONHandler(io.Discard, nil))
+	return t
+}
+
+func scoped(user, job string) context.Context {
+	return WithScope(context.Background(), Scope{User: user, Job: job})
+}
+
+func TestTrackerRecordCost(t *testing.T) {
+	tracker := newTestTracker(0, 0)
+
+	r := tracker.Record(scoped("alice", "job-1"), "priced", 500000, 250000)
+	if math.Abs(r.CostUSD-1) > 1e-9 || r.User != "alice" || r.Job != "job-1" {
+		t.Errorf("got record %+v, want $1 for alice's job-1", r)
+	}
+	if r := tracker.Record(scoped("alice", ""), "unpriced", 1000000, 1000000); r.CostUSD != 0 {
+		t.Errorf("unpriced model cost $%f, want $0", r.CostUSD)
+	}
+}
+
+func TestTrackerCheckBudgets(t *testing.T) {
+	tests := []struct {
+		name        string
+		userDaily   float64
+		globalDaily float64
+		// spent is what alice spends before the checks
+		spent     float64
+		alice     bool
+		bob       bool
+		aliceUser bool
+	}{
+		{name: "no budgets", spent: 100},
+		{name: "user budget left", userDaily: 2, spent: 1},
+		{name: "user budget spent", userDaily: 2, spent: 2, alice: true, aliceUser: true},
+		{name: "global budget left", globalDaily: 2, spent: 1},
+		{name: "global budget spent", globalDaily: 2, spent: 2, alice: true, bob: true},
+		{name: "global before user budget", userDaily: 1, globalDaily: 1, spent: 1, alice: true, bob: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := newTestTracker(tt.userDaily, tt.globalDaily)
+			if tt.spent > 0 {
+				tracker.Record(scoped("alice", ""), "priced", int(tt.spent*1e6), 0)
+			}
+
+			err := tracker.Check("alice")
+			if (err != nil) != tt.alice || err != nil && !errors.Is(err, ErrBudgetExceeded) {
+				t.Errorf("Check(alice) = %v, want refused: %v", err, tt.alice)
+			}
+			var budgetErr *BudgetError
+			if errors.As(err, &budgetErr) && (budgetErr.User == "alice") != tt.aliceUser {
+				t.Errorf("got budget error for user %q", budgetErr.User)
+			}
+			if err := tracker.Check("bob"); (err != nil) != tt.bob {
+				t.Errorf("Check(bob) = %v, want refused: %v", err, tt.bob)
+			}
+		})
+	}
+}
+
+func TestTrackerRollover(t *testing.T) {
+	tracker := newTestTracker(1, 0)
+	tracker.Record(scoped("alice", "job-1"), "priced", 1000000, 0)
+	if err := tracker.Check("alice"); err == nil {
+		t.Fatal("spent budget not enforced")
+	}
+
+	// The next day starts with fresh daily totals, keeping the all-time ones
+	tracker.mu.Lock()
+	tracker.day = "2000-01-01"
+	tracker.mu.Unlock()
+	if err := tracker.Check("alice"); err != nil {
+		t.Errorf("budget of the previous day enforced: %v", err)
+	}
+	s := tracker.Summary()
+	if s.Day != today() || s.Today.Calls != 0 || len(s.Users) != 0 || len(s.Jobs) != 0 || len(s.Models) != 0 {
+		t.Errorf("daily totals not reset: %+v", s)
+	}
+	if s.AllTime["priced"].Calls != 1 {
+		t.Errorf("all-time totals reset: %+v", s.AllTime)
+	}
+}
+
+func TestTrackerSummary(t *testing.T) {
+	tracker := newTestTracker(5, 10)
+	tracker.Record(scoped("alice", "job-1"), "priced", 1000000, 0)
+	tracker.Record(scoped("alice", "job-1"), "unpriced", 10, 20)
+	tracker.Record(scoped("bob", ""), "priced", 0, 1000000)
+
+	s := tracker.Summary()
+	if s.Today.Calls != 3 || s.Today.PromptTokens != 1000010 || s.Today.CompletionTokens != 1000020 || math.Abs(s.Today.CostUSD-3) > 1e-9 {
+		t.Errorf("got today %+v", s.Today)
+	}
+	if alice := s.Users["alice"]; alice.Calls != 2 || math.Abs(alice.CostUSD-1) > 1e-9 {
+		t.Errorf("got alice %+v", alice)
+	}
+	if bob := s.Users["bob"]; bob.Calls != 1 || math.Abs(bob.CostUSD-2) > 1e-9 {
+		t.Errorf("got bob %+v", bob)
+	}
+	// Calls without a job are not attributed to one
+	if len(s.Jobs) != 1 || s.Jobs["job-1"].Calls != 2 {
+		t.Errorf("got jobs %+v", s.Jobs)
+	}
+	if s.Models["priced"].Calls != 2 || s.Models["unpriced"].CostUSD != 0 || s.AllTime["unpriced"].Calls != 1 {
+		t.Errorf("got models %+v, all time %+v", s.Models, s.AllTime)
+	}
+	if s.Budget.UserDailyUSD != 5 || s.Budget.GlobalDailyUSD != 10 {
+		t.Errorf("got budget %+v", s.Budget)
+	}
+
+	// The summary is a snapshot
+	tracker.Record(scoped("alice", ""), "priced", 1, 0)
+	if s.Users["alice"].Calls != 2 {
+		t.Error("summary changed with a later call")
+	}
+}